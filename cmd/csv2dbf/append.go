@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+)
+
+// appendTypes are the field types -append can write values into
+const appendTypes = "CNFDLMIBYT"
+
+// readTableFields reads the header and fields of an existing DBF. The
+// VFP field flags are turned into field options, so nullable fields get
+// their null bits and autoincrement fields continue their numbering.
+func readTableFields(f *os.File) (DBFHeader, []FieldInfo, error) {
+	var h DBFHeader
+	if err := binary.Read(io.NewSectionReader(f, 0, 32), binary.LittleEndian, &h); err != nil {
+		return h, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if h.HeaderLen < 33 || h.RecLen < 1 {
+		return h, nil, fmt.Errorf("invalid header length")
+	}
+	raw := make([]byte, h.HeaderLen)
+	if _, err := f.ReadAt(raw, 0); err != nil {
+		return h, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	var fields []FieldInfo
+	recLen, nullFlags := 1, 0
+	for pos := 32; pos+32 <= len(raw) && raw[pos] != 0x0D; pos += 32 {
+		var df DBFField
+		binary.Read(bytes.NewReader(raw[pos:pos+32]), binary.LittleEndian, &df)
+		name, _, _ := bytes.Cut(df.Name[:], []byte{0})
+		length := int(df.Len)
+		if df.Flags&fieldFlagSystem != 0 {
+			if nullFlags > 0 || string(name) != "_NullFlags" {
+				return h, nil, fmt.Errorf("unsupported system field %s", name)
+			}
+			nullFlags = length
+			recLen += length
+			continue
+		}
+		if nullFlags > 0 {
+			return h, nil, fmt.Errorf("field %s follows the null flags", name)
+		}
+
+		field := FieldInfo{Name: string(name), Type: df.Type, Length: length, Dec: int(df.Dec)}
+		if df.Type == 'C' && df.Dec > 0 {
+			// Clipper long character field: the length continues in Dec
+			field.Length += int(df.Dec) << 8
+			field.Dec = 0
+		}
+		if !strings.ContainsRune(appendTypes, rune(df.Type)) {
+			return h, nil, fmt.Errorf("field %s: appending to type %c fields is not supported", name, df.Type)
+		}
+		if h.Version == 0x30 || h.Version == 0x31 || h.Version == 0x32 {
+			field.Opts.Nullable = df.Flags&fieldFlagNullable != 0
+			if df.Flags&fieldFlagAutoInc != 0 {
+				field.Opts.AutoInc, field.Opts.Next, field.Opts.Step = true, int64(int32(df.AutoNext)), max(int(df.AutoStep), 1)
+			}
+		}
+		fields = append(fields, field)
+		recLen += field.Length
+	}
+
+	if nullFlags != nullFlagsLen(fields) {
+		return h, nil, fmt.Errorf("null flags of %d bytes do not match %d nullable fields", nullFlags, nullFlagsLen(fields))
+	}
+	if recLen != int(h.RecLen) {
+		return h, nil, fmt.Errorf("record length %d does not match the fields (%d)", h.RecLen, recLen)
+	}
+	return h, fields, nil
+}
+
+// checkAppendColumns compares the columns of the CSV with the fields of the
+// table: with a header row, the names (after -rename and normalization)
+// must match the field names in order; without, the column count must.
+func checkAppendColumns(csvPath string, comma rune, quote rune, fields []FieldInfo) error {
+	f, err := openCSV(csvPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	row, err := getRecordReader(f, comma, quote).Read()
+	if err == io.EOF {
+		return nil // nothing to append
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read header: %v", err)
+	}
+	// dbf2csv -shapefile exports the deletion flags as a last _DELETED column
+	if shapeTarget != nil && !flagNoHeader && len(row) == len(fields)+1 && strings.EqualFold(strings.TrimSpace(row[len(fields)]), "_DELETED") {
+		row = row[:len(fields)]
+		shapeTarget.deletedColumn = true
+	}
+	if len(row) != len(fields) {
+		return fmt.Errorf("CSV has %d columns, the table %d fields", len(row), len(fields))
+	}
+	if flagNoHeader {
+		return nil
+	}
+
+	columns := make([]FieldInfo, len(row))
+	for i, name := range row {
+		columns[i].Name = strings.TrimSpace(name)
+	}
+	renameFields(columns)
+	normalizeFieldNames(columns)
+	for i, c := range columns {
+		if !strings.EqualFold(c.Name, fields[i].Name) {
+			return fmt.Errorf("column %d (%s) does not match field %s", i+1, row[i], fields[i].Name)
+		}
+	}
+	return nil
+}
+
+// appendCSVtoDBF appends the records of a CSV to the -append table: they
+// are written over the 0x1A end-of-file marker, after which the record
+// count, last-update date and autoincrement values in the header are
+// updated. Text memos go to the end of the table's .fpt file. With -upsert
+// records whose key is already in the table update it instead. On failure
+// both files are restored to their old contents.
+func appendCSVtoDBF(ctx context.Context, csvPath string, comma rune, quote rune, enc encoding.Encoding) (err error) {
+	dbfPath := flagAppend
+	dbfFile, err := os.OpenFile(dbfPath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open DBF: %w", err)
+	}
+	defer dbfFile.Close()
+
+	fmt.Println("  [1/2] Reading table structure...")
+	stageStart := time.Now()
+	header, fields, err := readTableFields(dbfFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", dbfPath, err)
+	}
+	fmt.Printf("  >> Fields: %d, Records: %d (%s)\n", len(fields), header.NumRecs, dbfPath)
+	if ldid := header.Reserved[29-12]; ldid != 0 && vfpCodePage(enc) != 0 && ldid != vfpCodePage(enc) {
+		warnf("the table declares another code page than %s", strings.ToUpper(flagEncoding))
+	}
+	warnIndex(dbfPath, header)
+	if err := checkAppendColumns(csvPath, comma, quote, fields); err != nil {
+		return fmt.Errorf("CSV does not match %s: %w", dbfPath, err)
+	}
+
+	st, err := dbfFile.Stat()
+	if err != nil {
+		return err
+	}
+	dataEnd := int64(header.HeaderLen) + int64(header.NumRecs)*int64(header.RecLen)
+	if st.Size() < dataEnd {
+		return fmt.Errorf("%s: file is shorter than its %d records", dbfPath, header.NumRecs)
+	}
+	// Keep what follows the records (the EOF marker) to restore on failure
+	tail := make([]byte, st.Size()-dataEnd)
+	if _, err := dbfFile.ReadAt(tail, dataEnd); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dbfFile.Truncate(dataEnd)
+			dbfFile.WriteAt(tail, dataEnd)
+		}
+	}()
+
+	var memo *memoWriter
+	if hasMemoFields(fields) {
+		memoPath := findTableMemo(dbfPath)
+		if memoPath == "" {
+			return fmt.Errorf("%s: memo file not found", dbfPath)
+		}
+		memoSize, err := fileSize(memoPath)
+		if err != nil {
+			return err
+		}
+		if memo, err = openMemo(memoPath); err != nil {
+			return fmt.Errorf("failed to open memo file: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				memo.f.Close()
+				os.Truncate(memoPath, memoSize)
+			}
+		}()
+		fmt.Printf("  >> Memo: %s\n", memoPath)
+	}
+
+	if _, err := dbfFile.Seek(dataEnd, io.SeekStart); err != nil {
+		return err
+	}
+	writer := bufio.NewWriterSize(throttleWriter(dbfFile), bufferSize(int(header.RecLen)))
+
+	var keys *keyIndex
+	if flagUpsert != "" {
+		if keys, err = newKeyIndex(dbfFile, writer, header, fields, flagUpsert); err != nil {
+			return fmt.Errorf("%s: %w", dbfPath, err)
+		}
+		defer func() {
+			if err != nil {
+				keys.restore()
+			}
+		}()
+	}
+
+	logStage("structure", stageStart, header.NumRecs)
+	fmt.Println("  [2/2] Appending records...")
+	stageStart = time.Now()
+	written, err := writeDBFRecords(ctx, csvPath, &dbfOutput{w: writer, memo: memo}, keys, fields, 0, comma, quote, enc)
+	if err != nil {
+		return err
+	}
+	if keys != nil {
+		written = keys.inserted
+	}
+	logStage("records", stageStart, written)
+	if uint64(header.NumRecs)+uint64(written) > 0xFFFFFFFF {
+		return fmt.Errorf("record count exceeds the DBF limit")
+	}
+
+	// Write EOF marker
+	if err := writer.WriteByte(0x1A); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := dbfFile.Truncate(dataEnd + int64(written)*int64(header.RecLen) + 1); err != nil {
+		return err
+	}
+
+	now := lastUpdate()
+	if _, err := dbfFile.WriteAt([]byte{byte(now.Year() - 1900), byte(now.Month()), byte(now.Day())}, 1); err != nil {
+		return fmt.Errorf("failed to update header: %w", err)
+	}
+	if err := patchRecordCount(dbfFile, header.NumRecs+written); err != nil {
+		return err
+	}
+	if err := clearIndexFlag(dbfFile, header); err != nil {
+		return err
+	}
+	if hasAutoIncFields(fields) {
+		if err := patchAutoIncrement(dbfFile, fields); err != nil {
+			return err
+		}
+	}
+	if memo != nil {
+		if err := memo.close(); err != nil {
+			return fmt.Errorf("failed to write memo file: %w", err)
+		}
+	}
+	if keys != nil {
+		fmt.Printf("  >> Upserted: %d records updated, %d inserted in %s (%d in total)\n", keys.updated, keys.inserted, dbfPath, header.NumRecs+written)
+	} else {
+		fmt.Printf("  >> Appended: %d records to %s (%d in total)\n", written, dbfPath, header.NumRecs+written)
+	}
+	return dropIndex(dbfPath)
+}
+
+// findTableMemo returns the .fpt file of a table, or "" if none exists
+func findTableMemo(dbfPath string) string {
+	base := strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath))
+	for _, ext := range []string{".fpt", ".FPT"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+func fileSize(path string) (int64, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return st.Size(), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
+
+// benchStats captures timing and allocator counters at the start of a run
+type benchStats struct {
+	start   time.Time
+	mallocs uint64
+	numGC   uint32
+}
+
+func startBench() benchStats {
+	benchStages = benchTimes{}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return benchStats{start: time.Now(), mallocs: ms.Mallocs, numGC: ms.NumGC}
+}
+
+// report prints throughput and allocation figures for rows records
+// totalling n bytes of DBF records, then the parse and encode stages on
+// their own. The total includes the analysis pass.
+func (b benchStats) report(rows uint32, n int64) {
+	elapsed := time.Since(b.start).Seconds()
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	allocsPerRow := 0.0
+	if rows > 0 {
+		allocsPerRow = float64(ms.Mallocs-b.mallocs) / float64(rows)
+	}
+	if elapsed <= 0 {
+		elapsed = 1e-9
+	}
+
+	fmt.Printf("  >> Bench: %d rows in %.3fs (%.0f rows/s, %.1f MB/s), %.2f allocs/row, %d GC cycles\n",
+		rows, elapsed, float64(rows)/elapsed, float64(benchStages.input)/elapsed/(1<<20), allocsPerRow, ms.NumGC-b.numGC)
+	stageRate("parse ", benchStages.parse, rows, benchStages.input)
+	stageRate("encode", benchStages.encode, rows, n)
+}
+
+// stageRate prints the throughput of one stage over its own time; n is the
+// bytes it consumed (parse) or produced (encode)
+func stageRate(stage string, d time.Duration, rows uint32, n int64) {
+	if d <= 0 {
+		return
+	}
+	sec := d.Seconds()
+	fmt.Printf("  >> Bench %s: %.3fs (%.0f rows/s, %.1f MB/s)\n", stage, sec, float64(rows)/sec, float64(n)/sec/(1<<20))
+}
+
+// benchTimes splits the records pass of a -bench run into its stages:
+// parse reads the CSV rows in the input encoding, encode converts the
+// values and builds the DBF records in the table encoding
+type benchTimes struct {
+	parse  time.Duration
+	encode time.Duration
+	input  int64 // CSV bytes read in the records pass
+}
+
+// benchStages are the stage times of the current table
+var benchStages benchTimes
+
+// lap adds the time since mark to a stage and moves mark on, with -bench
+func lap(stage *time.Duration, mark *time.Time) {
+	if !flagBench {
+		return
+	}
+	now := time.Now()
+	*stage += now.Sub(*mark)
+	*mark = now
+}
+
+// benchPath returns the file a table or memo file is written to: with
+// -bench the null device, so the run does no output I/O
+func benchPath(path string) string {
+	if flagBench {
+		return os.DevNull
+	}
+	return path
+}
+
+// benchInput counts the CSV bytes read with -bench
+func benchInput(r io.Reader) io.Reader {
+	if !flagBench {
+		return r
+	}
+	return &countingReader{r}
+}
+
+type countingReader struct {
+	r io.Reader
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	benchStages.input += int64(n)
+	return n, err
+}
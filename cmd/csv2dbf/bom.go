@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// csvBOMs lists the byte order marks recognized at the start of a CSV.
+// A BOM overrides -ie, since it states the encoding outright; each decoder
+// consumes the mark so it never ends up in the first field name.
+var csvBOMs = []struct {
+	mark []byte
+	name string
+	enc  encoding.Encoding
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "UTF-8", unicode.UTF8BOM},
+	{[]byte{0xFF, 0xFE}, "UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)},
+	{[]byte{0xFE, 0xFF}, "UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)},
+}
+
+// detectBOM peeks at the start of br and returns the encoding announced by
+// its byte order mark, or nil if there is none
+func detectBOM(br *bufio.Reader) (string, encoding.Encoding) {
+	head, _ := br.Peek(3)
+	for _, b := range csvBOMs {
+		if bytes.HasPrefix(head, b.mark) {
+			return b.name, b.enc
+		}
+	}
+	return "", nil
+}
+
+// fileBOM returns the name of the encoding announced by the byte order mark
+// of the file at path, or "" if it has none or cannot be read
+func fileBOM(path string) string {
+	f, err := openCSV(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	name, _ := detectBOM(bufio.NewReaderSize(f, 16))
+	return name
+}
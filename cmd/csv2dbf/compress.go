@@ -0,0 +1,71 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Output compression (-compress)
+const (
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+// compressExts are the extensions added to compressed output files
+var compressExts = map[string]string{compressGzip: ".gz", compressZstd: ".zst"}
+
+// newCompressor wraps w in the -compress compressor. Close must be called
+// to write the end of the stream; it does not close w.
+func newCompressor(w io.Writer) (io.WriteCloser, error) {
+	if flagCompress == compressZstd {
+		return zstd.NewWriter(w)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// compressFile replaces a finished output file with its compressed form
+// (data.dbf -> data.dbf.gz). The DBF is patched in place while it is
+// written, so it can only be compressed once complete.
+func compressFile(path string) (err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	outPath := path + compressExts[flagCompress]
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(outPath)
+		}
+	}()
+
+	zw, err := newCompressor(throttleWriter(out))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, throttleReader(in)); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Printf("  >> Compressed: %s\n", outPath)
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// explainConversion prints the plan for -explain: how the CSV will be read,
+// how each column maps to a DBF field, and where the table is written.
+// columns holds the CSV header names before renaming and normalization.
+func explainConversion(csvPaths []string, dbfPath string, columns []string, fields []FieldInfo, recordCount uint32, comma rune) {
+	fmt.Println("  Plan:")
+	fmt.Printf("    Input     : %s\n", strings.Join(csvPaths, ", "))
+	if len(csvPaths) > 1 {
+		fmt.Printf("    Merge     : %d files, header row checked and skipped in each\n", len(csvPaths))
+	}
+	header := "header row"
+	if flagNoHeader {
+		header = "no header row"
+	}
+	if layoutColumns != nil {
+		fmt.Printf("    Dialect   : fixed-width, %d columns from layout %s\n", len(layoutColumns), flagLayout)
+	} else {
+		fmt.Printf("    Dialect   : delimiter %s, quote '\"', %s\n", strconv.QuoteRune(comma), header)
+	}
+	input := strings.ToUpper(flagInputEncoding)
+	if bom := fileBOM(csvPaths[0]); bom != "" {
+		input = bom + " (byte order mark)"
+	}
+	fmt.Printf("    Encoding  : CSV %s -> DBF %s (unrepresentable characters: %s)\n", input, strings.ToUpper(flagEncoding), flagOnEncodeError)
+	if flagSchema != "" {
+		fmt.Printf("    Structure : from schema %s\n", flagSchema)
+	} else if likeTemplate != nil {
+		fmt.Printf("    Structure : like %s\n", likeTemplate.path)
+	} else {
+		fmt.Printf("    Structure : analyzed, %d records\n", recordCount)
+	}
+	if flagTypedCSV {
+		fmt.Println("    Values    : typed (ISO dates, true/false and numbers parsed)")
+	}
+
+	recLen := 1
+	for _, f := range fields {
+		recLen += f.Length
+	}
+	format := "dBase III"
+	if likeTemplate != nil {
+		format = fmt.Sprintf("version 0x%02X of the template", likeTemplate.header.Version)
+	} else if flagVFP {
+		format = "Visual FoxPro"
+	} else if hasMemoFields(fields) {
+		format = "FoxPro 2.x with memo"
+	}
+	fmt.Printf("    Output    : %s (%s, record length %d)\n", dbfPath, format, recLen)
+	if hasMemoFields(fields) {
+		fmt.Printf("    Memo      : %s\n", memoPathFor(dbfPath))
+	}
+	if flagCompress != "" {
+		fmt.Printf("    Compress  : %s, to %s\n", flagCompress, dbfPath+compressExts[flagCompress])
+	}
+
+	fmt.Println("    Fields    :")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "      #\tCOLUMN\t\tFIELD\tTYPE\tLEN\tDEC\tCONVERSION")
+	for i, f := range fields {
+		column := ""
+		if i < len(columns) {
+			column = columns[i]
+		}
+		fmt.Fprintf(tw, "      %d\t%s\t->\t%s\t%c\t%d\t%d\t%s\n", i+1, column, f.Name, f.Type, f.Length, f.Dec, describeConversion(f))
+	}
+	tw.Flush()
+}
+
+// describeConversion explains how CSV values are stored in a field
+func describeConversion(f FieldInfo) string {
+	var steps []string
+	if f.Opts.Null != "" {
+		steps = append(steps, fmt.Sprintf("%q as empty", f.Opts.Null))
+	}
+	if f.Opts.Trim != "" {
+		steps = append(steps, "trim "+f.Opts.Trim)
+	}
+	if f.Opts.Nullable {
+		steps = append(steps, "empty as NULL")
+	}
+
+	switch {
+	case f.Opts.AutoInc:
+		steps = append(steps, fmt.Sprintf("32-bit integer, binary, autoincrement from %d step %d for empty values", f.Opts.Next, f.Opts.Step))
+	case f.Type == 'I':
+		steps = append(steps, "32-bit integer, binary")
+	case f.Type == 'B':
+		steps = append(steps, "double, binary")
+	case f.Type == 'Y':
+		steps = append(steps, "currency in 1/10000 units, binary")
+	case f.Type == 'T':
+		steps = append(steps, "datetime as Julian day + milliseconds, binary")
+	case f.Type == 'D':
+		steps = append(steps, "ISO or YYYYMMDD date as YYYYMMDD")
+	case f.Type == 'L':
+		steps = append(steps, "true/false, yes/no, Y/N as T/F")
+	case f.Type == 'M':
+		steps = append(steps, "text in the .fpt memo file")
+	case f.Type == 'N' || f.Type == 'F':
+		steps = append(steps, fmt.Sprintf("number with %d decimals, right-aligned", f.Dec))
+	case flagOnTruncate == truncateError:
+		steps = append(steps, fmt.Sprintf("text, longer than %d bytes fails", f.Length))
+	default:
+		steps = append(steps, fmt.Sprintf("text, cut at %d bytes", f.Length))
+	}
+
+	if f.Opts.Justify == "right" {
+		steps = append(steps, "right-justified")
+	}
+	if f.Opts.Pad == '0' {
+		steps = append(steps, "zero-padded")
+	}
+	return strings.Join(steps, ", ")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// reproducibleDate is the -reproducible header date when SOURCE_DATE_EPOCH
+// is not set
+var reproducibleDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// headerDate is the last-update date written to table headers; zero means
+// today
+var headerDate time.Time
+
+// setHeaderDate resolves -header-date and -reproducible. -reproducible
+// follows the reproducible builds convention and takes the date from
+// SOURCE_DATE_EPOCH (seconds since 1970, as UTC) when it is set.
+func setHeaderDate(spec string, reproducible bool) error {
+	switch {
+	case spec != "":
+		d, err := time.Parse("2006-01-02", spec)
+		if err != nil {
+			return fmt.Errorf("invalid header date '%s' (expected YYYY-MM-DD)", spec)
+		}
+		headerDate = d
+	case reproducible:
+		headerDate = reproducibleDate
+		if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+			sec, err := strconv.ParseInt(epoch, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid SOURCE_DATE_EPOCH '%s'", epoch)
+			}
+			headerDate = time.Unix(sec, 0).UTC()
+		}
+	default:
+		return nil
+	}
+	// The header stores the year as an offset from 1900 in one byte
+	if y := headerDate.Year(); y < 1900 || y > 1900+255 {
+		return fmt.Errorf("header date %s is out of range (1900-2155)", headerDate.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// lastUpdate returns the date for the last-update bytes (1-3) of a header
+func lastUpdate() time.Time {
+	if !headerDate.IsZero() {
+		return headerDate
+	}
+	return time.Now()
+}
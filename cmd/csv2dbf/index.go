@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tableFlagIndex is the header byte 28 flag of a table with a production
+// index: a .cdx (FoxPro) or .mdx (dBase IV) that is opened with the table
+const tableFlagIndex = 0x01
+
+// Index policies (-index)
+const (
+	indexKeep   = "keep"
+	indexClear  = "clear"
+	indexDelete = "delete"
+)
+
+// findIndexFile returns the .cdx/.mdx file next to a table, or ""
+func findIndexFile(dbfPath string) string {
+	base := strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath))
+	for _, ext := range []string{".cdx", ".CDX", ".mdx", ".MDX"} {
+		if st, err := os.Stat(base + ext); err == nil && !st.IsDir() {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// warnIndex reports a production index of a table that is rewritten
+// without updating it (-append, -shapefile)
+func warnIndex(dbfPath string, h DBFHeader) {
+	flagged := h.Reserved[28-12]&tableFlagIndex != 0
+	index := findIndexFile(dbfPath)
+	if !flagged && index == "" {
+		return
+	}
+	name := "a production index"
+	if index != "" {
+		name = filepath.Base(index)
+	}
+	switch flagIndex {
+	case indexKeep:
+		if flagged {
+			warnf("%s has %s that is not updated; FoxPro may report it as corrupt (see -index clear)", dbfPath, name)
+		} else {
+			warnf("%s has %s that is not updated and will not match the new records", dbfPath, name)
+		}
+	case indexClear, indexDelete:
+		fmt.Printf("  >> Index: flag cleared, %s no longer opened with %s\n", name, dbfPath)
+	}
+}
+
+// clearIndexFlag clears the production index flag of a written table,
+// unless -index keep
+func clearIndexFlag(f *os.File, h DBFHeader) error {
+	flags := h.Reserved[28-12]
+	if flagIndex == indexKeep || flags&tableFlagIndex == 0 {
+		return nil
+	}
+	if _, err := f.WriteAt([]byte{flags &^ tableFlagIndex}, 28); err != nil {
+		return fmt.Errorf("failed to update header: %w", err)
+	}
+	return nil
+}
+
+// dropIndex deletes the stale index file next to a table (-index delete)
+func dropIndex(dbfPath string) error {
+	if flagIndex != indexDelete {
+		return nil
+	}
+	index := findIndexFile(dbfPath)
+	if index == "" {
+		return nil
+	}
+	if err := os.Remove(index); err != nil {
+		return fmt.Errorf("failed to delete stale index: %w", err)
+	}
+	fmt.Printf("  >> Index: deleted %s, rebuild it in FoxPro (INDEX ON ... TAG)\n", index)
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// layoutColumn is one column of a -layout file: where its value sits in a
+// fixed-width line and, optionally, the DBF type it is stored as
+type layoutColumn struct {
+	name  string
+	start int  // 1-based byte position in the line
+	width int  // in bytes
+	typ   byte // C, N, D or L; 0 when not given (analyzed like a CSV column)
+	dec   int  // decimals of N columns
+}
+
+// layoutColumns is the loaded -layout; nil for CSV input
+var layoutColumns []layoutColumn
+
+// loadLayout reads a layout file with one column per line:
+//
+//	NAME START WIDTH [TYPE [DEC]]
+//
+// START counts bytes from 1, as in host record layouts. TYPE is C (text),
+// N (a number of WIDTH digits with DEC decimals), D (YYYYMMDD or
+// YYYY-MM-DD) or L; blank lines and lines starting with # are skipped.
+func loadLayout(path string) ([]layoutColumn, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout: %w", err)
+	}
+
+	var columns []layoutColumn
+	for n, line := range strings.Split(string(data), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 || strings.HasPrefix(parts[0], "#") {
+			continue
+		}
+		if len(parts) < 3 || len(parts) > 5 {
+			return nil, fmt.Errorf("layout line %d: expected NAME START WIDTH [TYPE [DEC]]", n+1)
+		}
+		c := layoutColumn{name: parts[0]}
+		c.start, err = strconv.Atoi(parts[1])
+		if err != nil || c.start < 1 {
+			return nil, fmt.Errorf("layout line %d: invalid start '%s'", n+1, parts[1])
+		}
+		c.width, err = strconv.Atoi(parts[2])
+		if err != nil || c.width < 1 {
+			return nil, fmt.Errorf("layout line %d: invalid width '%s'", n+1, parts[2])
+		}
+		if len(parts) > 3 {
+			typ := strings.ToUpper(parts[3])
+			if len(typ) != 1 || !strings.Contains("CNDL", typ) {
+				return nil, fmt.Errorf("layout line %d: invalid type '%s' (expected C, N, D or L)", n+1, parts[3])
+			}
+			c.typ = typ[0]
+		}
+		if len(parts) > 4 {
+			c.dec, err = strconv.Atoi(parts[4])
+			if err != nil || c.typ != 'N' || c.dec < 0 || c.dec > 15 || c.dec > 0 && c.dec > c.width-2 {
+				return nil, fmt.Errorf("layout line %d: invalid decimals '%s'", n+1, parts[4])
+			}
+		}
+		if c.typ == 'N' && c.width > 20 {
+			return nil, fmt.Errorf("layout line %d: N columns are at most 20 wide", n+1)
+		}
+		columns = append(columns, c)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("layout has no columns")
+	}
+	return columns, nil
+}
+
+// layoutNames returns the field names of the layout
+func layoutNames() []string {
+	names := make([]string, len(layoutColumns))
+	for i, c := range layoutColumns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// applyLayoutType gives a field the type of its layout column. N, D and L
+// fields get their final size here; C fields are still sized by analysis.
+func applyLayoutType(f *FieldInfo, c layoutColumn) {
+	switch c.typ {
+	case 'N':
+		f.Type, f.Length, f.Dec = 'N', c.width, c.dec
+	case 'D':
+		f.Type, f.Length = 'D', 8
+	case 'L':
+		f.Type, f.Length = 'L', 1
+	}
+}
+
+// recordReader reads the input one record at a time: CSV, or fixed-width
+// text with -layout
+type recordReader interface {
+	Read() ([]string, error)
+}
+
+// getRecordReader returns the reader for the input format
+func getRecordReader(f io.Reader, comma rune, quote rune) recordReader {
+	if layoutColumns != nil {
+		return newFixedWidthReader(f)
+	}
+	return getCSVReader(f, comma, quote)
+}
+
+// fixedWidthReader cuts lines of fixed-width text into the -layout
+// columns. Positions count bytes of the input encoding, so each cell is
+// decoded after cutting; trailing padding is trimmed and columns past the
+// end of a short line are empty.
+type fixedWidthReader struct {
+	br      *bufio.Reader
+	decoder *encoding.Decoder // nil for UTF-8 input
+	buf     []byte
+}
+
+func newFixedWidthReader(f io.Reader) *fixedWidthReader {
+	br := bufio.NewReader(throttleReader(f))
+	if name, _ := detectBOM(br); name == "UTF-8" {
+		br.Discard(3)
+	}
+	r := &fixedWidthReader{br: br}
+	if inputEncoding != unicode.UTF8 {
+		r.decoder = inputEncoding.NewDecoder()
+	}
+	return r
+}
+
+func (r *fixedWidthReader) Read() ([]string, error) {
+	for {
+		line, err := r.br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			r.buf = append(r.buf[:0], line...)
+			for err == bufio.ErrBufferFull {
+				line, err = r.br.ReadSlice('\n')
+				r.buf = append(r.buf, line...)
+			}
+			line = r.buf
+		}
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, err
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 || len(line) == 1 && line[0] == 0x1A {
+			continue // blank line, or a DOS end-of-file mark
+		}
+
+		record := make([]string, len(layoutColumns))
+		for i, c := range layoutColumns {
+			start := min(c.start-1, len(line))
+			cell := bytes.TrimRight(line[start:min(start+c.width, len(line))], " ")
+			if r.decoder != nil {
+				if decoded, err := r.decoder.Bytes(cell); err == nil {
+					cell = decoded
+				}
+			}
+			record[i] = string(cell)
+		}
+		return record, nil
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// tableTemplate is the -like table: its fields and the header area that
+// every new table starts with
+type tableTemplate struct {
+	path   string
+	header DBFHeader
+	fields []FieldInfo
+	raw    []byte // HeaderLen bytes: header, field descriptors, VFP backlink
+}
+
+// likeTemplate is the loaded -like template, nil without -like
+var likeTemplate *tableTemplate
+
+// loadTemplate reads the structure of an existing table for -like
+func loadTemplate(path string) (*tableTemplate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open template: %w", err)
+	}
+	defer f.Close()
+
+	t := &tableTemplate{path: path}
+	if t.header, t.fields, err = readTableFields(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(t.fields) == 0 {
+		return nil, fmt.Errorf("%s: template has no fields", path)
+	}
+	// Memos are written to a FoxPro .fpt file, which dBase tables don't use
+	switch t.header.Version {
+	case 0x30, 0x31, 0x32, 0xF5:
+	default:
+		if hasMemoFields(t.fields) {
+			return nil, fmt.Errorf("%s: memo fields of version 0x%02X tables (.dbt memo file) are not supported", path, t.header.Version)
+		}
+	}
+
+	t.raw = make([]byte, t.header.HeaderLen)
+	if _, err := f.ReadAt(t.raw, 0); err != nil {
+		return nil, fmt.Errorf("%s: failed to read header: %w", path, err)
+	}
+	// No index file is written, so the table must not claim a production one
+	t.raw[28] &^= 0x01
+	return t, nil
+}
+
+// writeHeader writes the template's header area with the last-update date
+// and the record count
+func (t *tableTemplate) writeHeader(w *bufio.Writer, numRecs uint32) error {
+	raw := append([]byte(nil), t.raw...)
+	now := lastUpdate()
+	raw[1], raw[2], raw[3] = byte(now.Year()-1900), byte(now.Month()), byte(now.Day())
+	binary.LittleEndian.PutUint32(raw[4:8], numRecs)
+	_, err := w.Write(raw)
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// logEvent is one line of -log json output
+type logEvent struct {
+	Time    string  `json:"time"`
+	Level   string  `json:"level"`
+	Event   string  `json:"event"` // start, stage, warning, done, skipped or failed
+	File    string  `json:"file,omitempty"`
+	Stage   string  `json:"stage,omitempty"`
+	Records uint32  `json:"records,omitempty"`
+	Elapsed float64 `json:"elapsed,omitempty"`
+	Message string  `json:"message,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// logJSON is set by -log json: the text output is replaced by log events
+// on stderr, one JSON object per line
+var logJSON bool
+
+// logFile is the file being converted, for the events that don't name it
+var logFile string
+
+// emitLog writes a -log json event
+func emitLog(ev logEvent) {
+	if !logJSON {
+		return
+	}
+	ev.Time = time.Now().Format(time.RFC3339Nano)
+	if ev.File == "" {
+		ev.File = logFile
+	}
+	line, _ := json.Marshal(ev)
+	fmt.Fprintf(os.Stderr, "%s\n", line)
+}
+
+// warnf prints a warning, or logs it with -log json
+func warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Printf("  Warning: %s\n", msg)
+	emitLog(logEvent{Level: "warn", Event: "warning", Message: msg})
+}
+
+// logFailure reports a conversion that failed, on stderr as text or as a
+// -log json event
+func logFailure(file string, elapsed time.Duration, err error) {
+	if logJSON {
+		emitLog(logEvent{Level: "error", Event: "failed", File: file, Elapsed: elapsed.Seconds(), Error: err.Error()})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Failed [%s]: %v\n", file, err)
+}
+
+// logNotFound reports an input file that does not exist
+func logNotFound(file string) {
+	if logJSON {
+		emitLog(logEvent{Level: "error", Event: "failed", File: file, Error: "file not found"})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error: File not found [%s]\n", file)
+}
+
+// logStage logs a finished stage of a conversion with -log json: structure
+// (analyzed, or read from a schema or table) or records, with how many
+// were written
+func logStage(stage string, start time.Time, records uint32) {
+	emitLog(logEvent{Level: "info", Event: "stage", Stage: stage, Records: records, Elapsed: time.Since(start).Seconds()})
+}
+
+// stopBatch reports the files -fail-fast left unconverted
+func stopBatch(remaining int) {
+	if remaining == 0 {
+		return
+	}
+	msg := fmt.Sprintf("%d files not converted after the first failure (-fail-fast)", remaining)
+	if logJSON {
+		emitLog(logEvent{Level: "error", Event: "stopped", Message: msg})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Stopped: %s\n", msg)
+}
@@ -2,14 +2,20 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unicode/utf8"
 
@@ -17,17 +23,77 @@ import (
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
+
+	"github.com/dabiaoge/csv2dbf/internal/cli"
+	"github.com/dabiaoge/csv2dbf/internal/serve"
 )
 
 // Global configuration variables
 var (
-	flagDelimiter string
-	flagQuote     string
-	flagNewline   string
-	flagEncoding  string
-	flagProgress  int // [New] Control progress reporting interval
+	flagDelimiter      string
+	flagQuote          string
+	flagNewline        string
+	flagEncoding       string
+	flagBufSize        string
+	flagProgress       int // [New] Control progress reporting interval
+	flagProgressFormat string
+	flagMetrics        string
+	flagTimeout        time.Duration
+	flagThrottle       string
+	flagSchema         string
+	flagAppend         string
+	flagUpsert         string
+	flagMerge          string
+	flagLike           string
+	flagShapefile      string
+	flagIndex          string
+	flagMaxErrors      int
+	flagStrict         bool
+	flagQuiet          bool
+	flagLog            string
+	flagFailFast       bool
+	flagHeaderDate     string
+	flagReproducible   bool
+	flagCPUProfile     string
+	flagMemProfile     string
+	flagLayout         string
+	flagDumpSchema     bool
+	flagTypedCSV       bool
+	flagRename         string
+	flagExplain        bool
+	flagBench          bool
+	flagOnlyNewer      bool
+	flagInputEncoding  string
+	flagOnEncodeError  string
+	flagOnTruncate     string
+	flagBoolFmt        string
+	flagNull           string
+	flagNoHeader       bool
+	flagNames          string
+	flagNameCase       string
+	flagNamesMap       bool
+	flagVFP            bool
+	flagClipper        bool
+	flagLong           string
+	flagCompress       string
+	flagWatch          string
+	flagServe          string
+	flagMaxUpload      string
+	flagWatchDebounce  time.Duration
 )
 
+// bufSize is the resolved -bufsize value in bytes (0 means auto)
+var bufSize int
+
+// maxUpload is the resolved -max-upload value in bytes
+var maxUpload int64
+
+// inputEncoding is the resolved CSV encoding (-ie, defaulting to -e)
+var inputEncoding encoding.Encoding
+
+// throttleRate is the resolved -throttle value in bytes per second (0 means unlimited)
+var throttleRate float64
+
 // Constants for program info
 const (
 	AppVersion = "1.7.0"
@@ -41,19 +107,22 @@ type DBFHeader struct {
 	Month     byte     // 2-2
 	Day       byte     // 3-3
 	NumRecs   uint32   // 4-7
-	HeaderLen uint16   // 8-9 (32 + 32*n + 1)
+	HeaderLen uint16   // 8-9 (32 + 32*n + 1, plus 263 for VFP)
 	RecLen    uint16   // 10-11
 	Reserved  [20]byte // 12-31
 }
 
 // DBFField represents the field descriptor structure (32 bytes)
 type DBFField struct {
-	Name      [11]byte // 0-10
-	Type      byte     // 11-11
-	Reserved  [4]byte  // 12-15
-	Len       byte     // 16-16
-	Dec       byte     // 17-17
-	Reserved2 [14]byte // 18-31
+	Name     [11]byte // 0-10
+	Type     byte     // 11-11
+	Offset   uint32   // 12-15 (VFP: position of the field in the record)
+	Len      byte     // 16-16
+	Dec      byte     // 17-17
+	Flags    byte     // 18-18 (VFP field flags)
+	AutoNext uint32   // 19-22 (VFP: next autoincrement value)
+	AutoStep byte     // 23-23 (VFP: autoincrement step)
+	Reserved [8]byte  // 24-31
 }
 
 // FieldInfo holds internal metadata for a column
@@ -62,6 +131,7 @@ type FieldInfo struct {
 	Type   byte
 	Length int
 	Dec    int
+	Opts   FieldOptions // per-field options from a schema file
 }
 
 func init() {
@@ -70,20 +140,72 @@ func init() {
 	flag.StringVar(&flagQuote, "q", "\"", "Quote character")
 	flag.StringVar(&flagNewline, "l", "\n", "Line ending (e.g. \"\\n\", \"\\r\\n\")")
 	flag.StringVar(&flagEncoding, "e", "UTF-8", "Encoding (UTF-8, GBK, GB18030)")
+	flag.StringVar(&flagInputEncoding, "ie", "", "CSV input encoding, if different from the DBF encoding (-e); also UTF-16, UTF-16LE, UTF-16BE. A byte order mark overrides it")
+	flag.StringVar(&flagOnEncodeError, "on-encode-error", encodeReplace, "Characters the DBF encoding cannot represent (e.g. emoji in GBK): replace (with '?'), translit (closest ASCII), skip (drop them), or fail (with the record and column)")
+	flag.IntVar(&flagMaxErrors, "max-errors", 0, "Abort the conversion, leaving no table, once N row-level problems (malformed lines, cut values, values that do not convert to their field type) have occurred (default 0, no limit)")
+	flag.BoolVar(&flagStrict, "strict", false, "Fail on the first anomaly, with its record and column: malformed lines and stray quotes, undecodable bytes, a wrong number of columns, values that are cut or do not convert to their field type, unrepresentable characters")
+	flag.StringVar(&flagOnTruncate, "on-truncate", truncateWarn, "Values longer than their field, or that an I, B, Y or T field can't hold: error (abort), warn (cut or leave blank, and report row and column), or silent (cut or leave blank); cuts never split a character")
 	flag.IntVar(&flagProgress, "c", 0, "Show progress every N rows (default 0, disable output)")
+	flag.StringVar(&flagHeaderDate, "header-date", "", "Last-update date written to the table header, YYYY-MM-DD (default today), so converting the same CSV gives the same bytes")
+	flag.BoolVar(&flagReproducible, "reproducible", false, "Byte-identical output for the same input: the header date is taken from SOURCE_DATE_EPOCH, or 2000-01-01 if it is not set")
+	flag.StringVar(&flagCPUProfile, "cpuprofile", "", "Write a CPU profile of the run to this file, for go tool pprof")
+	flag.StringVar(&flagMemProfile, "memprofile", "", "Write a heap profile at the end of the run to this file, for go tool pprof")
+	flag.BoolVar(&flagFailFast, "fail-fast", false, "Stop at the first file that fails to convert, leaving the rest; the exit code is then 1, or 3 if earlier files were converted")
+	flag.StringVar(&flagLog, "log", "text", "Log format: text, or json (start, stage, warning, done and failed events with level, file, record counts and errors, one JSON object per line on stderr, instead of the text output)")
+	flag.BoolVar(&flagQuiet, "quiet", false, "Print only errors (on stderr): no Processing/Done lines, statistics, progress or warnings, e.g. for cron jobs")
+	flag.StringVar(&flagThrottle, "throttle", "", "Limit read and write speed (e.g. 50MB/s; default no limit)")
+	flag.DurationVar(&flagTimeout, "timeout", 0, "Abort a file's conversion after this long (e.g. 30s, 10m; default 0, no limit)")
+	flag.StringVar(&flagMetrics, "metrics", "", "Serve conversion metrics on this address (e.g. :9100) at /metrics and /debug/vars")
+	flag.StringVar(&flagProgressFormat, "progress", "text", "Progress output format: text, or json (events on stderr)")
+	flag.StringVar(&flagBufSize, "bufsize", "auto", "I/O buffer size (e.g. 512K, 4MB); auto tunes it from the record length")
+	flag.StringVar(&flagSchema, "schema", "", "Load field structure from a schema file and skip the analysis pass")
+	flag.StringVar(&flagLike, "like", "", "Write the table with the exact structure of this existing DBF (version, fields, code page), skipping the analysis pass; the CSV columns must match its fields")
+	flag.StringVar(&flagShapefile, "shapefile", "", "Write the CSV back into the attribute table (.dbf) of this shapefile, keeping its structure: one record per shape in the same order, a trailing _DELETED column restores deletion flags, and the table is only replaced if the count matches the .shp")
+	flag.StringVar(&flagAppend, "append", "", "Append the CSV records to this existing DBF (and its .fpt memo file) instead of creating one; the CSV columns must match its fields")
+	flag.StringVar(&flagIndex, "index", indexKeep, "With -append or -shapefile, the table's production index (.cdx/.mdx), which is not updated: keep (the header flag, with a warning), clear (the flag, so the table opens without an index), or delete (clear, and delete the stale index file)")
+	flag.StringVar(&flagUpsert, "upsert", "", "With -append, the key field: CSV records whose key matches an existing record overwrite it in place, the others are appended")
+	flag.StringVar(&flagLayout, "layout", "", "Read fixed-width text instead of CSV, cut into columns by this layout file: one NAME START WIDTH [TYPE [DEC]] per line, START counting bytes from 1, TYPE C, N, D or L (implies -noheader)")
+	flag.StringVar(&flagMerge, "merge", "", "Merge all the CSV files, which must have the same columns, into this one DBF; fields are sized for the values of every file")
+	flag.BoolVar(&flagOnlyNewer, "only-newer", false, "Skip CSV files whose DBF already exists and is newer than the CSV (and -schema file)")
+	flag.BoolVar(&flagExplain, "explain", false, "Print the conversion plan (dialect, encoding, field mapping, output) and exit without converting")
+	flag.BoolVar(&flagBench, "bench", false, "Benchmark mode: convert to the null device without writing the DBF and report throughput, with rows/s and MB/s of the parse (reading the CSV) and encode (building records in the table encoding) stages")
+	flag.StringVar(&flagRename, "rename", "", "Rename columns: OLD1=NEW1,OLD2=NEW2, or a file with one OLD=NEW per line")
+	flag.StringVar(&flagNull, "null", "", "Treat this CSV token (e.g. \\N or NULL) as a null value and leave the field blank")
+	flag.StringVar(&flagBoolFmt, "boolfmt", "", "Logical values in the CSV: true/false, 1/0, Y/N, T/F or yes/no (all but 1/0 are always accepted)")
+	flag.BoolVar(&flagTypedCSV, "typed-csv", false, "Parse typed CSV: ISO dates, true/false and bare numbers become D, L and N fields (with -vfp, datetimes and integers become T and I)")
+	flag.BoolVar(&flagNoHeader, "noheader", false, "The CSV has no header row: the first row is data and fields are named COL1..COLn")
+	flag.StringVar(&flagNames, "names", "", "Field names for a CSV without header row, e.g. id,name,city (implies -noheader)")
+	flag.StringVar(&flagNameCase, "namecase", "upper", "Field name case: upper, lower, or preserve (as in the CSV header)")
+	flag.BoolVar(&flagNamesMap, "names-map", false, "Save the original column names to <name>.names.json; dbf2csv restores them as the header")
+	flag.BoolVar(&flagVFP, "vfp", false, "Write a Visual FoxPro (0x30) table; schema files may then use the binary types I, B, Y and T, and nullable and autoincrement fields")
+	flag.BoolVar(&flagClipper, "clipper", false, "Allow character fields longer than 254 bytes (up to 65535), stored the Clipper way with the length continued in Dec")
+	flag.StringVar(&flagLong, "long", "", "Columns longer than 254 bytes: truncate (with a warning), clipper (as -clipper), or memo (M field in a .fpt memo file); default truncate, or clipper with -clipper")
+	flag.StringVar(&flagWatch, "watch", "", "Watch this directory and convert CSV files as they are created or modified (until Ctrl+C)")
+	flag.StringVar(&flagServe, "serve", "", "Serve conversions over HTTP on this address (e.g. :8080): POST a CSV file to /convert and receive the DBF, or to /jobs to convert it in the background; query parameters set options, e.g. ?e=GBK&vfp=true")
+	flag.StringVar(&flagMaxUpload, "max-upload", "1GB", "With -serve, the largest request body accepted (e.g. 200MB); larger uploads are refused with 413 Request Entity Too Large")
+	flag.DurationVar(&flagWatchDebounce, "watch-debounce", 2*time.Second, "With -watch, wait until a file has been unchanged this long before converting it")
+	flag.StringVar(&flagCompress, "compress", "", "Compress the finished DBF and memo file: gzip (data.dbf.gz) or zstd (data.dbf.zst)")
+	flag.BoolVar(&flagDumpSchema, "dump-schema", false, "Save the analyzed field structure to <name>.schema.json")
 
 	// Custom usage message
 	flag.Usage = func() {
 		fmt.Printf("CSV2DBF Converter\n")
 		fmt.Printf("Version: %s\n", AppVersion)
 		fmt.Printf("Author : %s\n\n", AppAuthor)
-		fmt.Printf("Usage: %s [options] <csv_file1> [csv_file2] ...\n\n", os.Args[0])
+		fmt.Printf("Usage: %s [options] <csv_file1> [csv_file2] ...\n\nAlso accepts gzip-compressed CSV files (data.csv.gz), decompressed on the fly.\n\n", os.Args[0])
 		fmt.Println("Options:")
 		flag.PrintDefaults()
 		fmt.Println("\nExamples:")
 		fmt.Printf("  %s data.csv\n", os.Args[0])
 		fmt.Printf("  %s -e GBK -c 5000 data.csv\n", os.Args[0])
 		fmt.Printf("  %s -f '|' data.csv\n", os.Args[0])
+		fmt.Printf("  %s -schema data.schema.json data.csv\n", os.Args[0])
+		fmt.Printf("  %s -append orders.dbf new_orders.csv\n", os.Args[0])
+		fmt.Printf("  %s -append customers.dbf -upsert CUSTNO changes.csv\n", os.Args[0])
+		fmt.Printf("  %s -like legacy/customers.dbf customers.csv\n", os.Args[0])
+		fmt.Printf("  %s -shapefile roads.shp roads.csv\n", os.Args[0])
+		fmt.Printf("  %s -merge sales.dbf sales_jan.csv sales_feb.csv sales_mar.csv\n", os.Args[0])
+		fmt.Printf("  %s -layout orders.layout -e GBK orders.txt\n", os.Args[0])
 	}
 }
 
@@ -92,7 +214,7 @@ func main() {
 	args := flag.Args()
 
 	// Show help if no files provided
-	if len(args) < 1 {
+	if len(args) < 1 && flagWatch == "" && flagServe == "" {
 		flag.Usage()
 		os.Exit(0)
 	}
@@ -101,37 +223,415 @@ func main() {
 	delimiter := parseEscapedChar(flagDelimiter)
 	if delimiter == 0 {
 		fmt.Fprintf(os.Stderr, "Error: Invalid delimiter '%s'\n", flagDelimiter)
-		os.Exit(1)
+		os.Exit(cli.ExitUsage)
 	}
 
 	quote := parseEscapedChar(flagQuote)
 
+	flagProgressFormat = strings.ToLower(flagProgressFormat)
+	if flagProgressFormat != "text" && flagProgressFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Error: Invalid progress format '%s'\n", flagProgressFormat)
+		os.Exit(cli.ExitUsage)
+	}
+
 	// Determine encoding
-	enc := getEncoding(flagEncoding)
+	enc := getTargetEncoding(flagEncoding)
 	if enc == nil {
 		fmt.Fprintf(os.Stderr, "Error: Unsupported encoding '%s'\n", flagEncoding)
-		os.Exit(1)
+		os.Exit(cli.ExitUsage)
+	}
+	if flagInputEncoding == "" {
+		flagInputEncoding = flagEncoding
+	}
+	inputEncoding = getEncoding(flagInputEncoding)
+	if inputEncoding == nil {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported encoding '%s'\n", flagInputEncoding)
+		os.Exit(cli.ExitUsage)
 	}
 
-	for _, csvFile := range args {
-		if _, err := os.Stat(csvFile); os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "Error: File not found [%s]\n", csvFile)
-			continue
+	if flagNames != "" {
+		flagNoHeader = true
+	}
+
+	if flagLayout != "" {
+		if flagNames != "" {
+			fmt.Fprintln(os.Stderr, "Error: -names cannot be combined with -layout (the layout names the columns)")
+			os.Exit(cli.ExitUsage)
+		}
+		if ie := strings.ToLower(flagInputEncoding); strings.HasPrefix(ie, "utf-16") || strings.HasPrefix(ie, "utf16") {
+			fmt.Fprintln(os.Stderr, "Error: -layout cannot read UTF-16 input")
+			os.Exit(cli.ExitUsage)
+		}
+		columns, err := loadLayout(flagLayout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
+		}
+		layoutColumns = columns
+		flagNoHeader = true
+	}
+
+	flagNameCase = strings.ToLower(flagNameCase)
+	if flagNameCase != "upper" && flagNameCase != "lower" && flagNameCase != "preserve" {
+		fmt.Fprintf(os.Stderr, "Error: Invalid name case '%s'\n", flagNameCase)
+		os.Exit(cli.ExitUsage)
+	}
+
+	switch flagLong = strings.ToLower(flagLong); flagLong {
+	case "":
+		flagLong = longTruncate
+		if flagClipper {
+			flagLong = longClipper
+		}
+	case longClipper:
+		flagClipper = true
+	case longTruncate, longMemo:
+		if flagClipper {
+			fmt.Fprintf(os.Stderr, "Error: -clipper conflicts with -long %s\n", flagLong)
+			os.Exit(cli.ExitUsage)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid -long policy '%s'\n", flagLong)
+		os.Exit(cli.ExitUsage)
+	}
+
+	flagOnEncodeError = strings.ToLower(flagOnEncodeError)
+	switch flagOnEncodeError {
+	case encodeReplace, encodeTranslit, encodeSkip, encodeFail:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid -on-encode-error policy '%s'\n", flagOnEncodeError)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if flagWatchDebounce <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: Invalid watch debounce %s\n", flagWatchDebounce)
+		os.Exit(cli.ExitUsage)
+	}
+	if flagServe != "" && flagWatch != "" {
+		fmt.Fprintln(os.Stderr, "Error: -serve cannot be combined with -watch")
+		os.Exit(cli.ExitUsage)
+	}
+
+	flagCompress = strings.ToLower(flagCompress)
+	if _, ok := compressExts[flagCompress]; flagCompress != "" && !ok {
+		fmt.Fprintf(os.Stderr, "Error: Invalid compression '%s' (expected gzip or zstd)\n", flagCompress)
+		os.Exit(cli.ExitUsage)
+	}
+
+	flagOnTruncate = strings.ToLower(flagOnTruncate)
+	switch flagOnTruncate {
+	case truncateError, truncateWarn, truncateSilent:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid -on-truncate policy '%s'\n", flagOnTruncate)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if flagStrict {
+		// Every anomaly is an error: the lenient policies cannot apply
+		flag.Visit(func(f *flag.Flag) {
+			switch {
+			case f.Name == "on-truncate" && flagOnTruncate != truncateError,
+				f.Name == "on-encode-error" && flagOnEncodeError != encodeFail,
+				f.Name == "max-errors":
+				fmt.Fprintf(os.Stderr, "Error: -strict cannot be combined with -%s %s\n", f.Name, f.Value)
+				os.Exit(cli.ExitUsage)
+			}
+		})
+		flagOnTruncate = truncateError
+		flagOnEncodeError = encodeFail
+	}
+
+	if flagUpsert != "" && flagAppend == "" {
+		fmt.Fprintln(os.Stderr, "Error: -upsert needs -append")
+		os.Exit(cli.ExitUsage)
+	}
+	if flagAppend != "" {
+		// Options that create the output or decide its structure
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "schema", "dump-schema", "names-map", "vfp", "clipper", "long", "compress", "only-newer", "explain", "serve":
+				fmt.Fprintf(os.Stderr, "Error: -append cannot be combined with -%s\n", f.Name)
+				os.Exit(cli.ExitUsage)
+			}
+		})
+	}
+
+	if flagMaxErrors < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-errors must be 0 or more\n")
+		os.Exit(cli.ExitUsage)
+	}
+
+	flagIndex = strings.ToLower(flagIndex)
+	if flagIndex != indexKeep && flagIndex != indexClear && flagIndex != indexDelete {
+		fmt.Fprintf(os.Stderr, "Error: Invalid index policy '%s'\n", flagIndex)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if flagLike != "" {
+		// Options that decide the structure the template provides
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "schema", "layout", "append", "vfp", "clipper", "long":
+				fmt.Fprintf(os.Stderr, "Error: -like cannot be combined with -%s\n", f.Name)
+				os.Exit(cli.ExitUsage)
+			}
+		})
+		t, err := loadTemplate(flagLike)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
 		}
+		likeTemplate = t
+	}
+	if flagShapefile != "" {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "like", "schema", "layout", "append", "merge", "vfp", "clipper", "long", "compress", "dump-schema", "names-map", "only-newer", "watch", "serve":
+				fmt.Fprintf(os.Stderr, "Error: -shapefile cannot be combined with -%s\n", f.Name)
+				os.Exit(cli.ExitUsage)
+			}
+		})
+		if flag.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "Error: -shapefile takes exactly one CSV file\n")
+			os.Exit(cli.ExitUsage)
+		}
+		t, err := openShapefile(flagShapefile)
+		if err == nil {
+			likeTemplate, err = loadTemplate(t.dbf)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
+		}
+		if flagIndex == indexKeep {
+			// The table is replaced in place, so it keeps its index flag
+			likeTemplate.raw[28] = likeTemplate.header.Reserved[28-12]
+		}
+		shapeTarget = t
+	}
+	if flagMerge != "" {
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "append", "watch", "serve":
+				fmt.Fprintf(os.Stderr, "Error: -merge cannot be combined with -%s\n", f.Name)
+				os.Exit(cli.ExitUsage)
+			}
+		})
+	}
+	if flagBench {
+		// Options that modify existing files or write files besides the table
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "append", "shapefile", "compress", "dump-schema", "names-map", "only-newer", "explain", "watch", "serve":
+				fmt.Fprintf(os.Stderr, "Error: -bench cannot be combined with -%s\n", f.Name)
+				os.Exit(cli.ExitUsage)
+			}
+		})
+	}
+
+	// Resolve buffer size ("auto" tunes per file from the record length)
+	if !strings.EqualFold(flagBufSize, "auto") {
+		n, err := parseSize(flagBufSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid buffer size '%s'\n", flagBufSize)
+			os.Exit(cli.ExitUsage)
+		}
+		bufSize = int(n)
+	}
 
-		fmt.Printf("Processing: %s\n", csvFile)
-		startTime := time.Now()
+	if n, err := parseSize(flagMaxUpload); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid upload limit '%s'\n", flagMaxUpload)
+		os.Exit(cli.ExitUsage)
+	} else {
+		maxUpload = n
+	}
 
-		err := convertCSVtoDBF(csvFile, delimiter, quote, enc)
+	if flagThrottle != "" {
+		rate, err := parseRate(flagThrottle)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed [%s]: %v\n", csvFile, err)
+			fmt.Fprintf(os.Stderr, "Error: Invalid throttle rate '%s'\n", flagThrottle)
+			os.Exit(cli.ExitUsage)
+		}
+		throttleRate = rate
+	}
+
+	if flagBoolFmt != "" {
+		if err := checkBoolFormat(flagBoolFmt); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
+		}
+	}
+
+	if flagRename != "" {
+		renames, err := parseRenames(flagRename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
+		}
+		fieldRenames = renames
+	}
+
+	switch strings.ToLower(flagLog) {
+	case "text":
+	case "json":
+		logJSON = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid log format '%s' (text or json)\n", flagLog)
+		os.Exit(cli.ExitUsage)
+	}
+	if flagQuiet && (flagExplain || flagBench) {
+		fmt.Fprintln(os.Stderr, "Error: -quiet cannot be combined with -explain or -bench")
+		os.Exit(cli.ExitUsage)
+	}
+	if logJSON && (flagExplain || flagBench) {
+		fmt.Fprintln(os.Stderr, "Error: -log json cannot be combined with -explain or -bench")
+		os.Exit(cli.ExitUsage)
+	}
+	if flagMetrics != "" {
+		serve.Metrics(flagMetrics, warnf)
+	}
+	if flagQuiet || logJSON {
+		cli.SilenceOutput()
+	}
+
+	if err := setHeaderDate(flagHeaderDate, flagReproducible); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cli.ExitUsage)
+	}
+	if flagFailFast && (flagWatch != "" || flagServe != "") {
+		fmt.Fprintln(os.Stderr, "Error: -fail-fast cannot be combined with -watch or -serve")
+		os.Exit(cli.ExitUsage)
+	}
+	if err := cli.StartProfiles(flagCPUProfile, flagMemProfile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cli.ExitUsage)
+	}
+
+	// Stop cleanly on Ctrl+C / SIGTERM instead of leaving a half-written DBF
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	convert := func(csvFile string) error {
+		return convertFile(ctx, csvFile, delimiter, quote, enc)
+	}
+	var batch cli.Batch
+	if flagMerge != "" {
+		batch.Add(mergeFiles(ctx, args, delimiter, quote, enc))
+	} else if shapeTarget != nil {
+		batch.Add(writeShapefile(ctx, args[0], delimiter, quote, enc))
+	} else {
+		for i, csvFile := range args {
+			if ctx.Err() != nil {
+				break
+			}
+			err := convert(csvFile)
+			batch.Add(err)
+			if err != nil && flagFailFast {
+				stopBatch(len(args) - i - 1)
+				break
+			}
+		}
+	}
+	if flagWatch != "" && ctx.Err() == nil {
+		if err := watchDir(ctx, flagWatch, convert); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cli.Exit(cli.ExitFailed)
+		}
+	}
+	if flagServe != "" && ctx.Err() == nil {
+		if err := serveConversions(ctx, flagServe); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cli.Exit(cli.ExitFailed)
+		}
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		cli.Exit(cli.ExitInterrupted)
+	}
+	cli.Exit(batch.ExitCode())
+}
+
+// convertFile converts one CSV file, reporting progress and failures on the
+// console; the error is returned for -watch, which only records successes
+func convertFile(ctx context.Context, csvFile string, delimiter rune, quote rune, enc encoding.Encoding) error {
+	if _, err := os.Stat(csvFile); os.IsNotExist(err) {
+		logNotFound(csvFile)
+		return err
+	}
+
+	if flagOnlyNewer && upToDate(dbfPathFor(csvFile)+compressExts[flagCompress], csvFile, flagSchema, flagLike) {
+		fmt.Printf("Skipped: %s (up to date)\n", csvFile)
+		emitLog(logEvent{Level: "info", Event: "skipped", File: csvFile, Message: "up to date"})
+		return nil
+	}
+
+	fmt.Printf("Processing: %s\n", csvFile)
+	logFile = csvFile
+	defer func() { logFile = "" }()
+	emitLog(logEvent{Level: "info", Event: "start"})
+	startTime := time.Now()
+
+	err := convertWithTimeout(ctx, csvFile, func(ctx context.Context) error {
+		if flagAppend != "" {
+			return appendCSVtoDBF(ctx, csvFile, delimiter, quote, enc)
+		}
+		return convertCSVtoDBF(ctx, []string{csvFile}, dbfPathFor(csvFile), delimiter, quote, enc)
+	})
+	elapsed := time.Since(startTime)
+	serve.RecordConversion(err, elapsed)
+	if err != nil {
+		logFailure(csvFile, elapsed, err)
+		return err
+	}
+
+	// [Refactor] Changed time format to seconds with 3 decimal places
+	fmt.Printf("Done: %s (Time: %.3fs)\n", csvFile, elapsed.Seconds())
+	emitLog(logEvent{Level: "info", Event: "done", Elapsed: elapsed.Seconds()})
+	return nil
+}
+
+// dbfPathFor returns the DBF written for a CSV file
+func dbfPathFor(csvPath string) string {
+	if isGzip(csvPath) {
+		csvPath = strings.TrimSuffix(csvPath, filepath.Ext(csvPath))
+	}
+	return strings.TrimSuffix(csvPath, filepath.Ext(csvPath)) + ".dbf"
+}
+
+// upToDate reports whether output exists and is newer than every input, so
+// -only-newer can skip it (make-style). Inputs that don't exist are ignored.
+func upToDate(output string, inputs ...string) bool {
+	out, err := os.Stat(output)
+	if err != nil {
+		return false
+	}
+	for _, in := range inputs {
+		if in == "" {
 			continue
 		}
+		st, err := os.Stat(in)
+		if err == nil && !out.ModTime().After(st.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
 
-		elapsed := time.Since(startTime)
-		// [Refactor] Changed time format to seconds with 3 decimal places
-		fmt.Printf("Done: %s (Time: %.3fs)\n", csvFile, elapsed.Seconds())
+// convertWithTimeout runs one file's conversion, bounded by -timeout
+func convertWithTimeout(ctx context.Context, path string, convert func(context.Context) error) error {
+	if flagTimeout <= 0 {
+		return convert(ctx)
 	}
+
+	ctx, cancel := context.WithTimeout(ctx, flagTimeout)
+	defer cancel()
+
+	err := convert(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", flagTimeout, err)
+	}
+	return err
 }
 
 func parseEscapedChar(s string) rune {
@@ -163,134 +663,447 @@ func parseEscapedChar(s string) rune {
 	return r
 }
 
+// parseSize parses a byte size such as "65536", "512K" or "4MB"
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// bufferSize returns the I/O buffer size used for records of recLen bytes.
+// An explicit -bufsize wins; otherwise about 2048 records are batched per
+// flush, clamped to [256KB, 16MB], so tiny and huge records both stay efficient.
+func bufferSize(recLen int) int {
+	if bufSize > 0 {
+		return bufSize
+	}
+	size := recLen * 2048
+	if size < 256*1024 {
+		size = 256 * 1024
+	}
+	if size > 16*1024*1024 {
+		size = 16 * 1024 * 1024
+	}
+	return size
+}
+
 func getEncoding(name string) encoding.Encoding {
 	name = strings.ToLower(strings.TrimSpace(name))
 	switch name {
 	case "utf-8", "utf8":
 		return unicode.UTF8
-	case "gbk", "gb2312", "gb18030":
+	case "gbk", "gb2312", "cp936", "gb18030":
 		return simplifiedchinese.GB18030
+	case "utf-16", "utf16":
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case "utf-16le", "utf16le":
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case "utf-16be", "utf16be":
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
 	default:
 		return nil
 	}
 }
 
-func convertCSVtoDBF(csvPath string, comma rune, quote rune, enc encoding.Encoding) error {
-	// --- Pass 1: Analyze Structure ---
-	fmt.Println("  [1/2] Analyzing field structure...")
-	fields, recordCount, err := analyzeCSV(csvPath, comma, quote, enc)
-	if err != nil {
-		return err
+// getTargetEncoding returns the encoding DBF text is written in. Unlike
+// reading, where GB18030 safely decodes any GBK data, GBK tables must not
+// receive GB18030-only byte sequences that FoxPro cannot read.
+func getTargetEncoding(name string) encoding.Encoding {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "gbk", "gb2312", "cp936":
+		return simplifiedchinese.GBK
+	case "utf-16", "utf16", "utf-16le", "utf16le", "utf-16be", "utf16be":
+		return nil // only CSV input (-ie) can be UTF-16
+	}
+	return getEncoding(name)
+}
+
+// convertCSVtoDBF writes the records of the CSV files, usually one, to a
+// new table at dbfPath
+func convertCSVtoDBF(ctx context.Context, csvPaths []string, dbfPath string, comma rune, quote rune, enc encoding.Encoding) (err error) {
+	var fields []FieldInfo
+	var recordCount uint32
+	stageStart := time.Now()
+	bench := startBench()
+
+	if flagSchema != "" {
+		// --- Pass 1: Load Structure (analysis skipped) ---
+		fmt.Println("  [1/2] Loading schema...")
+		fields, err = loadSchema(flagSchema)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  >> Fields: %d (from %s)\n", len(fields), flagSchema)
+	} else if likeTemplate != nil {
+		// --- Pass 1: Copy Structure (analysis skipped) ---
+		fmt.Println("  [1/2] Reading template structure...")
+		fields = append([]FieldInfo(nil), likeTemplate.fields...)
+		fmt.Printf("  >> Fields: %d (like %s, version 0x%02X)\n", len(fields), likeTemplate.path, likeTemplate.header.Version)
+		if ldid := likeTemplate.header.Reserved[29-12]; ldid != 0 && vfpCodePage(enc) != 0 && ldid != vfpCodePage(enc) {
+			warnf("the template declares another code page than %s", strings.ToUpper(flagEncoding))
+		}
+		for _, csvPath := range csvPaths {
+			if err := checkAppendColumns(csvPath, comma, quote, fields); err != nil {
+				return fmt.Errorf("CSV does not match %s: %w", likeTemplate.path, err)
+			}
+		}
+	} else {
+		// --- Pass 1: Analyze Structure ---
+		fmt.Println("  [1/2] Analyzing field structure...")
+		fields, recordCount, err = analyzeCSV(ctx, csvPaths, comma, quote, enc)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  >> Fields: %d, Records: %d\n", len(fields), recordCount)
 	}
-	fmt.Printf("  >> Fields: %d, Records: %d\n", len(fields), recordCount)
 
 	if len(fields) == 0 {
 		return fmt.Errorf("no fields found in CSV")
 	}
+	logStage("structure", stageStart, recordCount)
 
-	// --- Prepare DBF File ---
-	dbfPath := strings.TrimSuffix(csvPath, filepath.Ext(csvPath)) + ".dbf"
-	dbfFile, err := os.Create(dbfPath)
-	if err != nil {
-		return fmt.Errorf("failed to create DBF: %w", err)
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.Name
+	}
+
+	if likeTemplate == nil {
+		renameFields(fields)
+
+		// Make sure every name opens in FoxPro without "invalid field name"
+		normalizeFieldNames(fields)
+	}
+
+	if flagProgressFormat == "json" {
+		emitSchema(strings.Join(csvPaths, ","), dbfPath, columns, fields, recordCount)
 	}
-	defer dbfFile.Close()
 
-	writer := bufio.NewWriterSize(dbfFile, 4*1024*1024)
+	if flagExplain {
+		explainConversion(csvPaths, dbfPath, columns, fields, recordCount, comma)
+		return nil
+	}
+
+	if flagDumpSchema && flagSchema == "" {
+		schemaPath := schemaPathFor(dbfPath)
+		if err := saveSchema(schemaPath, fields); err != nil {
+			return fmt.Errorf("failed to save schema: %w", err)
+		}
+		fmt.Printf("  >> Schema saved: %s\n", schemaPath)
+	}
+	if flagNamesMap {
+		namesPath := namesPathFor(dbfPath)
+		if err := saveNameMap(namesPath, columns, fields); err != nil {
+			return fmt.Errorf("failed to save names: %w", err)
+		}
+		fmt.Printf("  >> Names saved: %s\n", namesPath)
+	}
 
-	// --- Write Header ---
-	if err := writeDBFHeader(writer, fields, recordCount, enc); err != nil {
+	// --- Prepare DBF File ---
+	out, err := createOutput(dbfPath, fields, recordCount, enc)
+	if err != nil {
 		return err
 	}
 
+	// Never leave a partial DBF behind on failure or interruption
+	defer func() {
+		if err != nil {
+			out.remove()
+		}
+	}()
+
 	// --- Pass 2: Write Data ---
 	fmt.Println("  [2/2] Writing records...")
-	if err := writeDBFRecords(csvPath, writer, fields, recordCount, comma, quote, enc); err != nil {
+	stageStart = time.Now()
+	var written uint32
+	total := recordCount
+	if len(csvPaths) > 1 {
+		total = 0 // progress is reported per file
+	}
+	for _, csvPath := range csvPaths {
+		if len(csvPaths) > 1 {
+			fmt.Printf("  >> %s\n", csvPath)
+		}
+		n, err := writeDBFRecords(ctx, csvPath, out, nil, fields, total, comma, quote, enc)
+		if err != nil {
+			if len(csvPaths) > 1 {
+				return fmt.Errorf("%s: %w", csvPath, err)
+			}
+			return err
+		}
+		written += n
+	}
+	if shapeTarget != nil {
+		if err := shapeTarget.checkCount(out.written + out.count); err != nil {
+			return err
+		}
+	}
+	if err := out.finishPart(); err != nil {
 		return err
 	}
+	logStage("records", stageStart, written)
+	if flagBench {
+		recLen := 1 + nullFlagsLen(fields)
+		for _, f := range fields {
+			recLen += f.Length
+		}
+		bench.report(written, int64(written)*int64(recLen))
+		return nil
+	}
+	if out.part > 1 {
+		fmt.Printf("  >> Split at the 2GB limit: %d parts (%s ... %s)\n", out.part, dbfPath, out.partPath(out.part))
+	}
 
-	// Write EOF marker
-	if err := writer.WriteByte(0x1A); err != nil {
-		return err
+	if flagCompress != "" {
+		for _, path := range out.paths {
+			if err := compressFile(path); err != nil {
+				return fmt.Errorf("failed to compress %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// patchRecordCount rewrites NumRecs (bytes 4-7) of an already written header
+func patchRecordCount(f *os.File, numRecs uint32) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], numRecs)
+	if _, err := f.WriteAt(buf[:], 4); err != nil {
+		return fmt.Errorf("failed to update record count: %w", err)
 	}
+	return nil
+}
 
-	return writer.Flush()
+// inputFailed reports whether err from the CSV reader is a failure to read
+// the input itself, such as a truncated .gz, rather than a malformed line
+func inputFailed(err error) bool {
+	var perr *csv.ParseError
+	return err != nil && err != io.EOF && !errors.As(err, &perr)
 }
 
 // getCSVReader creates a standard CSV reader
-func getCSVReader(f *os.File, comma rune, quote rune, enc encoding.Encoding) *csv.Reader {
-	// 1. Create a transforming reader that decodes input to UTF-8
-	decoder := enc.NewDecoder()
-	reader := transform.NewReader(f, decoder)
+func getCSVReader(f io.Reader, comma rune, quote rune) *csv.Reader {
+	// 1. Create a transforming reader that decodes input to UTF-8,
+	// in the encoding named by the byte order mark if there is one
+	br := bufio.NewReader(throttleReader(f))
+	decoder := inputEncoding.NewDecoder()
+	if _, enc := detectBOM(br); enc != nil {
+		decoder = enc.NewDecoder()
+	}
+	reader := bufio.NewReader(transform.NewReader(br, decoder))
+	skipSepLine(reader)
 
 	// 2. Create CSV reader
 	csvReader := csv.NewReader(reader)
 	csvReader.Comma = comma
 
 	csvReader.FieldsPerRecord = -1
-	csvReader.LazyQuotes = true
+	csvReader.LazyQuotes = !flagStrict
 	csvReader.TrimLeadingSpace = false
 	return csvReader
 }
 
-func analyzeCSV(filename string, comma rune, quote rune, enc encoding.Encoding) ([]FieldInfo, uint32, error) {
-	f, err := os.Open(filename)
+// skipSepLine drops the "sep=;" hint line Excel writes and reads at the
+// start of a CSV. The delimiter itself still comes from -f.
+func skipSepLine(br *bufio.Reader) {
+	head, _ := br.Peek(16)
+	if len(head) < 5 || !strings.EqualFold(string(head[:4]), "sep=") {
+		return
+	}
+	_, size := utf8.DecodeRune(head[4:])
+	n := 4 + size
+	switch rest := head[n:]; {
+	case bytes.HasPrefix(rest, []byte("\r\n")):
+		n += 2
+	case bytes.HasPrefix(rest, []byte("\n")), bytes.HasPrefix(rest, []byte("\r")):
+		n++
+	case len(rest) > 0:
+		return // a header that merely starts with "sep="
+	}
+	br.Discard(n)
+}
+
+// analyzeCSV reads the CSV files (several with -merge, which must all have
+// the same columns) and sizes every field for its longest value in any of
+// them; with -typed-csv a column's type must fit the values of all files
+func analyzeCSV(ctx context.Context, filenames []string, comma rune, quote rune, enc encoding.Encoding) ([]FieldInfo, uint32, error) {
+	a := &csvAnalysis{encoder: enc.NewEncoder()}
+	for _, filename := range filenames {
+		if err := a.read(ctx, filename, comma, quote); err != nil {
+			if len(filenames) > 1 {
+				return nil, 0, fmt.Errorf("%s: %w", filename, err)
+			}
+			return nil, 0, err
+		}
+	}
+	fields := a.fields
+
+	for i := range a.kinds {
+		a.kinds[i].apply(&fields[i])
+	}
+
+	for i := range fields {
+		limit := maxFieldLen(fields[i].Type)
+		switch {
+		case fields[i].Length <= limit:
+		case fields[i].Type == 'C' && flagLong == longMemo:
+			fields[i].Type = 'M'
+			fields[i].Length = memoFieldLen()
+		default:
+			warnf("column '%s' has values up to %d bytes, truncated to %d (see -long)", fields[i].Name, fields[i].Length, limit)
+			fields[i].Length = limit
+		}
+	}
+
+	return fields, a.count, nil
+}
+
+// csvAnalysis is the structure found so far by analyzeCSV
+type csvAnalysis struct {
+	headers []string // header row of the first file
+	fields  []FieldInfo
+	kinds   []columnKind
+	encoder *encoding.Encoder
+	scratch []byte
+	count   uint32
+}
+
+// read adds the values of one CSV file to the analysis
+func (a *csvAnalysis) read(ctx context.Context, filename string, comma rune, quote rune) error {
+	f, err := openCSV(filename)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 	defer f.Close()
 
-	r := getCSVReader(f, comma, quote, enc)
+	r := getRecordReader(f, comma, quote)
 
 	headers, err := r.Read()
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to read header: %v", err)
+		return fmt.Errorf("failed to read header: %v", err)
 	}
 
-	fields := make([]FieldInfo, len(headers))
-	for i, name := range headers {
-		fields[i] = FieldInfo{
-			Name:   strings.ToUpper(strings.TrimSpace(name)),
-			Type:   'C',
-			Length: 1,
-			Dec:    0,
-		}
+	// Without a header row the first row is data, analyzed with the rest
+	var pending []string
+	if flagNoHeader {
+		pending = headers
+		headers = columnNames(len(pending))
 	}
 
-	encoder := enc.NewEncoder()
-	var count uint32
+	if a.fields != nil {
+		if err := sameColumns(a.headers, headers); err != nil {
+			return err
+		}
+	} else {
+		a.headers = headers
+		a.fields = make([]FieldInfo, len(headers))
+		for i, name := range headers {
+			a.fields[i] = FieldInfo{
+				Name:   strings.TrimSpace(name),
+				Type:   'C',
+				Length: 1,
+				Dec:    0,
+			}
+			if layoutColumns != nil {
+				applyLayoutType(&a.fields[i], layoutColumns[i])
+			}
+		}
+		if flagTypedCSV {
+			a.kinds = newColumnKinds(len(a.fields))
+		}
+	}
+	fields, kinds := a.fields, a.kinds
 
 	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
+		if a.count%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("analysis stopped at record %d: %w", a.count+1, err)
+			}
 		}
-		if err != nil {
-			fmt.Printf("    Warning: skipping malformed line at record %d: %v\n", count+1, err)
-			continue
+
+		record := pending
+		pending = nil
+		if record == nil {
+			record, err = r.Read()
+			if err == io.EOF {
+				break
+			}
+			if inputFailed(err) {
+				return fmt.Errorf("failed to read CSV at record %d: %w", a.count+1, err)
+			}
+			if err != nil && flagStrict {
+				return fmt.Errorf("malformed line at record %d: %w (-strict)", a.count+1, err)
+			}
+			if err != nil {
+				warnf("skipping malformed line at record %d: %v", a.count+1, err)
+				continue
+			}
 		}
 
 		for i, val := range record {
 			if i >= len(fields) {
 				break
 			}
+			if flagNull != "" && val == flagNull {
+				continue
+			}
+			if layoutColumns != nil && layoutColumns[i].typ != 0 && layoutColumns[i].typ != 'C' {
+				continue // sized by the layout
+			}
 			// DBF length is byte length in target encoding
-			encodedVal, _, _ := transform.Bytes(encoder, []byte(val))
-			l := len(encodedVal)
+			a.scratch, _ = appendEncoded(a.scratch[:0], val, a.encoder)
+			l := len(a.scratch)
 			if l > fields[i].Length {
 				fields[i].Length = l
 			}
+			if kinds != nil && (layoutColumns == nil || layoutColumns[i].typ == 0) {
+				kinds[i].observe(val)
+			}
 		}
-		count++
+		a.count++
 	}
+	return nil
+}
 
-	for i := range fields {
-		if fields[i].Length > 254 {
-			fields[i].Length = 254
+// columnNames names the n columns of a CSV without header row: the -names
+// list first, then COL<i> for any column it does not cover. Fixed-width
+// columns are named by the layout.
+func columnNames(n int) []string {
+	if layoutColumns != nil {
+		return layoutNames()
+	}
+	var names []string
+	if flagNames != "" {
+		names = strings.Split(flagNames, ",")
+		if len(names) != n {
+			warnf("-names lists %d names for %d columns", len(names), n)
 		}
 	}
 
-	return fields, count, nil
+	cols := make([]string, n)
+	for i := range cols {
+		if i < len(names) && strings.TrimSpace(names[i]) != "" {
+			cols[i] = names[i]
+		} else {
+			cols[i] = fmt.Sprintf("COL%d", i+1)
+		}
+	}
+	return cols
 }
 
 func safeTruncateName(name string, enc encoding.Encoding) [11]byte {
@@ -305,12 +1118,26 @@ func safeTruncateName(name string, enc encoding.Encoding) [11]byte {
 	return res
 }
 
+// maxFieldLen is the longest field of type typ: 254 bytes, except for
+// Clipper long character fields
+func maxFieldLen(typ byte) int {
+	if flagClipper && typ == 'C' {
+		return 65535
+	}
+	return 254
+}
+
 func writeDBFHeader(w *bufio.Writer, fields []FieldInfo, numRecs uint32, enc encoding.Encoding) error {
-	now := time.Now()
-	recLen := uint16(1)
+	now := lastUpdate()
+	nullFlags := nullFlagsLen(fields)
+	total := 1 + nullFlags
 	for _, f := range fields {
-		recLen += uint16(f.Length)
+		total += f.Length
+	}
+	if total > 65535 {
+		return fmt.Errorf("record length %d exceeds the DBF limit of 65535 bytes", total)
 	}
+	recLen := uint16(total)
 
 	h := DBFHeader{
 		Version:   0x03,
@@ -321,92 +1148,311 @@ func writeDBFHeader(w *bufio.Writer, fields []FieldInfo, numRecs uint32, enc enc
 		HeaderLen: uint16(32 + 32*len(fields) + 1),
 		RecLen:    recLen,
 	}
+	if flagVFP {
+		h.Version = 0x30
+		if hasAutoIncFields(fields) {
+			h.Version = 0x31
+		}
+		h.HeaderLen += vfpBacklinkSize
+		h.Reserved[29-12] = vfpCodePage(enc)
+		if hasMemoFields(fields) {
+			h.Reserved[28-12] |= 0x02 // table has a memo file
+		}
+	} else if hasMemoFields(fields) {
+		h.Version = 0xF5 // FoxPro 2.x with .fpt memo
+	}
+	if nullFlags > 0 {
+		h.HeaderLen += 32
+	}
 
 	if err := binary.Write(w, binary.LittleEndian, &h); err != nil {
 		return err
 	}
 
+	offset := 1
 	for _, f := range fields {
 		df := DBFField{
 			Name: safeTruncateName(f.Name, enc),
 			Type: f.Type,
 			Len:  byte(f.Length),
-			Dec:  0,
+			Dec:  byte(f.Dec),
+		}
+		if f.Length > 255 {
+			// Clipper long character field: the length continues in Dec
+			df.Dec = byte(f.Length >> 8)
+		}
+		if flagVFP {
+			df.Offset = uint32(offset)
+			if f.Opts.Nullable {
+				df.Flags |= fieldFlagNullable
+			}
+			if f.Opts.AutoInc {
+				df.Flags |= fieldFlagAutoInc
+				df.AutoNext, df.AutoStep = uint32(int32(f.Opts.Next)), byte(f.Opts.Step)
+			}
 		}
 		if err := binary.Write(w, binary.LittleEndian, &df); err != nil {
 			return err
 		}
+		offset += f.Length
 	}
 
-	return w.WriteByte(0x0D)
+	// Hidden system field with the null bits, in field order
+	if nullFlags > 0 {
+		df := DBFField{Type: '0', Offset: uint32(offset), Len: byte(nullFlags), Flags: fieldFlagSystem | fieldFlagBinary}
+		copy(df.Name[:], "_NullFlags")
+		if err := binary.Write(w, binary.LittleEndian, &df); err != nil {
+			return err
+		}
+	}
+
+	if err := w.WriteByte(0x0D); err != nil {
+		return err
+	}
+	if flagVFP {
+		_, err := w.Write(make([]byte, vfpBacklinkSize))
+		return err
+	}
+	return nil
 }
 
-func writeDBFRecords(csvPath string, w *bufio.Writer, fields []FieldInfo, total uint32, comma rune, quote rune, enc encoding.Encoding) error {
-	f, err := os.Open(csvPath)
+// writeDBFRecords converts the CSV records and writes them to out; with keys
+// (-upsert) records matching an existing key overwrite it instead
+func writeDBFRecords(ctx context.Context, csvPath string, out *dbfOutput, keys *keyIndex, fields []FieldInfo, total uint32, comma rune, quote rune, enc encoding.Encoding) (uint32, error) {
+	f, err := openCSV(csvPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer f.Close()
 
-	r := getCSVReader(f, comma, quote, enc)
-	if _, err := r.Read(); err != nil {
-		return err
+	r := getRecordReader(benchInput(f), comma, quote)
+	if !flagNoHeader {
+		if _, err := r.Read(); err != nil {
+			return 0, err
+		}
 	}
 
 	encoder := enc.NewEncoder()
+	var scratch []byte
 
 	recordSize := 1
 	for _, f := range fields {
 		recordSize += f.Length
 	}
+	nullFlags := recordSize
+	recordSize += nullFlagsLen(fields)
 	recordBuf := make([]byte, recordSize)
 
+	progress := newProgress(csvPath, total)
 	var processed uint32
+	var unmappableCells, truncatedCells, blankedCells int
+	var problems rowProblems
+	mark := time.Now()
 
 	for {
+		if processed%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return processed, fmt.Errorf("stopped after %d records: %w", processed, err)
+			}
+		}
+
 		record, err := r.Read()
+		lap(&benchStages.parse, &mark)
 		if err == io.EOF {
 			break
 		}
+		if inputFailed(err) {
+			return processed, fmt.Errorf("failed to read CSV at record %d: %w", processed+1, err)
+		}
 		if err != nil {
+			// A skipped line would pair every later record with the wrong shape
+			if shapeTarget != nil {
+				return processed, fmt.Errorf("malformed line at record %d: %w", processed+1, err)
+			}
+			if err := problems.add(processed+1, "malformed line: %v", err); err != nil {
+				return processed, err
+			}
 			continue
 		}
+		if flagStrict {
+			if err := checkStrict(processed+1, record, fields); err != nil {
+				return processed, err
+			}
+		}
+		if err := out.reserve(); err != nil {
+			return processed, err
+		}
 
 		fillSpace(recordBuf)
 		recordBuf[0] = ' ' // Not deleted
+		if shapeTarget != nil && shapeTarget.deletedColumn && len(record) > len(fields) {
+			if deleted, _ := parseLogical(strings.TrimSpace(record[len(fields)])); deleted {
+				recordBuf[0] = '*'
+			}
+		}
+		clear(recordBuf[nullFlags:])
 
 		offset := 1
+		nullBit := 0
 		for i, field := range fields {
-			if i >= len(record) {
-				break
+			value := ""
+			if i < len(record) {
+				value = record[i]
 			}
-
-			val := record[i]
-			encodedBytes, _, _ := transform.Bytes(encoder, []byte(val))
-
-			if len(encodedBytes) > field.Length {
-				encodedBytes = encodedBytes[:field.Length]
+			if flagNull != "" && value == flagNull {
+				value = ""
+			}
+			value = field.Opts.prepare(value)
+			if field.Opts.Nullable {
+				if value == "" {
+					recordBuf[nullFlags+nullBit/8] |= 1 << (nullBit % 8)
+				}
+				nullBit++
+			}
+			if field.Opts.AutoInc {
+				value = fields[i].Opts.autoIncValue(value)
+			}
+			if _, ok := binaryFieldLens[field.Type]; ok {
+				// A value the field can't hold is left blank, under the
+				// -on-truncate policy like values cut to fit
+				if !putBinaryField(recordBuf[offset:offset+field.Length], field, value) {
+					switch flagOnTruncate {
+					case truncateError:
+						return processed, unfitValueError(processed+1, i+1, field, value)
+					case truncateWarn:
+						if truncatedCells+blankedCells < truncateWarnLimit {
+							warnf("record %d, column %d (%s): %q is not a valid %c value; left blank", processed+1, i+1, field.Name, value, field.Type)
+						}
+					}
+					blankedCells++
+					if err := problems.add(processed+1, "column %d (%s): %q is not a valid %c value; left blank", i+1, field.Name, value, field.Type); err != nil {
+						return processed, err
+					}
+				}
+				offset += field.Length
+				continue
+			}
+			if convertsValue(field) {
+				typed := typedValue(field, value)
+				if coerced(value, typed) {
+					if problems.coercion < truncateWarnLimit {
+						warnf("record %d, column %d (%s): %q does not convert to a %c(%d) value", processed+1, i+1, field.Name, value, field.Type, field.Length)
+					}
+					problems.coercion++
+					if err := problems.add(processed+1, "column %d (%s): %q does not convert to a %c(%d) value", i+1, field.Name, value, field.Type, field.Length); err != nil {
+						return processed, err
+					}
+				}
+				value = typed
+			}
+			var unmappable int
+			scratch, unmappable = appendEncoded(scratch[:0], value, encoder)
+			if unmappable > 0 {
+				if flagOnEncodeError == encodeFail {
+					return processed, unmappableError(processed+1, i+1, field.Name, value, encoder)
+				}
+				unmappableCells++
 			}
-			copy(recordBuf[offset:], encodedBytes)
+			if field.Type == 'M' {
+				block, err := out.memo.add(scratch)
+				if err != nil {
+					return processed, fmt.Errorf("failed to write memo: %w", err)
+				}
+				putMemoBlock(recordBuf[offset:offset+field.Length], block)
+				offset += field.Length
+				continue
+			}
+			if len(scratch) > field.Length {
+				switch flagOnTruncate {
+				case truncateError:
+					return processed, truncatedValueError(processed+1, i+1, field, len(scratch))
+				case truncateWarn:
+					if truncatedCells+blankedCells < truncateWarnLimit {
+						warnf("record %d, column %d (%s): value of %d bytes cut to %d", processed+1, i+1, field.Name, len(scratch), field.Length)
+					}
+				}
+				truncatedCells++
+				if err := problems.add(processed+1, "column %d (%s): value of %d bytes cut to %d", i+1, field.Name, len(scratch), field.Length); err != nil {
+					return processed, err
+				}
+				scratch = truncateEncoded(scratch, field.Length, enc)
+			}
+			field.Opts.place(recordBuf[offset:offset+field.Length], scratch)
 			offset += field.Length
 		}
 
-		if _, err := w.Write(recordBuf); err != nil {
-			return err
+		if keys != nil {
+			err = keys.write(recordBuf)
+		} else {
+			_, err = out.w.Write(recordBuf)
+		}
+		if err != nil {
+			return processed, err
 		}
+		lap(&benchStages.encode, &mark)
 
 		processed++
-		// [Refactor] Use flagProgress to control output
-		if flagProgress > 0 && processed%uint32(flagProgress) == 0 {
-			fmt.Printf("  >> Written %d / %d ...\r", processed, total)
+		progress.update(processed, int64(processed)*int64(recordSize))
+	}
+
+	progress.finish(processed, int64(processed)*int64(recordSize))
+	serve.AddRows(int64(processed))
+	if truncatedCells > 0 && flagOnTruncate == truncateWarn {
+		warnf("%d values were cut to their field length", truncatedCells)
+	}
+	if blankedCells > 0 && flagOnTruncate == truncateWarn {
+		warnf("%d values were not valid for their I, B, Y or T field and were left blank", blankedCells)
+	}
+	if problems.coercion > 0 {
+		warnf("%d values did not convert to their field type", problems.coercion)
+	}
+	if unmappableCells > 0 {
+		warnf("%d cells had characters not representable in %s (%s)", unmappableCells, strings.ToUpper(flagEncoding), flagOnEncodeError)
+	}
+	return processed, nil
+}
+
+// appendEncoded encodes s into dst with the target encoding, reusing the
+// encoder and destination buffer across calls. Characters the encoding
+// cannot represent are substituted per -on-encode-error; the second result
+// is how many there were.
+func appendEncoded(dst []byte, s string, encoder *encoding.Encoder) ([]byte, int) {
+	// Fast path: ASCII is identical in every supported encoding
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
 		}
 	}
+	if ascii {
+		return append(dst, s...), 0
+	}
 
-	// [Refactor] Only print completion line if progress reporting was enabled
-	if flagProgress > 0 {
-		fmt.Printf("  >> Written %d / %d ...\n", processed, total)
+	encoder.Reset()
+	src := []byte(s)
+	unmappable := 0
+	for {
+		if cap(dst)-len(dst) < len(src)*2+utf8.UTFMax {
+			grown := make([]byte, len(dst), 2*cap(dst)+len(src)*2+utf8.UTFMax)
+			copy(grown, dst)
+			dst = grown
+		}
+		nDst, nSrc, err := encoder.Transform(dst[len(dst):cap(dst)], src, true)
+		dst = dst[:len(dst)+nDst]
+		src = src[nSrc:]
+		switch {
+		case err == nil || len(src) == 0:
+			return dst, unmappable
+		case err != transform.ErrShortDst:
+			// src starts with a character the encoding cannot represent
+			r, size := utf8.DecodeRune(src)
+			dst = substitute(dst, r)
+			src = src[size:]
+			unmappable++
+			encoder.Reset()
+		}
 	}
-	return nil
 }
 
 func fillSpace(b []byte) {
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Policies for columns longer than a character field can hold (-long)
+const (
+	longTruncate = "truncate" // cut values to 254 bytes
+	longClipper  = "clipper"  // Clipper long character field, up to 65535
+	longMemo     = "memo"     // M field with the text in the .fpt file
+)
+
+// memoBlockSize is the block size of the .fpt files csv2dbf writes
+const memoBlockSize = 64
+
+// memoWriter appends text blocks to a FoxPro .fpt memo file. The first
+// blocks hold the 512-byte header, whose next-free-block pointer is written
+// by close.
+type memoWriter struct {
+	f         *os.File
+	w         *bufio.Writer
+	blockSize int
+	next      uint32 // next free block
+}
+
+func memoPathFor(dbfPath string) string {
+	return strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath)) + ".fpt"
+}
+
+func createMemo(path string) (*memoWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &memoWriter{f: f, w: bufio.NewWriterSize(throttleWriter(f), 256*1024), blockSize: memoBlockSize, next: 512 / memoBlockSize}
+	if _, err := m.w.Write(make([]byte, 512)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// openMemo opens an existing .fpt memo file to add blocks after its last
+// one, in the block size it was created with
+func openMemo(path string) (*memoWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	var hdr [8]byte
+	if _, err := f.ReadAt(hdr[:], 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read memo header: %w", err)
+	}
+	m := &memoWriter{f: f, next: binary.BigEndian.Uint32(hdr[0:4]), blockSize: int(binary.BigEndian.Uint16(hdr[6:8]))}
+	if m.blockSize == 0 {
+		m.blockSize = 512
+	}
+	if _, err := f.Seek(int64(m.next)*int64(m.blockSize), io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	m.w = bufio.NewWriterSize(throttleWriter(f), 256*1024)
+	return m, nil
+}
+
+// add stores data as a text block and returns its block number; empty
+// values are not stored and return block 0
+func (m *memoWriter) add(data []byte) (uint32, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[0:4], 1) // 1 = text
+	binary.BigEndian.PutUint32(hdr[4:8], uint32(len(data)))
+	if _, err := m.w.Write(hdr[:]); err != nil {
+		return 0, err
+	}
+	if _, err := m.w.Write(data); err != nil {
+		return 0, err
+	}
+
+	used := (8 + len(data) + m.blockSize - 1) / m.blockSize
+	if pad := used*m.blockSize - 8 - len(data); pad > 0 {
+		if _, err := m.w.Write(make([]byte, pad)); err != nil {
+			return 0, err
+		}
+	}
+	block := m.next
+	m.next += uint32(used)
+	return block, nil
+}
+
+// close flushes the blocks and writes the header: next free block (big-endian
+// at 0) and block size (big-endian at 6)
+func (m *memoWriter) close() error {
+	err := m.w.Flush()
+	if err == nil {
+		var hdr [8]byte
+		binary.BigEndian.PutUint32(hdr[0:4], m.next)
+		binary.BigEndian.PutUint16(hdr[6:8], uint16(m.blockSize))
+		_, err = m.f.WriteAt(hdr[:], 0)
+	}
+	if cerr := m.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// putMemoBlock stores a block number in an M field: VFP uses a 4-byte
+// little-endian integer, FoxPro 2.x ten right-aligned digits
+func putMemoBlock(slot []byte, block uint32) {
+	if len(slot) == 4 {
+		binary.LittleEndian.PutUint32(slot, block)
+		return
+	}
+	if block == 0 {
+		return // slot stays blank
+	}
+	s := strconv.FormatUint(uint64(block), 10)
+	if len(s) <= len(slot) {
+		copy(slot[len(slot)-len(s):], s)
+	}
+}
+
+// hasMemoFields reports whether any field keeps its data in the memo file
+func hasMemoFields(fields []FieldInfo) bool {
+	for _, f := range fields {
+		if f.Type == 'M' {
+			return true
+		}
+	}
+	return false
+}
+
+// memoFieldLen is the length of an M field in the output format
+func memoFieldLen() int {
+	if flagVFP {
+		return 4
+	}
+	return 10
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+
+	"github.com/dabiaoge/csv2dbf/internal/serve"
+)
+
+// mergeFiles converts all the CSV files into the one -merge table, like
+// convertFile does for a single file
+func mergeFiles(ctx context.Context, csvFiles []string, delimiter rune, quote rune, enc encoding.Encoding) error {
+	for _, csvFile := range csvFiles {
+		if _, err := os.Stat(csvFile); os.IsNotExist(err) {
+			logNotFound(csvFile)
+			return err
+		}
+	}
+
+	if flagOnlyNewer && upToDate(flagMerge+compressExts[flagCompress], append(csvFiles, flagSchema)...) {
+		fmt.Printf("Skipped: %s (up to date)\n", flagMerge)
+		emitLog(logEvent{Level: "info", Event: "skipped", File: flagMerge, Message: "up to date"})
+		return nil
+	}
+
+	fmt.Printf("Processing: %s -> %s\n", strings.Join(csvFiles, ", "), flagMerge)
+	logFile = flagMerge
+	defer func() { logFile = "" }()
+	emitLog(logEvent{Level: "info", Event: "start"})
+	startTime := time.Now()
+
+	err := convertWithTimeout(ctx, flagMerge, func(ctx context.Context) error {
+		return convertCSVtoDBF(ctx, csvFiles, flagMerge, delimiter, quote, enc)
+	})
+	elapsed := time.Since(startTime)
+	serve.RecordConversion(err, elapsed)
+	if err != nil {
+		logFailure(flagMerge, elapsed, err)
+		return err
+	}
+
+	fmt.Printf("Done: %s (Time: %.3fs)\n", flagMerge, elapsed.Seconds())
+	emitLog(logEvent{Level: "info", Event: "done", Elapsed: elapsed.Seconds()})
+	return nil
+}
+
+// sameColumns reports how the header row of a merged file differs from the
+// first file's, or nil. Names are compared ignoring case and surrounding
+// spaces, as they are normalized into the same field names.
+func sameColumns(first, headers []string) error {
+	if len(headers) != len(first) {
+		return fmt.Errorf("%d columns, the first file has %d", len(headers), len(first))
+	}
+	for i := range headers {
+		if !strings.EqualFold(strings.TrimSpace(headers[i]), strings.TrimSpace(first[i])) {
+			return fmt.Errorf("column %d is '%s', the first file has '%s'", i+1, headers[i], first[i])
+		}
+	}
+	return nil
+}
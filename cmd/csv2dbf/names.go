@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// foxReservedWords are FoxPro keywords that make a field unusable in
+// commands and SQL when used as a bare field name
+var foxReservedWords = map[string]bool{
+	"ALL": true, "AND": true, "AS": true, "ASC": true, "AVG": true,
+	"BETWEEN": true, "BY": true, "COUNT": true, "DATE": true, "DELETE": true,
+	"DESC": true, "DISTINCT": true, "FIELD": true, "FOR": true, "FROM": true,
+	"GROUP": true, "HAVING": true, "IN": true, "INDEX": true, "INSERT": true,
+	"INTO": true, "IS": true, "JOIN": true, "LIKE": true, "MAX": true,
+	"MIN": true, "NOT": true, "NULL": true, "OF": true, "ON": true,
+	"OR": true, "ORDER": true, "SELECT": true, "SET": true, "SUM": true,
+	"TABLE": true, "TIME": true, "TO": true, "UNION": true, "UPDATE": true,
+	"VALUES": true, "WHERE": true, "WHILE": true, "WITH": true,
+}
+
+// applyNameCase applies -namecase (upper, lower or preserve) to name
+func applyNameCase(name string) string {
+	switch flagNameCase {
+	case "upper":
+		return strings.ToUpper(name)
+	case "lower":
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+// normalizeFieldName turns name into a valid FoxPro field name: it starts
+// with a letter, contains only letters, 0-9 and '_', is at most 10
+// characters and is not a reserved word. Letters are cased per -namecase.
+// pos is the 1-based column number, used when nothing usable is left of
+// the name.
+func normalizeFieldName(name string, pos int) string {
+	var b strings.Builder
+	for _, r := range applyNameCase(strings.TrimSpace(name)) {
+		switch {
+		case r < utf8.RuneSelf && isLetter(byte(r)), r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	s := strings.Trim(b.String(), "_")
+	if s == "" {
+		return applyNameCase("FIELD") + strconv.Itoa(pos)
+	}
+	if !isLetter(s[0]) {
+		s = applyNameCase("F") + s
+	}
+	if len(s) > 10 {
+		s = strings.TrimRight(s[:10], "_")
+	}
+	if foxReservedWords[strings.ToUpper(s)] {
+		s += "_"
+	}
+	return s
+}
+
+// normalizeFieldNames fixes up all field names in place, gives names that
+// collide (DBF names are case-insensitive) a numeric suffix, and prints the
+// names that had to be changed beyond their -namecase casing
+func normalizeFieldNames(fields []FieldInfo) {
+	fixed := make([]string, len(fields))
+	taken := make(map[string]bool, len(fields))
+	for i := range fields {
+		fixed[i] = normalizeFieldName(fields[i].Name, i+1)
+		taken[strings.ToUpper(fixed[i])] = true
+	}
+
+	var tw *tabwriter.Writer
+	seen := make(map[string]bool, len(fields))
+	for i := range fields {
+		name, note := fixed[i], ""
+		if seen[strings.ToUpper(name)] {
+			name, note = uniqueFieldName(name, taken), " (duplicate)"
+			taken[strings.ToUpper(name)] = true
+		}
+		seen[strings.ToUpper(name)] = true
+
+		if !strings.EqualFold(name, fields[i].Name) {
+			if tw == nil {
+				fmt.Println("  >> Field names changed to fit DBF rules:")
+				tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			}
+			fmt.Fprintf(tw, "       %d\t'%s'\t-> %s%s\n", i+1, fields[i].Name, name, note)
+		}
+		fields[i].Name = name
+	}
+	if tw != nil {
+		tw.Flush()
+	}
+}
+
+// uniqueFieldName returns name with the lowest suffix _2, _3, ... that is
+// not taken, shortening name to keep it within 10 characters
+func uniqueFieldName(name string, taken map[string]bool) string {
+	for n := 2; ; n++ {
+		suffix := "_" + strconv.Itoa(n)
+		base := name
+		if len(base)+len(suffix) > 10 {
+			base = base[:10-len(suffix)]
+		}
+		candidate := strings.TrimRight(base, "_") + suffix
+		if !taken[strings.ToUpper(candidate)] {
+			return candidate
+		}
+	}
+}
+
+// NameMap is the names sidecar (<name>.names.json) written by -names-map:
+// the CSV column each DBF field came from, so dbf2csv can restore headers
+// that had to be shortened or changed
+type NameMap struct {
+	Columns []NameMapEntry `json:"columns"`
+}
+
+type NameMapEntry struct {
+	Field  string `json:"field"`
+	Column string `json:"column"`
+}
+
+func namesPathFor(dbfPath string) string {
+	return strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath)) + ".names.json"
+}
+
+// saveNameMap writes the sidecar mapping fields to the CSV columns
+func saveNameMap(path string, columns []string, fields []FieldInfo) error {
+	m := NameMap{Columns: make([]NameMapEntry, len(fields))}
+	for i, f := range fields {
+		m.Columns[i] = NameMapEntry{Field: f.Name, Column: columns[i]}
+	}
+
+	data, err := json.MarshalIndent(&m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/encoding"
+)
+
+// maxDBFSize is the largest DBF dBase and FoxPro can open: record offsets
+// are signed 32-bit, so a table must stay below 2GB
+const maxDBFSize = 1<<31 - 1
+
+// dbfOutput is the table writeDBFRecords writes to. A new table is split
+// before it would grow past maxDBFSize: the part is finished and the
+// records continue in name_part2.dbf, name_part3.dbf, ..., each a complete
+// table with its own header and memo file. The zero perPart (-append)
+// never splits.
+type dbfOutput struct {
+	w    *bufio.Writer
+	memo *memoWriter
+
+	path    string // first part
+	fields  []FieldInfo
+	enc     encoding.Encoding
+	total   uint32 // records expected from the analysis pass
+	perPart uint32 // records that fit in one part
+	part    int
+	count   uint32 // records in the current part
+	header  uint32 // record count written in the current part's header
+	written uint32 // records in the finished parts
+	file    *os.File
+	paths   []string // tables and memo files created so far
+}
+
+// createOutput creates the first part of the table for dbfPath
+func createOutput(dbfPath string, fields []FieldInfo, total uint32, enc encoding.Encoding) (*dbfOutput, error) {
+	recLen := 1 + nullFlagsLen(fields)
+	for _, f := range fields {
+		recLen += f.Length
+	}
+	headerLen := 32 + 32*len(fields) + 1
+	if nullFlagsLen(fields) > 0 {
+		headerLen += 32
+	}
+	if flagVFP {
+		headerLen += vfpBacklinkSize
+	}
+	if likeTemplate != nil {
+		headerLen = len(likeTemplate.raw)
+	}
+
+	o := &dbfOutput{path: dbfPath, fields: fields, enc: enc, total: total}
+	o.perPart = uint32((maxDBFSize - int64(headerLen) - 1) / int64(recLen))
+	if err := o.open(); err != nil {
+		o.remove()
+		return nil, err
+	}
+	return o, nil
+}
+
+// partPath returns the path of part n of the table: the first part keeps
+// the table's own name, the others add _partN before its extension
+func (o *dbfOutput) partPath(n int) string {
+	if n == 1 {
+		return o.path
+	}
+	ext := filepath.Ext(o.path)
+	return fmt.Sprintf("%s_part%d%s", strings.TrimSuffix(o.path, ext), n, ext)
+}
+
+// open starts the next part
+func (o *dbfOutput) open() error {
+	o.part++
+	path := o.partPath(o.part)
+	f, err := os.Create(benchPath(path))
+	if err != nil {
+		return fmt.Errorf("failed to create DBF: %w", err)
+	}
+	o.file, o.count = f, 0
+	// Nothing to remove on failure when -bench writes to the null device
+	if !flagBench {
+		o.paths = append(o.paths, path)
+	}
+
+	if hasMemoFields(o.fields) {
+		memoPath := memoPathFor(path)
+		if o.memo, err = createMemo(benchPath(memoPath)); err != nil {
+			return fmt.Errorf("failed to create memo file: %w", err)
+		}
+		if !flagBench {
+			o.paths = append(o.paths, memoPath)
+			fmt.Printf("  >> Memo: %s\n", memoPath)
+		}
+	}
+
+	recLen := 1 + nullFlagsLen(o.fields)
+	for _, f := range o.fields {
+		recLen += f.Length
+	}
+	o.w = bufio.NewWriterSize(throttleWriter(f), bufferSize(recLen))
+
+	o.header = min(o.total-min(o.written, o.total), o.perPart)
+	if likeTemplate != nil {
+		return likeTemplate.writeHeader(o.w, o.header)
+	}
+	return writeDBFHeader(o.w, o.fields, o.header, o.enc)
+}
+
+// reserve makes room for one more record, starting a new part when the
+// current one is full
+func (o *dbfOutput) reserve() error {
+	if o.perPart == 0 {
+		return nil
+	}
+	if o.count == o.perPart {
+		if err := o.finishPart(); err != nil {
+			return err
+		}
+		if o.part == 1 {
+			warnf("the table would exceed the 2GB DBF limit; continuing in %s", o.partPath(2))
+		}
+		if err := o.open(); err != nil {
+			return err
+		}
+	}
+	o.count++
+	return nil
+}
+
+// finishPart completes the current part: memo file, EOF marker, record
+// count and autoincrement values
+func (o *dbfOutput) finishPart() error {
+	if o.memo != nil {
+		if err := o.memo.close(); err != nil {
+			return fmt.Errorf("failed to write memo file: %w", err)
+		}
+		o.memo = nil
+	}
+
+	// Write EOF marker
+	if err := o.w.WriteByte(0x1A); err != nil {
+		return err
+	}
+	if err := o.w.Flush(); err != nil {
+		return err
+	}
+
+	if hasAutoIncFields(o.fields) {
+		if err := patchAutoIncrement(o.file, o.fields); err != nil {
+			return err
+		}
+	}
+
+	// The record count is unknown up front when the analysis pass is skipped
+	if o.count != o.header {
+		if err := patchRecordCount(o.file, o.count); err != nil {
+			return err
+		}
+	}
+	o.written += o.count
+	return o.file.Close()
+}
+
+// remove deletes every file of the table, so no partial table is left
+// behind on failure or interruption
+func (o *dbfOutput) remove() {
+	if o.memo != nil {
+		o.memo.f.Close()
+	}
+	if o.file != nil {
+		o.file.Close()
+	}
+	for _, path := range o.paths {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// rowProblems counts the row-level problems of a conversion: malformed
+// lines that are skipped, values cut to their field length and values that
+// do not convert to their field type. With -max-errors the conversion stops
+// once there are that many, rather than writing a mostly empty table.
+type rowProblems struct {
+	count    int
+	coercion int // values left empty because they don't convert
+}
+
+// add records a problem at a record and returns the error that stops the
+// conversion: at once with -strict, or once -max-errors is reached
+func (p *rowProblems) add(record uint32, format string, args ...any) error {
+	p.count++
+	if flagStrict {
+		return fmt.Errorf("record %d, %s (-strict)", record, fmt.Sprintf(format, args...))
+	}
+	if flagMaxErrors > 0 && p.count >= flagMaxErrors {
+		return fmt.Errorf("stopped at record %d after %d problems (-max-errors %d), the last: %s", record, p.count, flagMaxErrors, fmt.Sprintf(format, args...))
+	}
+	return nil
+}
+
+// coerced reports whether typedValue turned a non-empty value into an empty
+// or overflowed ('*' filled) one
+func coerced(value, typed string) bool {
+	if strings.TrimSpace(value) == "" {
+		return false
+	}
+	return typed == "" || strings.Trim(typed, "*") == ""
+}
+
+// checkStrict reports the anomalies of a record that only -strict treats
+// as errors: a column count that differs from the fields, and bytes the
+// input encoding could not decode
+func checkStrict(record uint32, row []string, fields []FieldInfo) error {
+	columns := len(fields)
+	if shapeTarget != nil && shapeTarget.deletedColumn {
+		columns++
+	}
+	if len(row) != columns {
+		return fmt.Errorf("record %d: %d columns, expected %d (-strict)", record, len(row), columns)
+	}
+	for i, value := range row[:len(fields)] {
+		if strings.ContainsRune(value, utf8.RuneError) {
+			return fmt.Errorf("record %d, column %d (%s): bytes that are not valid %s (-strict)", record, i+1, fields[i].Name, strings.ToUpper(flagInputEncoding))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressEvent is one line of -progress json output
+type progressEvent struct {
+	Event   string  `json:"event"`
+	File    string  `json:"file"`
+	Rows    uint32  `json:"rows"`
+	Total   uint32  `json:"total"`
+	Bytes   int64   `json:"bytes"`
+	Elapsed float64 `json:"elapsed"`
+}
+
+// schemaEvent is emitted with -progress json once the DBF structure is
+// known, before any "progress" event, so a UI can show the table layout
+// while rows are still being written
+type schemaEvent struct {
+	Event          string        `json:"event"`
+	File           string        `json:"file"`
+	Output         string        `json:"output"`
+	Encoding       string        `json:"encoding"`
+	Records        uint32        `json:"records"`
+	RecordLength   int           `json:"record_length"`
+	EstimatedBytes int64         `json:"estimated_bytes"`
+	Fields         []schemaField `json:"fields"`
+}
+
+type schemaField struct {
+	Column string `json:"column"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Length int    `json:"length"`
+	Dec    int    `json:"dec,omitempty"`
+}
+
+// emitSchema writes the "schema" event for a conversion; columns are the
+// CSV header names and records is the analyzed count (0 with -schema)
+func emitSchema(file, output string, columns []string, fields []FieldInfo, records uint32) {
+	recLen := 1
+	for _, f := range fields {
+		recLen += f.Length
+	}
+	ev := schemaEvent{
+		Event:          "schema",
+		File:           file,
+		Output:         output,
+		Encoding:       strings.ToUpper(flagEncoding),
+		Records:        records,
+		RecordLength:   recLen,
+		EstimatedBytes: int64(32+32*len(fields)+1) + int64(records)*int64(recLen) + 1,
+		Fields:         make([]schemaField, len(fields)),
+	}
+	for i, f := range fields {
+		ev.Fields[i] = schemaField{Column: columns[i], Name: f.Name, Type: string(f.Type), Length: f.Length, Dec: f.Dec}
+	}
+	line, _ := json.Marshal(ev)
+	fmt.Fprintf(os.Stderr, "%s\n", line)
+}
+
+// progressReporter prints conversion progress, either as the human
+// "Written N / M" line on stdout or as JSON events on stderr.
+// Text output is driven by -c; JSON events are emitted every -c rows, or
+// once per second when -c is 0, plus a final "done" event.
+type progressReporter struct {
+	file  string
+	total uint32
+	start time.Time
+	last  time.Time
+}
+
+func newProgress(file string, total uint32) *progressReporter {
+	now := time.Now()
+	return &progressReporter{file: file, total: total, start: now, last: now}
+}
+
+// update is called after every record; n is the number of record bytes done
+func (p *progressReporter) update(rows uint32, n int64) {
+	if flagProgressFormat == "json" {
+		if flagProgress > 0 {
+			if rows%uint32(flagProgress) == 0 {
+				p.emit("progress", rows, n)
+			}
+		} else if rows%1024 == 0 && time.Since(p.last) >= time.Second {
+			p.emit("progress", rows, n)
+		}
+		return
+	}
+
+	if flagProgress > 0 && rows%uint32(flagProgress) == 0 {
+		fmt.Printf("  >> Written %d / %d ...\r", rows, p.total)
+	}
+}
+
+// finish reports the final counts
+func (p *progressReporter) finish(rows uint32, n int64) {
+	if flagProgressFormat == "json" {
+		p.emit("done", rows, n)
+		return
+	}
+
+	// Only print completion line if progress reporting was enabled
+	if flagProgress > 0 {
+		fmt.Printf("  >> Written %d / %d ...\n", rows, p.total)
+	}
+}
+
+func (p *progressReporter) emit(event string, rows uint32, n int64) {
+	p.last = time.Now()
+	line, _ := json.Marshal(progressEvent{
+		Event:   event,
+		File:    p.file,
+		Rows:    rows,
+		Total:   p.total,
+		Bytes:   n,
+		Elapsed: p.last.Sub(p.start).Seconds(),
+	})
+	fmt.Fprintf(os.Stderr, "%s\n", line)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fieldRenames is the resolved -rename map, keyed by the upper-cased old name
+var fieldRenames map[string]string
+
+// parseRenames reads a -rename value: OLD=NEW pairs separated by commas, or
+// the path of a mapping file with one OLD=NEW pair per line ('#' comments)
+func parseRenames(spec string) (map[string]string, error) {
+	text := spec
+	if !strings.Contains(spec, "=") {
+		data, err := os.ReadFile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rename map: %w", err)
+		}
+		text = string(data)
+	}
+
+	renames := make(map[string]string)
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		old, name, ok := strings.Cut(line, "=")
+		old, name = strings.TrimSpace(old), strings.TrimSpace(name)
+		if !ok || old == "" || name == "" {
+			return nil, fmt.Errorf("invalid rename '%s' (expected OLD=NEW)", line)
+		}
+		renames[strings.ToUpper(old)] = name
+	}
+	return renames, nil
+}
+
+// renameFields applies -rename to the CSV column names before they are
+// normalized into DBF field names
+func renameFields(fields []FieldInfo) {
+	if len(fieldRenames) == 0 {
+		return
+	}
+	used := make(map[string]bool, len(fieldRenames))
+	for i := range fields {
+		key := strings.ToUpper(fields[i].Name)
+		if name, ok := fieldRenames[key]; ok {
+			fields[i].Name = name
+			used[key] = true
+		}
+	}
+	for old := range fieldRenames {
+		if !used[old] {
+			warnf("-rename: no column named '%s'", old)
+		}
+	}
+}
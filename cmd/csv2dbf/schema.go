@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Schema is the on-disk description of the DBF structure produced by the
+// analysis pass. Saving it with -dump-schema and passing it back with -schema
+// lets later runs skip the analysis pass entirely.
+type Schema struct {
+	Fields []SchemaField `json:"fields"`
+}
+
+// SchemaField describes a single DBF column. The optional Trim, Pad,
+// Justify and Null settings control how CSV values are placed in the field.
+type SchemaField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Length   int    `json:"length"`
+	Dec      int    `json:"dec,omitempty"`
+	Trim     string `json:"trim,omitempty"`          // none (default), left, right, both
+	Pad      string `json:"pad,omitempty"`           // space (default), zero
+	Justify  string `json:"justify,omitempty"`       // left (default), right
+	Null     string `json:"null,omitempty"`          // CSV value written as an empty field
+	Nullable bool   `json:"nullable,omitempty"`      // VFP null for empty values (-vfp only)
+	AutoInc  bool   `json:"autoincrement,omitempty"` // VFP autoincrement Integer (-vfp only)
+	Next     int64  `json:"next,omitempty"`          // first autoincrement value (default 1)
+	Step     int    `json:"step,omitempty"`          // autoincrement step, 1-255 (default 1)
+}
+
+// FieldOptions are the per-field conversion settings from a schema file.
+// The zero value keeps the default behaviour: values are copied untrimmed,
+// left-justified and padded with spaces.
+type FieldOptions struct {
+	Trim     string
+	Pad      byte
+	Justify  string
+	Null     string
+	Nullable bool
+	AutoInc  bool
+	Next     int64 // next autoincrement value, advanced as records are written
+	Step     int
+}
+
+// schemaPathFor returns the default schema path written next to the DBF
+func schemaPathFor(dbfPath string) string {
+	return strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath)) + ".schema.json"
+}
+
+func saveSchema(path string, fields []FieldInfo) error {
+	s := Schema{Fields: make([]SchemaField, len(fields))}
+	for i, f := range fields {
+		s.Fields[i] = SchemaField{
+			Name:   f.Name,
+			Type:   string(f.Type),
+			Length: f.Length,
+			Dec:    f.Dec,
+		}
+		s.Fields[i].Trim = f.Opts.Trim
+		s.Fields[i].Justify = f.Opts.Justify
+		s.Fields[i].Null = f.Opts.Null
+		s.Fields[i].Nullable = f.Opts.Nullable
+		if f.Opts.AutoInc {
+			s.Fields[i].AutoInc, s.Fields[i].Next, s.Fields[i].Step = true, f.Opts.Next, f.Opts.Step
+		}
+		if f.Opts.Pad == '0' {
+			s.Fields[i].Pad = "zero"
+		}
+	}
+
+	data, err := json.MarshalIndent(&s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func loadSchema(path string) ([]FieldInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if len(s.Fields) == 0 {
+		return nil, fmt.Errorf("schema has no fields")
+	}
+
+	fields := make([]FieldInfo, len(s.Fields))
+	for i, sf := range s.Fields {
+		typ := strings.ToUpper(strings.TrimSpace(sf.Type))
+		if typ == "" {
+			typ = "C"
+		}
+		if len(typ) != 1 {
+			return nil, fmt.Errorf("field %q: invalid type %q", sf.Name, sf.Type)
+		}
+		if n, ok := binaryFieldLens[typ[0]]; ok {
+			if !flagVFP {
+				return nil, fmt.Errorf("field %q: type %s needs -vfp", sf.Name, typ)
+			}
+			if sf.Length == 0 {
+				sf.Length = n
+			}
+			if sf.Length != n {
+				return nil, fmt.Errorf("field %q: type %s has length %d", sf.Name, typ, n)
+			}
+		}
+		if typ == "M" {
+			// The block number's width depends on the table format, not the schema
+			sf.Length = memoFieldLen()
+		}
+		if sf.Length < 1 || sf.Length > maxFieldLen(typ[0]) {
+			return nil, fmt.Errorf("field %q: invalid length %d", sf.Name, sf.Length)
+		}
+		opts, err := parseFieldOptions(sf)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", sf.Name, err)
+		}
+		fields[i] = FieldInfo{
+			Name:   strings.TrimSpace(sf.Name),
+			Type:   typ[0],
+			Length: sf.Length,
+			Dec:    sf.Dec,
+			Opts:   opts,
+		}
+	}
+	return fields, nil
+}
+
+func parseFieldOptions(sf SchemaField) (FieldOptions, error) {
+	opts := FieldOptions{Null: sf.Null, Nullable: sf.Nullable}
+	if sf.Nullable && !flagVFP {
+		return opts, fmt.Errorf("nullable fields need -vfp")
+	}
+	if sf.AutoInc {
+		if !flagVFP || !strings.EqualFold(strings.TrimSpace(sf.Type), "I") {
+			return opts, fmt.Errorf("autoincrement fields must be of type I and need -vfp")
+		}
+		opts.AutoInc, opts.Next, opts.Step = true, sf.Next, sf.Step
+		if opts.Next == 0 {
+			opts.Next = 1
+		}
+		if opts.Step == 0 {
+			opts.Step = 1
+		}
+		if opts.Step < 1 || opts.Step > 255 || opts.Next < math.MinInt32 || opts.Next > math.MaxInt32 {
+			return opts, fmt.Errorf("invalid autoincrement next %d or step %d (step is 1-255)", sf.Next, sf.Step)
+		}
+	}
+
+	switch trim := strings.ToLower(sf.Trim); trim {
+	case "", "none":
+	case "left", "right", "both":
+		opts.Trim = trim
+	default:
+		return opts, fmt.Errorf("invalid trim %q (expected none, left, right or both)", sf.Trim)
+	}
+
+	switch strings.ToLower(sf.Pad) {
+	case "", "space":
+	case "zero":
+		opts.Pad = '0'
+	default:
+		return opts, fmt.Errorf("invalid pad %q (expected space or zero)", sf.Pad)
+	}
+
+	switch justify := strings.ToLower(sf.Justify); justify {
+	case "", "left":
+	case "right":
+		opts.Justify = justify
+	default:
+		return opts, fmt.Errorf("invalid justify %q (expected left or right)", sf.Justify)
+	}
+	return opts, nil
+}
+
+// prepare applies the Null and Trim options to a CSV value
+func (o *FieldOptions) prepare(value string) string {
+	if o.Null != "" && value == o.Null {
+		return ""
+	}
+	switch o.Trim {
+	case "left":
+		return strings.TrimLeft(value, " \t")
+	case "right":
+		return strings.TrimRight(value, " \t")
+	case "both":
+		return strings.Trim(value, " \t")
+	}
+	return value
+}
+
+// place copies an encoded value into its field slot, which the caller has
+// already filled with spaces, honouring the Justify and Pad options. An
+// empty value, blank or null in the CSV, stays blank rather than becoming
+// all padding (zeros, say).
+func (o *FieldOptions) place(slot, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	if len(value) > len(slot) {
+		value = value[:len(slot)]
+	}
+	if o.Justify == "right" {
+		copy(slot[len(slot)-len(value):], value)
+		if o.Pad != 0 {
+			for i := range slot[:len(slot)-len(value)] {
+				slot[i] = o.Pad
+			}
+		}
+		return
+	}
+	copy(slot, value)
+	if o.Pad != 0 {
+		for i := len(value); i < len(slot); i++ {
+			slot[i] = o.Pad
+		}
+	}
+}
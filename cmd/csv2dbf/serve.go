@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	"github.com/dabiaoge/csv2dbf/internal/serve"
+)
+
+// serveDenied are the options an HTTP client may not set: they control the
+// server itself or read and write files on it
+var serveDenied = map[string]bool{
+	"serve": true, "max-upload": true, "watch": true, "watch-debounce": true, "metrics": true,
+	"schema": true, "layout": true, "append": true, "merge": true, "like": true, "shapefile": true, "only-newer": true, "explain": true, "cpuprofile": true, "memprofile": true, "bench": true,
+}
+
+// serveConversions runs the -serve HTTP endpoints until ctx is done
+func serveConversions(ctx context.Context, addr string) error {
+	return serve.Run(ctx, addr, serve.Config{
+		Name:        "csv2dbf",
+		Input:       "CSV file",
+		DefaultFile: "upload.csv",
+		IsInput:     isWatchedCSV,
+		Denied:      serveDenied,
+		MaxUpload:   maxUpload,
+		Warnf:       warnf,
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+
+	"github.com/dabiaoge/csv2dbf/internal/serve"
+)
+
+// shapefileTable is the -shapefile target: the attribute table (.dbf) of a
+// shapefile, whose records pair with the shapes of the .shp by position
+type shapefileTable struct {
+	shp           string
+	dbf           string
+	shapes        uint32
+	deletedColumn bool // the CSV ends with dbf2csv's _DELETED column
+}
+
+// shapeTarget is the -shapefile target, nil without -shapefile
+var shapeTarget *shapefileTable
+
+// findSibling returns the file next to path with extension ext, in lower or
+// upper case, or ""
+func findSibling(path, ext string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, p := range []string{base + ext, base + strings.ToUpper(ext)} {
+		if st, err := os.Stat(p); err == nil && !st.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// openShapefile finds the .shp and .dbf of the shapefile named by path
+// (either file, or the name without extension) and counts its shapes
+func openShapefile(path string) (*shapefileTable, error) {
+	t := &shapefileTable{shp: findSibling(path, ".shp"), dbf: findSibling(path, ".dbf")}
+	if t.shp == "" {
+		return nil, fmt.Errorf("no .shp file for %s", path)
+	}
+	if t.dbf == "" {
+		return nil, fmt.Errorf("no .dbf attribute table next to %s", t.shp)
+	}
+	n, err := countShapes(t.shp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.shp, err)
+	}
+	t.shapes = n
+	return t, nil
+}
+
+// countShapes returns the number of records in a .shp file. The .shx index
+// holds one 8-byte entry per record after its 100-byte header; without it
+// the records of the .shp are walked.
+func countShapes(shpPath string) (uint32, error) {
+	if shx := findSibling(shpPath, ".shx"); shx != "" {
+		st, err := os.Stat(shx)
+		if err != nil {
+			return 0, err
+		}
+		if st.Size() < 100 || (st.Size()-100)%8 != 0 {
+			return 0, fmt.Errorf("%s: invalid index size %d", shx, st.Size())
+		}
+		return uint32((st.Size() - 100) / 8), nil
+	}
+
+	f, err := os.Open(shpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// The file length (bytes 24-27) and record content lengths count
+	// 16-bit words, big-endian
+	var header [100]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	if code := binary.BigEndian.Uint32(header[0:4]); code != 9994 {
+		return 0, fmt.Errorf("not a shapefile (file code %d)", code)
+	}
+	size := int64(binary.BigEndian.Uint32(header[24:28])) * 2
+	var n uint32
+	for pos := int64(100); pos+8 <= size; n++ {
+		var rec [8]byte
+		if _, err := f.ReadAt(rec[:], pos); err != nil {
+			return 0, fmt.Errorf("failed to read record %d: %w", n+1, err)
+		}
+		pos += 8 + int64(binary.BigEndian.Uint32(rec[4:8]))*2
+	}
+	return n, nil
+}
+
+// checkCount fails unless the table gets exactly one record per shape
+func (t *shapefileTable) checkCount(records uint32) error {
+	if records != t.shapes {
+		return fmt.Errorf("CSV has %d records, %s has %d shapes; records must pair with shapes one to one", records, filepath.Base(t.shp), t.shapes)
+	}
+	return nil
+}
+
+// writeShapefile writes a CSV back into the -shapefile attribute table, with
+// the table's own structure. The new table is written next to it and only
+// replaces it once every record is in place and the count matches the .shp,
+// so a failed run leaves the shapefile as it was.
+func writeShapefile(ctx context.Context, csvFile string, delimiter rune, quote rune, enc encoding.Encoding) error {
+	t := shapeTarget
+	fmt.Printf("Processing: %s -> %s\n", csvFile, t.dbf)
+	fmt.Printf("  >> Shapefile: %s (%d shapes)\n", t.shp, t.shapes)
+	logFile = csvFile
+	defer func() { logFile = "" }()
+	emitLog(logEvent{Level: "info", Event: "start"})
+	warnIndex(t.dbf, likeTemplate.header)
+	startTime := time.Now()
+
+	tmp := strings.TrimSuffix(t.dbf, filepath.Ext(t.dbf)) + ".new.dbf"
+	err := convertWithTimeout(ctx, t.dbf, func(ctx context.Context) error {
+		if err := convertCSVtoDBF(ctx, []string{csvFile}, tmp, delimiter, quote, enc); err != nil {
+			return err
+		}
+		if flagExplain {
+			return nil
+		}
+		if hasMemoFields(likeTemplate.fields) {
+			memoPath := findSibling(t.dbf, ".fpt")
+			if memoPath == "" {
+				memoPath = memoPathFor(t.dbf)
+			}
+			if err := os.Rename(memoPathFor(tmp), memoPath); err != nil {
+				return fmt.Errorf("failed to replace memo file: %w", err)
+			}
+		}
+		if err := os.Rename(tmp, t.dbf); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", t.dbf, err)
+		}
+		return dropIndex(t.dbf)
+	})
+	elapsed := time.Since(startTime)
+	serve.RecordConversion(err, elapsed)
+	if err != nil {
+		logFailure(csvFile, elapsed, err)
+		return err
+	}
+
+	fmt.Printf("Done: %s (Time: %.3fs)\n", t.dbf, elapsed.Seconds())
+	emitLog(logEvent{Level: "info", Event: "done", Elapsed: elapsed.Seconds()})
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// throttle paces I/O to a fixed byte rate so large conversions don't
+// saturate shared storage. It is not safe for concurrent use; each stream
+// gets its own.
+type throttle struct {
+	rate  float64 // bytes per second
+	start time.Time
+	done  int64
+}
+
+func newThrottle(rate float64) *throttle {
+	return &throttle{rate: rate, start: time.Now()}
+}
+
+// wait accounts for n transferred bytes and sleeps until they fit the rate
+func (t *throttle) wait(n int) {
+	t.done += int64(n)
+	due := t.start.Add(time.Duration(float64(t.done) / t.rate * float64(time.Second)))
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	tr.t.wait(n)
+	return n, err
+}
+
+type throttledWriter struct {
+	w io.Writer
+	t *throttle
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	n, err := tw.w.Write(p)
+	tw.t.wait(n)
+	return n, err
+}
+
+// throttleReader applies the -throttle limit to r, if one is set
+func throttleReader(r io.Reader) io.Reader {
+	if throttleRate <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, t: newThrottle(throttleRate)}
+}
+
+// throttleWriter applies the -throttle limit to w, if one is set
+func throttleWriter(w io.Writer) io.Writer {
+	if throttleRate <= 0 {
+		return w
+	}
+	return &throttledWriter{w: w, t: newThrottle(throttleRate)}
+}
+
+// parseRate parses a rate such as "50MB/s" or "512K" into bytes per second
+func parseRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "/S")
+	n, err := parseSize(s)
+	return float64(n), err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Policies for values longer than their field (-on-truncate)
+const (
+	truncateError  = "error"  // abort the conversion
+	truncateWarn   = "warn"   // cut the value and report where
+	truncateSilent = "silent" // cut the value
+)
+
+// truncateWarnLimit caps the per-value warnings; the rest are only counted
+const truncateWarnLimit = 10
+
+// truncateEncoded cuts an encoded value to at most n bytes without splitting
+// a character of the target encoding
+func truncateEncoded(b []byte, n int, enc encoding.Encoding) []byte {
+	if len(b) <= n {
+		return b
+	}
+	if enc == unicode.UTF8 {
+		for n > 0 && !utf8.RuneStart(b[n]) {
+			n--
+		}
+		return b[:n]
+	}
+
+	// GBK/GB18030: ASCII is one byte, other characters two bytes, or four
+	// when the second byte is a digit
+	i := 0
+	for i < n {
+		size := 1
+		if b[i] >= 0x80 {
+			size = 2
+			if i+1 < len(b) && b[i+1] >= '0' && b[i+1] <= '9' {
+				size = 4
+			}
+		}
+		if i+size > n {
+			break
+		}
+		i += size
+	}
+	return b[:i]
+}
+
+func truncatedValueError(record uint32, column int, field FieldInfo, length int) error {
+	return fmt.Errorf("record %d, column %d (%s): value of %d bytes exceeds the field length %d", record, column, field.Name, length, field.Length)
+}
+
+func unfitValueError(record uint32, column int, field FieldInfo, value string) error {
+	return fmt.Errorf("record %d, column %d (%s): %q is not a valid %c value", record, column, field.Name, value, field.Type)
+}
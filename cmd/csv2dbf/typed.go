@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// columnKind collects what -typed-csv analysis has seen in one column.
+// A column becomes a D, L or N field (with -vfp also T or I) only if every
+// non-empty value fits.
+type columnKind struct {
+	seen     bool
+	date     bool
+	datetime bool
+	logical  bool
+	numeric  bool
+	integer  bool // every value fits an int32
+	intLen   int  // digits before the point, including the sign
+	dec      int  // digits after the point
+}
+
+func newColumnKinds(n int) []columnKind {
+	kinds := make([]columnKind, n)
+	for i := range kinds {
+		kinds[i] = columnKind{date: true, datetime: flagVFP, logical: true, numeric: true, integer: flagVFP}
+	}
+	return kinds
+}
+
+func (k *columnKind) observe(val string) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return
+	}
+	k.seen = true
+
+	if k.date {
+		_, err := time.Parse("2006-01-02", val)
+		k.date = err == nil
+	}
+	if k.datetime {
+		_, k.datetime = parseDateTime(val)
+	}
+	if k.logical {
+		_, ok := parseLogical(val)
+		k.logical = ok
+	}
+	if k.integer {
+		_, err := strconv.ParseInt(val, 10, 32)
+		k.integer = err == nil
+	}
+	if k.numeric {
+		if _, err := strconv.ParseFloat(val, 64); err != nil || strings.ContainsAny(val, "eEinIN") {
+			k.numeric = false
+			return
+		}
+		intPart, frac, _ := strings.Cut(val, ".")
+		k.intLen = max(k.intLen, max(len(intPart), 1))
+		k.dec = max(k.dec, len(frac))
+	}
+}
+
+// apply sets the field type from the observed values. Numeric columns that
+// do not fit the 20-byte N field limit stay character fields. With -vfp,
+// datetimes become T fields and int32 columns I fields, both binary.
+func (k *columnKind) apply(f *FieldInfo) {
+	if !k.seen {
+		return
+	}
+	switch {
+	case k.date:
+		f.Type, f.Length = 'D', 8
+	case k.logical:
+		f.Type, f.Length = 'L', 1
+	case k.datetime:
+		f.Type, f.Length = 'T', binaryFieldLens['T']
+	case k.integer:
+		f.Type, f.Length = 'I', binaryFieldLens['I']
+	case k.numeric:
+		length := k.intLen
+		if k.dec > 0 {
+			length += k.dec + 1
+		}
+		if length <= 20 && k.dec <= 15 {
+			f.Type, f.Length, f.Dec = 'N', length, k.dec
+		}
+	}
+}
+
+// boolFormats lists the -boolfmt presets (case-insensitive)
+var boolFormats = []string{"TRUE/FALSE", "true/false", "1/0", "Y/N", "T/F", "yes/no"}
+
+// numericBools is set by -boolfmt 1/0. Only then are 1 and 0 read as
+// logical values; otherwise a 0/1 column would never be inferred as numeric.
+var numericBools bool
+
+func checkBoolFormat(spec string) error {
+	for _, preset := range boolFormats {
+		if strings.EqualFold(spec, preset) {
+			numericBools = preset == "1/0"
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid bool format '%s' (presets: %s)", spec, strings.Join(boolFormats, ", "))
+}
+
+// parseLogical accepts every -boolfmt preset spelling of a boolean
+func parseLogical(val string) (bool, bool) {
+	switch strings.ToLower(val) {
+	case "true", "t", "yes", "y":
+		return true, true
+	case "false", "f", "no", "n":
+		return false, true
+	case "1":
+		return true, numericBools
+	case "0":
+		return false, numericBools
+	}
+	return false, false
+}
+
+// convertsValue reports whether the values of f go through typedValue: those
+// of D, N, F and L fields always, whatever made the field (the analysis,
+// -schema, -like), and all of them when the input is typed
+func convertsValue(f FieldInfo) bool {
+	switch f.Type {
+	case 'D', 'N', 'F', 'L':
+		return true
+	}
+	return flagTypedCSV || flagLayout != "" || flagAppend != "" || likeTemplate != nil
+}
+
+// typedValue converts a typed CSV or fixed-width value to its DBF storage
+// form for D, L and N fields. Values that do not parse are written as empty fields.
+func typedValue(f FieldInfo, val string) string {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return ""
+	}
+	switch f.Type {
+	case 'D':
+		t, err := time.Parse("2006-01-02", val)
+		if err != nil {
+			// Already in storage form, as in fixed-width host files
+			if t, err = time.Parse("20060102", val); err != nil {
+				return ""
+			}
+		}
+		return t.Format("20060102")
+	case 'L':
+		v, ok := parseLogical(val)
+		if !ok {
+			return ""
+		}
+		if v {
+			return "T"
+		}
+		return "F"
+	case 'N', 'F':
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return ""
+		}
+		s := strconv.FormatFloat(n, 'f', f.Dec, 64)
+		if len(s) > f.Length {
+			return strings.Repeat("*", f.Length)
+		}
+		return strings.Repeat(" ", f.Length-len(s)) + s
+	}
+	return val
+}
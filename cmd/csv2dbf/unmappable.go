@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Policies for characters the target DBF encoding cannot represent
+const (
+	encodeReplace  = "replace"  // write '?'
+	encodeTranslit = "translit" // write the closest ASCII, e.g. é -> e, “ -> "
+	encodeSkip     = "skip"     // drop the character
+	encodeFail     = "fail"     // abort the conversion
+)
+
+// translitPunct covers common punctuation that has no decomposition
+var translitPunct = map[rune]string{
+	'‘': "'", '’': "'", '‚': ",", '‛': "'",
+	'“': "\"", '”': "\"", '„': "\"",
+	'–': "-", '—': "-", '‒': "-", '―': "-", '−': "-",
+	'…': "...", '•': "*", '·': ".",
+	'€': "EUR", '™': "TM", '©': "(C)", '®': "(R)",
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O", 'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D",
+	' ': " ",
+}
+
+// transliterate returns an ASCII stand-in for r, or "?" if there is none
+func transliterate(r rune) string {
+	if s, ok := translitPunct[r]; ok {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range norm.NFKD.String(string(r)) {
+		if c < utf8.RuneSelf {
+			b.WriteRune(c)
+		} else if !unicode.Is(unicode.Mn, c) {
+			return "?"
+		}
+	}
+	if b.Len() == 0 {
+		return "?"
+	}
+	return b.String()
+}
+
+// substitute appends the -on-encode-error stand-in for an unmappable rune
+func substitute(dst []byte, r rune) []byte {
+	switch flagOnEncodeError {
+	case encodeTranslit:
+		return append(dst, transliterate(r)...)
+	case encodeSkip:
+		return dst
+	}
+	return append(dst, '?')
+}
+
+// firstUnmappable returns the first rune of s that encoder cannot represent
+func firstUnmappable(s string, encoder *encoding.Encoder) rune {
+	for _, r := range s {
+		if _, _, err := transform.String(encoder, string(r)); err != nil {
+			return r
+		}
+	}
+	return utf8.RuneError
+}
+
+// unmappableError reports a value that cannot be stored under -on-encode-error fail
+func unmappableError(record uint32, column int, field string, value string, encoder *encoding.Encoder) error {
+	return fmt.Errorf("record %d, column %d (%s): %q cannot be represented in %s", record, column, field, firstUnmappable(value, encoder), strings.ToUpper(flagEncoding))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// keyIndex maps the -upsert key values of a table's records to their
+// record numbers. Records written through it overwrite the record with the
+// same key in place; records with a new key are appended (and indexed, so
+// a later CSV row with that key updates them in turn).
+type keyIndex struct {
+	f        *os.File
+	w        *bufio.Writer // the append writer
+	dataOff  int64
+	recLen   int64
+	base     uint32 // records in the table before the upsert
+	offset   int    // key field position in the record
+	length   int
+	binary   bool // binary key field: compared without trimming
+	records  map[string]uint32
+	undo     map[uint32][]byte // original contents of updated records
+	updated  uint32
+	inserted uint32
+}
+
+// newKeyIndex reads the key field of every record that is not deleted.
+// When several records share a key, the first one is updated.
+func newKeyIndex(f *os.File, w *bufio.Writer, header DBFHeader, fields []FieldInfo, key string) (*keyIndex, error) {
+	k := &keyIndex{
+		f: f, w: w, dataOff: int64(header.HeaderLen), recLen: int64(header.RecLen), base: header.NumRecs,
+		records: make(map[string]uint32), undo: make(map[uint32][]byte),
+	}
+	found := false
+	offset := 1
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, key) {
+			if field.Type == 'M' {
+				return nil, fmt.Errorf("key field %s is a memo field", field.Name)
+			}
+			_, k.binary = binaryFieldLens[field.Type]
+			k.offset, k.length, found = offset, field.Length, true
+			break
+		}
+		offset += field.Length
+	}
+	if !found {
+		return nil, fmt.Errorf("key field %s not found", key)
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(f, k.dataOff, int64(header.NumRecs)*k.recLen), 1024*1024)
+	record := make([]byte, k.recLen)
+	shared := 0
+	for n := uint32(0); n < header.NumRecs; n++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, fmt.Errorf("error reading record %d: %w", n+1, err)
+		}
+		if record[0] == '*' {
+			continue
+		}
+		key := k.key(record)
+		if _, dup := k.records[key]; dup {
+			shared++
+			continue
+		}
+		k.records[key] = n
+	}
+	if shared > 0 {
+		warnf("%d records share their key with an earlier record; only the first is updated", shared)
+	}
+	return k, nil
+}
+
+// key returns the key value of a record as stored, without padding
+func (k *keyIndex) key(record []byte) string {
+	slot := record[k.offset : k.offset+k.length]
+	if !k.binary {
+		slot = bytes.TrimSpace(slot)
+	}
+	return string(slot)
+}
+
+// write updates the record with the key of record, or appends it
+func (k *keyIndex) write(record []byte) error {
+	key := k.key(record)
+	n, ok := k.records[key]
+	if !ok {
+		k.records[key] = k.base + k.inserted
+		k.inserted++
+		_, err := k.w.Write(record)
+		return err
+	}
+
+	pos := k.dataOff + int64(n)*k.recLen
+	if n >= k.base {
+		// Appended by this upsert and maybe still buffered
+		if err := k.w.Flush(); err != nil {
+			return err
+		}
+	} else if _, saved := k.undo[n]; !saved {
+		old := make([]byte, k.recLen)
+		if _, err := k.f.ReadAt(old, pos); err != nil {
+			return fmt.Errorf("error reading record %d: %w", n+1, err)
+		}
+		k.undo[n] = old
+	}
+	if _, err := k.f.WriteAt(record, pos); err != nil {
+		return err
+	}
+	k.updated++
+	return nil
+}
+
+// restore writes back the original contents of the updated records
+func (k *keyIndex) restore() {
+	for n, old := range k.undo {
+		k.f.WriteAt(old, k.dataOff+int64(n)*k.recLen)
+	}
+}
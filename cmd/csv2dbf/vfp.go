@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// vfpBacklinkSize is the area Visual FoxPro reserves between the field
+// terminator and the first record for the path of the owning database (.dbc)
+const vfpBacklinkSize = 263
+
+// Visual FoxPro field flags (descriptor byte 18)
+const (
+	fieldFlagSystem   = 0x01
+	fieldFlagNullable = 0x02
+	fieldFlagBinary   = 0x04
+	fieldFlagAutoInc  = 0x08
+)
+
+// binaryFieldLens are the fixed lengths of the Visual FoxPro binary field
+// types, which -vfp writes in their native encoding instead of as text
+var binaryFieldLens = map[byte]int{'I': 4, 'B': 8, 'Y': 8, 'T': 8}
+
+// nullFlagsLen returns the length of the hidden _NullFlags field that holds
+// one bit per nullable field, 0 if there are none
+func nullFlagsLen(fields []FieldInfo) int {
+	n := 0
+	for _, f := range fields {
+		if f.Opts.Nullable {
+			n++
+		}
+	}
+	return (n + 7) / 8
+}
+
+// hasAutoIncFields reports whether any field is an autoincrement Integer
+func hasAutoIncFields(fields []FieldInfo) bool {
+	for _, f := range fields {
+		if f.Opts.AutoInc {
+			return true
+		}
+	}
+	return false
+}
+
+// autoIncValue numbers an empty value of an autoincrement field with the
+// next value. Values given in the CSV are kept, and the next value moves
+// past them, so appending to an exported table continues its numbering.
+func (o *FieldOptions) autoIncValue(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		value = strconv.FormatInt(o.Next, 10)
+	}
+	if n, err := strconv.ParseInt(value, 10, 32); err == nil && n+int64(o.Step) > o.Next {
+		o.Next = n + int64(o.Step)
+	}
+	return value
+}
+
+// patchAutoIncrement stores the next value of each autoincrement field
+// (descriptor bytes 19-22) once all records are written
+func patchAutoIncrement(f *os.File, fields []FieldInfo) error {
+	for i, field := range fields {
+		if !field.Opts.AutoInc {
+			continue
+		}
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(int32(field.Opts.Next)))
+		if _, err := f.WriteAt(buf[:], int64(32+32*i+19)); err != nil {
+			return fmt.Errorf("failed to update autoincrement value: %w", err)
+		}
+	}
+	return nil
+}
+
+// vfpCodePage returns the code page mark (header byte 29) for enc, or 0 if
+// Visual FoxPro has none for it
+func vfpCodePage(enc encoding.Encoding) byte {
+	if enc == simplifiedchinese.GBK || enc == simplifiedchinese.GB18030 {
+		return 0x7A // code page 936
+	}
+	return 0
+}
+
+// putBinaryField stores value in slot in the native encoding of a binary
+// field: I as int32, B as float64, Y as int64 in 1/10000 units and T as
+// Julian day + milliseconds, all little-endian. Empty or unparsable values
+// leave the slot zeroed, which Visual FoxPro shows as blank.
+func putBinaryField(slot []byte, f FieldInfo, value string) bool {
+	clear(slot)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return true
+	}
+
+	switch f.Type {
+	case 'I':
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return false
+		}
+		binary.LittleEndian.PutUint32(slot, uint32(int32(n)))
+	case 'B':
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		binary.LittleEndian.PutUint64(slot, math.Float64bits(v))
+	case 'Y':
+		n, ok := parseCurrency(value)
+		if !ok {
+			return false
+		}
+		binary.LittleEndian.PutUint64(slot, uint64(n))
+	case 'T':
+		t, ok := parseDateTime(value)
+		if !ok {
+			return false
+		}
+		day, ms := timeToJulianDay(t)
+		binary.LittleEndian.PutUint32(slot[:4], uint32(day))
+		binary.LittleEndian.PutUint32(slot[4:], uint32(ms))
+	}
+	return true
+}
+
+// parseCurrency parses a decimal such as "-1,234.5" into 1/10000 units
+// exactly; digits beyond the fourth decimal are rounded half away from zero
+func parseCurrency(s string) (int64, bool) {
+	s = strings.ReplaceAll(s, ",", "")
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, false
+	}
+
+	var n int64
+	for _, c := range whole + (frac + "0000")[:4] {
+		if c < '0' || c > '9' || n > (math.MaxInt64-9)/10 {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if len(frac) > 4 {
+		for _, c := range frac[4:] {
+			if c < '0' || c > '9' {
+				return 0, false
+			}
+		}
+		if frac[4] >= '5' {
+			n++
+		}
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+// dateTimeLayouts are the datetime forms accepted for T fields
+var dateTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"20060102150405",
+	"20060102",
+}
+
+// parseDateTime parses a T field value; values with a zone are converted
+// to UTC, the zone Visual FoxPro datetimes are read back in
+func parseDateTime(s string) (time.Time, bool) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeToJulianDay is the inverse of dbf2csv's julianDayToTime: the Julian
+// day number and the milliseconds since midnight of t
+func timeToJulianDay(t time.Time) (int, int) {
+	const unixEpochJD = 2440588 // 1970-01-01
+	secs := t.Unix()
+	days := math.Floor(float64(secs) / 86400)
+	rem := secs - int64(days)*86400
+	return int(days) + unixEpochJD, int(rem)*1000 + t.Nanosecond()/1e6
+}
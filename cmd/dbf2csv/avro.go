@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// avroBlockSize is the size of uncompressed record data after which a
+// data block is written
+const avroBlockSize = 1 << 20
+
+// avroColumn is the Avro type of a column and how its cells are encoded;
+// cells that don't convert are written as null and reported
+type avroColumn struct {
+	schema any
+	value  func(dst []byte, cell string) ([]byte, bool)
+	text   bool // character data: blank cells are empty strings, not null
+}
+
+var (
+	avroString = avroColumn{schema: "string", text: true, value: func(dst []byte, cell string) ([]byte, bool) {
+		return appendAvroBytes(dst, []byte(cell)), true
+	}}
+	avroBytes = avroColumn{schema: "bytes", value: func(dst []byte, cell string) ([]byte, bool) {
+		data, err := decodeBinary(cell)
+		return appendAvroBytes(dst, data), err == nil
+	}}
+	avroDouble = avroColumn{schema: "double", value: func(dst []byte, cell string) ([]byte, bool) {
+		v, err := strconv.ParseFloat(cell, 64)
+		return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v)), err == nil && !math.IsInf(v, 0) && !math.IsNaN(v)
+	}}
+	avroInt = avroColumn{schema: "int", value: func(dst []byte, cell string) ([]byte, bool) {
+		v, err := strconv.ParseInt(cell, 10, 32)
+		return binary.AppendVarint(dst, v), err == nil
+	}}
+	avroLong = avroColumn{schema: "long", value: func(dst []byte, cell string) ([]byte, bool) {
+		v, err := strconv.ParseInt(cell, 10, 64)
+		return binary.AppendVarint(dst, v), err == nil
+	}}
+	avroBoolean = avroColumn{schema: "boolean", value: func(dst []byte, cell string) ([]byte, bool) {
+		if cell == boolTrue {
+			return append(dst, 1), true
+		}
+		return append(dst, 0), cell == boolFalse
+	}}
+	avroDate = avroColumn{schema: map[string]any{"type": "int", "logicalType": "date"}, value: func(dst []byte, cell string) ([]byte, bool) {
+		days, ok := parseDateCell(cell)
+		return binary.AppendVarint(dst, int64(days)), ok
+	}}
+	avroTimestamp = avroColumn{schema: map[string]any{"type": "long", "logicalType": "timestamp-millis"}, value: func(dst []byte, cell string) ([]byte, bool) {
+		ms, ok := parseDateTimeCell(cell)
+		return binary.AppendVarint(dst, ms), ok
+	}}
+)
+
+// avroDecimal is a decimal column with scale digits after the point,
+// stored as the big-endian two's complement of the unscaled value
+func avroDecimal(scale, precision int) avroColumn {
+	schema := map[string]any{"type": "bytes", "logicalType": "decimal", "precision": precision, "scale": scale}
+	return avroColumn{schema: schema, value: func(dst []byte, cell string) ([]byte, bool) {
+		v, ok := parseDecimal(cell, scale)
+		if !ok {
+			return dst, false
+		}
+		b := binary.BigEndian.AppendUint64(nil, uint64(v))
+		// Drop sign-extension bytes
+		for len(b) > 1 && (b[0] == 0 && b[1]&0x80 == 0 || b[0] == 0xFF && b[1]&0x80 != 0) {
+			b = b[1:]
+		}
+		return appendAvroBytes(dst, b), true
+	}}
+}
+
+// avroColumnFor maps a DBF field to an Avro type, with the same choices as
+// parquetColumnFor
+func avroColumnFor(f FieldInfo) avroColumn {
+	switch f.Type {
+	case 'N':
+		if f.Dec == 0 && f.Length <= 9 {
+			return avroInt
+		}
+		if f.Dec == 0 && f.Length <= 18 {
+			return avroLong
+		}
+		if precision := max(f.Length-1, f.Dec); precision <= 18 {
+			return avroDecimal(f.Dec, precision)
+		}
+		return avroDouble
+	case 'F', 'B', 'O':
+		return avroDouble
+	case 'I', '+':
+		return avroInt
+	case 'Y':
+		return avroDecimal(4, 18)
+	case 'D':
+		return avroDate
+	case 'T', '@':
+		return avroTimestamp
+	case 'L':
+		return avroBoolean
+	case 'Q':
+		return avroBytes
+	}
+	if isBinaryMemo(f) {
+		return avroBytes
+	}
+	return avroString
+}
+
+// appendAvroBytes appends a length-prefixed string or bytes value
+func appendAvroBytes(dst, data []byte) []byte {
+	return append(binary.AppendVarint(dst, int64(len(data))), data...)
+}
+
+// avroName makes s a valid Avro name ([A-Za-z_][A-Za-z0-9_]*), replacing
+// other characters with '_'
+func avroName(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, c := range s {
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || len(b) > 0 && c >= '0' && c <= '9' {
+			b = append(b, byte(c))
+		} else {
+			b = append(b, '_')
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+// avroField is a field of the record schema; all fields are nullable
+type avroField struct {
+	Name    string `json:"name"`
+	Doc     string `json:"doc,omitempty"` // the column name, when the field name differs from it
+	Type    []any  `json:"type"`
+	Default any    `json:"default"`
+}
+
+// avroWriter writes rows to an Avro object container file with deflate
+// compressed blocks. The first row written is the header row, which names
+// the fields of the record schema, written into the file header.
+type avroWriter struct {
+	w       *bufio.Writer
+	name    string
+	columns []avroColumn
+	sync    [16]byte
+	started bool
+	block   []byte
+	count   int
+	zbuf    bytes.Buffer
+	zw      *flate.Writer
+	written int
+	failed  convertReport
+}
+
+func newAvroWriter(w *bufio.Writer, fields []FieldInfo, name string) *avroWriter {
+	columns := make([]avroColumn, len(fields))
+	for i, f := range fields {
+		columns[i] = avroColumnFor(f)
+	}
+	if flagDeletedColumn {
+		columns = append(columns, avroBoolean)
+	}
+	return &avroWriter{w: w, name: avroName(name), columns: columns}
+}
+
+func (aw *avroWriter) Write(row []string) error {
+	if !aw.started {
+		aw.started = true
+		aw.failed.names = slices.Clone(row)
+		return aw.writeHeader(row)
+	}
+
+	aw.written++
+	for i, cell := range row {
+		start := len(aw.block)
+		c := aw.columns[i]
+		if cell != flagNull || flagNull == "" && c.text {
+			if block, ok := c.value(binary.AppendVarint(aw.block, 1), cell); ok {
+				aw.block = block
+				continue
+			}
+			if cell != "" {
+				aw.failed.add(aw.written, i, cell)
+			}
+		}
+		aw.block = binary.AppendVarint(aw.block[:start], 0) // null
+	}
+	aw.count++
+	if len(aw.block) >= avroBlockSize {
+		return aw.writeBlock()
+	}
+	return nil
+}
+
+// writeHeader writes the magic, the schema and the sync marker
+func (aw *avroWriter) writeHeader(names []string) error {
+	fields := make([]avroField, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		// Names without a letter or digit left (e.g. Chinese ones, all
+		// replaced by '_') become FIELDn; names that still collide get a
+		// _2, _3, ... suffix. The column name is kept in the doc.
+		field := avroName(name)
+		if strings.Trim(field, "_") == "" {
+			field = fmt.Sprintf("FIELD%d", i+1)
+		}
+		for n, base := 2, field; seen[field]; n++ {
+			field = fmt.Sprintf("%s_%d", base, n)
+		}
+		seen[field] = true
+		fields[i] = avroField{Name: field, Type: []any{"null", aw.columns[i].schema}}
+		if field != name {
+			fields[i].Doc = name
+		}
+	}
+	schema, err := json.Marshal(map[string]any{"type": "record", "name": aw.name, "fields": fields})
+	if err != nil {
+		return err
+	}
+	if _, err := rand.Read(aw.sync[:]); err != nil {
+		return err
+	}
+
+	hdr := []byte("Obj\x01")
+	hdr = binary.AppendVarint(hdr, 2) // metadata map block of 2 entries
+	hdr = appendAvroBytes(hdr, []byte("avro.schema"))
+	hdr = appendAvroBytes(hdr, schema)
+	hdr = appendAvroBytes(hdr, []byte("avro.codec"))
+	hdr = appendAvroBytes(hdr, []byte("deflate"))
+	hdr = binary.AppendVarint(hdr, 0)
+	hdr = append(hdr, aw.sync[:]...)
+	_, err = aw.w.Write(hdr)
+	return err
+}
+
+// writeBlock compresses the buffered records into a data block
+func (aw *avroWriter) writeBlock() error {
+	if aw.count == 0 {
+		return nil
+	}
+	aw.zbuf.Reset()
+	if aw.zw == nil {
+		aw.zw, _ = flate.NewWriter(&aw.zbuf, flate.DefaultCompression)
+	} else {
+		aw.zw.Reset(&aw.zbuf)
+	}
+	if _, err := aw.zw.Write(aw.block); err != nil {
+		return err
+	}
+	if err := aw.zw.Close(); err != nil {
+		return err
+	}
+
+	var prefix []byte
+	prefix = binary.AppendVarint(prefix, int64(aw.count))
+	prefix = binary.AppendVarint(prefix, int64(aw.zbuf.Len()))
+	if _, err := aw.w.Write(prefix); err != nil {
+		return err
+	}
+	if _, err := aw.w.Write(aw.zbuf.Bytes()); err != nil {
+		return err
+	}
+	if _, err := aw.w.Write(aw.sync[:]); err != nil {
+		return err
+	}
+	aw.block, aw.count = aw.block[:0], 0
+	return nil
+}
+
+// Flush is a no-op: records are buffered into whole blocks
+func (aw *avroWriter) Flush() {}
+
+// Close writes the last block and flushes the underlying buffer
+func (aw *avroWriter) Close() error {
+	aw.failed.finish("Avro")
+	if err := aw.writeBlock(); err != nil {
+		return err
+	}
+	return aw.w.Flush()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// benchStats captures timing and allocator counters at the start of a run
+type benchStats struct {
+	start   time.Time
+	mallocs uint64
+	numGC   uint32
+}
+
+func startBench() benchStats {
+	benchStages.reset()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return benchStats{start: time.Now(), mallocs: ms.Mallocs, numGC: ms.NumGC}
+}
+
+// report prints throughput and allocation figures for rows records
+// totalling n input bytes, then the parse and encode stages on their own
+func (b benchStats) report(rows uint32, n int64) {
+	elapsed := time.Since(b.start).Seconds()
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	allocsPerRow := 0.0
+	if rows > 0 {
+		allocsPerRow = float64(ms.Mallocs-b.mallocs) / float64(rows)
+	}
+	if elapsed <= 0 {
+		elapsed = 1e-9
+	}
+
+	fmt.Printf("  >> Bench: %d rows in %.3fs (%.0f rows/s, %.1f MB/s), %.2f allocs/row, %d GC cycles\n",
+		rows, elapsed, float64(rows)/elapsed, float64(n)/elapsed/(1<<20), allocsPerRow, ms.NumGC-b.numGC)
+
+	note := ""
+	if w := benchStages.workers.Load(); w > 1 {
+		note = fmt.Sprintf(", summed over %d workers", w)
+	}
+	stageRate("parse ", time.Duration(benchStages.parse.Load()), rows, n, note)
+	stageRate("encode", time.Duration(benchStages.encode.Load()), rows, benchStages.output.Load(), note)
+}
+
+// stageRate prints the throughput of one stage over its own time; n is the
+// bytes it consumed (parse) or produced (encode)
+func stageRate(stage string, d time.Duration, rows uint32, n int64, note string) {
+	if d <= 0 {
+		return
+	}
+	sec := d.Seconds()
+	fmt.Printf("  >> Bench %s: %.3fs (%.0f rows/s, %.1f MB/s%s)\n", stage, sec, float64(rows)/sec, float64(n)/sec/(1<<20), note)
+}
+
+// benchTimes splits a -bench run into its stages: parse decodes records
+// into fields (rowBuilder.build), encode quotes them and writes them in the
+// output encoding and format. Parallel workers add to it concurrently.
+// Reading the table happens in the background and is in neither stage.
+type benchTimes struct {
+	parse   atomic.Int64 // nanoseconds
+	encode  atomic.Int64
+	output  atomic.Int64 // bytes written, to io.Discard
+	workers atomic.Int64
+}
+
+// benchStages are the stage times of the current table
+var benchStages benchTimes
+
+func (t *benchTimes) reset() {
+	t.parse.Store(0)
+	t.encode.Store(0)
+	t.output.Store(0)
+	t.workers.Store(0)
+}
+
+// Write counts the output of a -bench run and discards it
+func (t *benchTimes) Write(p []byte) (int, error) {
+	t.output.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// since adds the time since start to a stage
+func since(stage *atomic.Int64, start time.Time) {
+	stage.Add(int64(time.Since(start)))
+}
+
+// benchRowWriter times the rows written to w as the encode stage
+type benchRowWriter struct {
+	w rowWriter
+}
+
+// timeWrites returns w, timed as the encode stage with -bench
+func timeWrites(w rowWriter) rowWriter {
+	if !flagBench {
+		return w
+	}
+	return benchRowWriter{w}
+}
+
+func (b benchRowWriter) Write(row []string) error {
+	defer since(&benchStages.encode, time.Now())
+	return b.w.Write(row)
+}
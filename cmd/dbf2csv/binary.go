@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Representations of binary data in the CSV (-binary)
+const (
+	binaryHex    = "hex"
+	binaryBase64 = "base64"
+	binarySkip   = "skip" // leave the cell empty
+)
+
+// isBinaryMemo reports whether f keeps binary data in the memo file: a
+// FoxPro Picture, a VFP Blob, or a memo declared NOCPTRANS
+func isBinaryMemo(f FieldInfo) bool {
+	return f.Type == 'P' || f.Type == 'W' || f.Type == 'M' && f.Flags&fieldFlagBinary != 0
+}
+
+// appendBinary appends data to dst as -binary says
+func appendBinary(dst, data []byte) []byte {
+	switch flagBinary {
+	case binarySkip:
+		return dst
+	case binaryBase64:
+		return base64.StdEncoding.AppendEncode(dst, data)
+	}
+	return hex.AppendEncode(dst, data)
+}
+
+// decodeBinary reverses appendBinary, for outputs with a binary type
+func decodeBinary(cell string) ([]byte, error) {
+	if flagBinary == binaryBase64 {
+		return base64.StdEncoding.DecodeString(cell)
+	}
+	return hex.DecodeString(cell)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cacheFormat is bumped whenever the decoded representation changes, so
+// stale cache entries are never reused
+const cacheFormat = 3
+
+// cacheHeader starts every cache file
+type cacheHeader struct {
+	Format  int
+	Fields  []FieldInfo
+	NumRecs uint32
+}
+
+// cachedRecord is one decoded record. All records are cached, deleted or
+// not, so later runs can apply a different -deleted policy.
+type cachedRecord struct {
+	Deleted bool
+	Row     []string
+}
+
+// cacheKey identifies the decoded content of a table: the DBF and memo bytes
+// plus everything that influences decoding
+func cacheKey(dbfPath, memoPath string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "format=%d encoding=%s decrypt=%s lenient=%t clipper=%t typed=%t date=%s datetime=%s tz=%v bool=%s/%s null=%q currency=%d/%t/%t trim=%s binary=%s\n", cacheFormat, encodingKey(flagEncoding), flagDecrypt, flagLenient, flagClipper, flagTypedCSV, dateLayout, dateTimeLayout, dateTimeZone, boolTrue, boolFalse, flagNull, currencyDec, currencyTrim, currencyGrouped, flagTrim, flagBinary)
+
+	for _, p := range []string{dbfPath, memoPath} {
+		if p == "" {
+			continue
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// encodingKey returns a canonical name for the -e encoding
+func encodingKey(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "gbk", "gb2312", "gb18030":
+		return "gb18030"
+	default:
+		return "utf-8"
+	}
+}
+
+func cachePath(key string) string {
+	return filepath.Join(flagCache, key+".gob")
+}
+
+// cacheWriter records decoded rows into a new cache file. The file only
+// appears under its final name once commit succeeds.
+type cacheWriter struct {
+	f    *os.File
+	path string
+	bw   *bufio.Writer
+	enc  *gob.Encoder
+	err  error
+}
+
+func createCache(path string, h DBFHeader, fields []FieldInfo) (*cacheWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".cache-*")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cacheWriter{f: f, path: path, bw: bufio.NewWriterSize(f, 1024*1024)}
+	c.enc = gob.NewEncoder(c.bw)
+	if err := c.enc.Encode(cacheHeader{Format: cacheFormat, Fields: fields, NumRecs: h.NumRecs}); err != nil {
+		c.abort()
+		return nil, err
+	}
+	return c, nil
+}
+
+// add appends a record; the first error is kept and reported by commit
+func (c *cacheWriter) add(deleted bool, row []string) {
+	if c.err == nil {
+		c.err = c.enc.Encode(cachedRecord{Deleted: deleted, Row: row})
+	}
+}
+
+func (c *cacheWriter) commit() error {
+	if c.err == nil {
+		c.err = c.bw.Flush()
+	}
+	if cerr := c.f.Close(); c.err == nil {
+		c.err = cerr
+	}
+	if c.err != nil {
+		os.Remove(c.f.Name())
+		return c.err
+	}
+	return os.Rename(c.f.Name(), c.path)
+}
+
+func (c *cacheWriter) abort() {
+	c.f.Close()
+	os.Remove(c.f.Name())
+}
+
+// exportFromCache writes the cached rows of a table, skipping charset
+// decoding and field parsing entirely
+func exportFromCache(ctx context.Context, path string, w rowWriter, fields []FieldInfo, recLen int, progress *progressReporter) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(bufio.NewReaderSize(f, 1024*1024))
+	var hdr cacheHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return 0, fmt.Errorf("failed to read cache: %w", err)
+	}
+	if hdr.Format != cacheFormat || len(hdr.Fields) != len(fields) {
+		return 0, fmt.Errorf("cache %s does not match the table", path)
+	}
+
+	var processed, filtered uint32
+	var rec cachedRecord
+	flag := []byte{' '}
+	for {
+		if processed%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return processed, fmt.Errorf("stopped after %d records: %w", processed, err)
+			}
+		}
+
+		// gob skips zero values, so reset the record before decoding into it
+		rec = cachedRecord{Row: rec.Row[:0]}
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return processed, fmt.Errorf("failed to read cache: %w", err)
+		}
+		processed++
+
+		flag[0] = ' '
+		if rec.Deleted {
+			flag[0] = '*'
+		}
+		if exportRecord(flag) {
+			if err := w.Write(withStatus(rec.Row, flag)); err != nil {
+				return processed, err
+			}
+		} else {
+			filtered++
+		}
+		progress.update(processed, int64(processed)*int64(recLen))
+	}
+
+	finishRecords(progress, processed, filtered, recLen)
+	return processed, nil
+}
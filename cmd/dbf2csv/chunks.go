@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/text/transform"
+)
+
+// chunkPath returns the path of chunk n of a -split-rows export:
+// data.csv -> data_001.csv, data.csv.gz -> data_001.csv.gz
+func chunkPath(csvPath string, n int) string {
+	ext := outputExts[outputFormat] + compressExts[flagCompress]
+	return fmt.Sprintf("%s_%03d%s", strings.TrimSuffix(csvPath, ext), n, ext)
+}
+
+// chunkWriter writes the rows of an export to CSV files of at most
+// flagSplitRows records each. The first row written is the header, repeated
+// at the top of every chunk; each chunk gets the BOM and sep line too.
+type chunkWriter struct {
+	path   string // the unsplit CSV path the chunk names derive from
+	comma  rune
+	recLen int
+	header []string
+	n      int // current chunk
+	rows   int // records in the current chunk
+	file   *os.File
+	zw     io.WriteCloser
+	buf    *bufio.Writer
+	cw     *csvWriter
+	paths  []string // chunks created so far
+	limit  *throttle
+}
+
+func newChunkWriter(csvPath string, comma rune, recLen int, limit *throttle) *chunkWriter {
+	return &chunkWriter{path: csvPath, comma: comma, recLen: recLen, limit: limit}
+}
+
+func (c *chunkWriter) Write(row []string) error {
+	if c.header == nil {
+		c.header = append([]string(nil), row...)
+		return c.open()
+	}
+	if c.rows == flagSplitRows {
+		if err := c.Close(); err != nil {
+			return err
+		}
+		if err := c.open(); err != nil {
+			return err
+		}
+	}
+	c.rows++
+	return c.cw.Write(row)
+}
+
+func (c *chunkWriter) Flush() {
+	if c.cw != nil {
+		c.cw.Flush()
+	}
+}
+
+// open starts the next chunk with the header row
+func (c *chunkWriter) open() (err error) {
+	c.n++
+	path := chunkPath(c.path, c.n)
+	c.file, err = os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV: %w", err)
+	}
+	c.paths = append(c.paths, path)
+	c.rows = 0
+
+	if c.zw, err = newCompressor(throttleWriter(c.file, c.limit)); err != nil {
+		return fmt.Errorf("failed to create CSV: %w", err)
+	}
+	if flagBOM {
+		bom, _ := outputEncoding.NewEncoder().String("\uFEFF")
+		if _, err := io.WriteString(c.zw, bom); err != nil {
+			return err
+		}
+	}
+	c.buf = bufio.NewWriterSize(transform.NewWriter(c.zw, outputEncoding.NewEncoder()), bufferSize(c.recLen))
+	c.cw = newCSVWriter(c.buf, c.comma)
+	if flagSepLine {
+		if err := c.cw.WriteSepLine(); err != nil {
+			return err
+		}
+	}
+	return c.cw.Write(c.header)
+}
+
+// Close finishes the current chunk
+func (c *chunkWriter) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	c.cw.Flush()
+	err := c.buf.Flush()
+	if cerr := c.zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	c.file = nil
+	return err
+}
+
+// remove deletes the chunks written so far
+func (c *chunkWriter) remove() {
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+	for _, path := range c.paths {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Output compression (-compress)
+const (
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+// compressExts are the extensions added to compressed output files
+var compressExts = map[string]string{compressGzip: ".gz", compressZstd: ".zst"}
+
+// newCompressor wraps w in the -compress compressor. Close must be called
+// to write the end of the stream; it does not close w.
+func newCompressor(w io.Writer) (io.WriteCloser, error) {
+	switch flagCompress {
+	case compressGzip:
+		return gzip.NewWriter(w), nil
+	case compressZstd:
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
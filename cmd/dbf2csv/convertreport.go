@@ -0,0 +1,43 @@
+package main
+
+import "fmt"
+
+// convertConsoleLimit caps the unconvertible cells listed on the console
+const convertConsoleLimit = 10
+
+// convertFailure is a cell a typed output format could not hold
+type convertFailure struct {
+	row    int
+	column int
+	value  string
+}
+
+// convertReport collects the cells that the Parquet and Avro writers could
+// not convert to their column type and wrote as null
+type convertReport struct {
+	names    []string // column names, from the header row
+	count    int
+	failures []convertFailure
+}
+
+// add records a failed cell; only the first few are kept
+func (c *convertReport) add(row, column int, value string) {
+	c.count++
+	if len(c.failures) < convertConsoleLimit {
+		c.failures = append(c.failures, convertFailure{row: row, column: column, value: value})
+	}
+}
+
+// finish prints the failures, if any
+func (c *convertReport) finish(format string) {
+	if c.count == 0 {
+		return
+	}
+	warnf("%d cells could not be converted to their %s type and were written as null", c.count, format)
+	for _, f := range c.failures {
+		fmt.Printf("    row %d, column %d (%s): %q\n", f.row, f.column+1, c.names[f.column], f.value)
+	}
+	if c.count > len(c.failures) {
+		fmt.Printf("    ... and %d more\n", c.count-len(c.failures))
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Quoting policies for -quoting
+const (
+	quoteMinimal = "minimal" // only fields that need it
+	quoteAlways  = "always"  // every field, empty ones included
+	quoteNone    = "none"    // never; fields that would need it are an error
+)
+
+// quoteChar, quoting and newline are the -q quote character, -quoting
+// policy and -l line ending, set once at startup
+var (
+	quoteChar = '"'
+	quoting   = quoteMinimal
+	newline   = "\n"
+)
+
+// lineEndings are the -l values accepted, with their display names
+var lineEndings = map[string]string{"\n": "LF", "\r\n": "CRLF", "\r": "CR"}
+
+// parseNewline resolves -l, given either escaped ("\r\n") or as the literal
+// characters, to one of the supported line endings
+func parseNewline(s string) (string, error) {
+	nl := strings.NewReplacer(`\r`, "\r", `\n`, "\n").Replace(s)
+	if _, ok := lineEndings[nl]; !ok {
+		return "", fmt.Errorf("invalid line ending %q (use \\n, \\r\\n or \\r)", s)
+	}
+	return nl, nil
+}
+
+// csvWriter writes CSV records like encoding/csv.Writer, which always
+// quotes with '"', but with the quote character from -q. Output with the
+// default quote is identical to encoding/csv.
+type csvWriter struct {
+	Comma   rune
+	Quote   rune
+	Quoting string
+	Newline string
+	w       *bufio.Writer
+}
+
+func newCSVRecordWriter(w io.Writer, comma, quote rune) *csvWriter {
+	return &csvWriter{Comma: comma, Quote: quote, Quoting: quoteMinimal, Newline: "\n", w: bufio.NewWriter(w)}
+}
+
+// Write writes one record; quote characters inside fields are doubled
+func (cw *csvWriter) Write(record []string) error {
+	for n, field := range record {
+		if n > 0 {
+			if _, err := cw.w.WriteRune(cw.Comma); err != nil {
+				return err
+			}
+		}
+
+		quoted := cw.Quoting == quoteAlways
+		if !quoted && cw.fieldNeedsQuotes(field) {
+			if cw.Quoting == quoteNone && cw.fieldBreaksRecord(field) {
+				return fmt.Errorf("column %d %q contains the delimiter or a line break and cannot be written with -quoting none", n+1, field)
+			}
+			quoted = cw.Quoting != quoteNone
+		}
+		if !quoted {
+			if _, err := cw.w.WriteString(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := cw.w.WriteRune(cw.Quote); err != nil {
+			return err
+		}
+		for len(field) > 0 {
+			// Copy everything up to the next special character in one go
+			i := strings.IndexFunc(field, func(r rune) bool { return r == cw.Quote || r == '\r' || r == '\n' })
+			if i < 0 {
+				i = len(field)
+			}
+			if _, err := cw.w.WriteString(field[:i]); err != nil {
+				return err
+			}
+			field = field[i:]
+			if len(field) == 0 {
+				break
+			}
+
+			r, size := utf8.DecodeRuneInString(field)
+			var err error
+			switch r {
+			case cw.Quote:
+				if _, err = cw.w.WriteRune(r); err == nil {
+					_, err = cw.w.WriteRune(r)
+				}
+			case '\r':
+				// With CRLF output, line breaks inside fields become CRLF too
+				if cw.Newline != "\r\n" {
+					err = cw.w.WriteByte('\r')
+				}
+			case '\n':
+				if cw.Newline == "\r\n" {
+					_, err = cw.w.WriteString("\r\n")
+				} else {
+					err = cw.w.WriteByte('\n')
+				}
+			}
+			field = field[size:]
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := cw.w.WriteRune(cw.Quote); err != nil {
+			return err
+		}
+	}
+
+	_, err := cw.w.WriteString(cw.Newline)
+	return err
+}
+
+// WriteSepLine writes the "sep=," line Excel reads the delimiter from
+func (cw *csvWriter) WriteSepLine() error {
+	if _, err := cw.w.WriteString("sep="); err != nil {
+		return err
+	}
+	if _, err := cw.w.WriteRune(cw.Comma); err != nil {
+		return err
+	}
+	_, err := cw.w.WriteString(cw.Newline)
+	return err
+}
+
+// Flush writes any buffered data to the underlying io.Writer
+func (cw *csvWriter) Flush() {
+	cw.w.Flush()
+}
+
+// Error reports any error from a previous Write or Flush
+func (cw *csvWriter) Error() error {
+	_, err := cw.w.Write(nil)
+	return err
+}
+
+// fieldNeedsQuotes follows encoding/csv: empty fields are bare; fields with
+// the delimiter, the quote, \r or \n, a leading space, or equal to `\.` are quoted
+func (cw *csvWriter) fieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` {
+		return true
+	}
+	for _, r := range field {
+		if r == cw.Comma || r == cw.Quote || r == '\r' || r == '\n' {
+			return true
+		}
+	}
+	r1, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r1)
+}
+
+// fieldBreaksRecord reports whether an unquoted field would be read back as
+// more than one field or record. Quote characters and leading spaces are
+// harmless when nothing is quoted.
+func (cw *csvWriter) fieldBreaksRecord(field string) bool {
+	return strings.ContainsRune(field, cw.Comma) || strings.ContainsAny(field, "\r\n")
+}
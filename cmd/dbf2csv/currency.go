@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Currency (Y) output settings from -currency
+var (
+	currencyDec     = 4  // decimal places, 0-4
+	currencyTrim    bool // strip trailing zeros after the point
+	currencyGrouped bool // 1,234,567.89 style thousands separators
+)
+
+// setCurrencyFormat parses -currency: comma separated options, a number of
+// decimal places (0-4), "trim" and/or "grouped", e.g. "2,grouped"
+func setCurrencyFormat(spec string) error {
+	for _, opt := range strings.Split(spec, ",") {
+		opt = strings.ToLower(strings.TrimSpace(opt))
+		switch opt {
+		case "":
+		case "trim":
+			currencyTrim = true
+		case "grouped":
+			currencyGrouped = true
+		default:
+			n, err := strconv.Atoi(opt)
+			if err != nil || n < 0 || n > 4 {
+				return fmt.Errorf("invalid currency option '%s' (expected 0-4, trim or grouped)", opt)
+			}
+			currencyDec = n
+		}
+	}
+	return nil
+}
+
+// appendCurrency formats a Y value (an integer count of 1/10000 units)
+// exactly, without going through float64, rounding half away from zero
+func appendCurrency(dst []byte, val int64) []byte {
+	neg := val < 0
+	u := uint64(val)
+	if neg {
+		u = -u
+	}
+
+	// Round to currencyDec places
+	scale := uint64(1)
+	for i := currencyDec; i < 4; i++ {
+		scale *= 10
+	}
+	u = (u + scale/2) / scale * scale
+
+	whole, frac := u/10000, u%10000
+	if neg && u != 0 {
+		dst = append(dst, '-')
+	}
+
+	digits := strconv.AppendUint(nil, whole, 10)
+	if currencyGrouped {
+		for i, c := range digits {
+			if i > 0 && (len(digits)-i)%3 == 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(dst, c)
+		}
+	} else {
+		dst = append(dst, digits...)
+	}
+
+	if currencyDec == 0 {
+		return dst
+	}
+	var fracDigits [4]byte
+	for i := 3; i >= 0; i-- {
+		fracDigits[i] = byte('0' + frac%10)
+		frac /= 10
+	}
+	out := fracDigits[:currencyDec]
+	if currencyTrim {
+		out = []byte(strings.TrimRight(string(out), "0"))
+		if len(out) == 0 {
+			return dst
+		}
+	}
+	dst = append(dst, '.')
+	return append(dst, out...)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	_ "time/tzdata" // -tz must work on Windows, which has no zoneinfo database
+)
+
+// dateLayout and dateTimeLayout are the Go layouts used for D and T fields.
+// They are set once at startup from -datefmt and -typed-csv.
+var (
+	dateLayout     = "2006-01-02"
+	dateTimeLayout = "2006-01-02 15:04:05"
+)
+
+// dateTimeZone is the -tz zone DateTime values are converted to, or nil to
+// emit the stored wall time unchanged
+var dateTimeZone *time.Location
+
+// parseZone resolves a -tz value: "local", "UTC" or an IANA zone name
+func parseZone(name string) (*time.Location, error) {
+	if strings.EqualFold(name, "local") {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone '%s'", name)
+	}
+	return loc, nil
+}
+
+// strftimeLayouts maps strftime directives to Go layout elements
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'b': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'%': "%",
+}
+
+// parseDateFormat turns a -datefmt value into a Go layout. Values containing
+// '%' are strftime-like patterns (%d/%m/%Y); anything else is a Go layout.
+func parseDateFormat(spec string) (string, error) {
+	if !strings.Contains(spec, "%") {
+		if time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC).Format(spec) == spec {
+			return "", fmt.Errorf("date format '%s' has no date elements", spec)
+		}
+		return spec, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			b.WriteByte(spec[i])
+			continue
+		}
+		if i+1 == len(spec) {
+			return "", fmt.Errorf("date format '%s' ends with a lone '%%'", spec)
+		}
+		i++
+		layout, ok := strftimeLayouts[spec[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported directive '%%%c' in date format '%s'", spec[i], spec)
+		}
+		b.WriteString(layout)
+	}
+	return b.String(), nil
+}
+
+// setDateLayouts applies -datefmt and -typed-csv (or JSON output) to the D
+// and T layouts
+func setDateLayouts(datefmt string) error {
+	if datefmt != "" {
+		layout, err := parseDateFormat(datefmt)
+		if err != nil {
+			return err
+		}
+		dateLayout = layout
+	}
+
+	sep := " "
+	if flagTypedCSV || outputFormat == formatJSON || outputFormat == formatNDJSON {
+		sep = "T"
+	}
+	dateTimeLayout = dateLayout + sep + "15:04:05"
+	if flagRFC3339 {
+		dateTimeLayout = time.RFC3339
+	}
+	return nil
+}
+
+// parseDBFDate parses the YYYYMMDD text of a D field
+func parseDBFDate(raw []byte) (time.Time, bool) {
+	var ymd [3]int
+	digits := [3][]byte{raw[0:4], raw[4:6], raw[6:8]}
+	for i, part := range digits {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return time.Time{}, false
+			}
+			ymd[i] = ymd[i]*10 + int(c-'0')
+		}
+	}
+	t := time.Date(ymd[0], time.Month(ymd[1]), ymd[2], 0, 0, 0, 0, time.UTC)
+	if t.Month() != time.Month(ymd[1]) || t.Day() != ymd[2] {
+		return time.Time{}, false // e.g. 20240231
+	}
+	return t, true
+}
+
+// parseDateCell reverses the D field formatting for typed outputs: the
+// number of days since 1970-01-01
+func parseDateCell(cell string) (int32, bool) {
+	t, err := time.Parse(dateLayout, cell)
+	if err != nil {
+		return 0, false
+	}
+	return int32(math.Floor(float64(t.Unix()) / 86400)), true
+}
+
+// parseDateTimeCell reverses the T field formatting for typed outputs:
+// milliseconds since the Unix epoch, reading zoneless values in the -tz
+// zone (UTC by default)
+func parseDateTimeCell(cell string) (int64, bool) {
+	loc := dateTimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, cell, loc)
+	if err != nil {
+		return 0, false
+	}
+	return t.UnixMilli(), true
+}
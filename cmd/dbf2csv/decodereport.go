@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// decodeConsoleLimit caps the decode failures listed on the console; the
+// -decode-report file lists them all
+const decodeConsoleLimit = 10
+
+// decodeSampleLen is how many raw bytes of a failed cell are reported
+const decodeSampleLen = 16
+
+// decodeFailure is a cell whose bytes are not valid text in the table
+// encoding: they were replaced with U+FFFD, or written undecoded
+type decodeFailure struct {
+	record uint32
+	column int
+	field  string
+	offset int64 // of the cell in the record
+	sample []byte
+}
+
+// decodeReport collects the decode failures of an export. Workers of a
+// parallel export add to it concurrently.
+type decodeReport struct {
+	mu        sync.Mutex
+	written   bool // the -decode-report file was started by an earlier table
+	headerLen int64
+	recLen    int64
+	count     int
+	failures  []decodeFailure
+}
+
+// decodeErrors is the report of the current export
+var decodeErrors decodeReport
+
+// reset starts the report of a table
+func (d *decodeReport) reset(h DBFHeader) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.headerLen, d.recLen = int64(h.HeaderLen), int64(h.RecLen)
+	d.count = 0
+	d.failures = d.failures[:0]
+}
+
+// add records a failed cell; only the first few are kept without a report file
+func (d *decodeReport) add(record uint32, column int, f FieldInfo, raw []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count++
+	if flagDecodeReport == "" && len(d.failures) >= decodeConsoleLimit {
+		return
+	}
+	raw = bytes.TrimSpace(raw)
+	d.failures = append(d.failures, decodeFailure{
+		record: record,
+		column: column,
+		field:  f.Name,
+		offset: int64(f.Offset),
+		sample: append([]byte(nil), raw[:min(len(raw), decodeSampleLen)]...),
+	})
+}
+
+// fileOffset returns the offset of a failed cell in the table file
+func (d *decodeReport) fileOffset(f decodeFailure) int64 {
+	return d.headerLen + int64(f.record-1)*d.recLen + f.offset
+}
+
+// finish prints the failures of the table and writes them to the
+// -decode-report file, which collects the tables of a run
+func (d *decodeReport) finish(table, enc string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.count == 0 {
+		return nil
+	}
+	// Parallel workers add out of order
+	sort.Slice(d.failures, func(i, j int) bool {
+		a, b := d.failures[i], d.failures[j]
+		return a.record < b.record || a.record == b.record && a.column < b.column
+	})
+
+	warnf("%d cells have bytes that are not valid %s", d.count, strings.ToUpper(enc))
+	for _, f := range d.failures[:min(len(d.failures), decodeConsoleLimit)] {
+		fmt.Printf("    record %d, column %d (%s), offset %d: % x\n", f.record, f.column, f.field, d.fileOffset(f), f.sample)
+	}
+	if flagDecodeReport == "" {
+		if d.count > decodeConsoleLimit {
+			fmt.Printf("    ... see -decode-report for all of them\n")
+		}
+		return nil
+	}
+
+	mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if d.written {
+		mode = os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(flagDecodeReport, mode, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open decode report: %w", err)
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	if !d.written {
+		w.Write([]string{"table", "record", "column", "field", "offset", "bytes"})
+		d.written = true
+	}
+	for _, f := range d.failures {
+		w.Write([]string{
+			table,
+			strconv.FormatUint(uint64(f.record), 10),
+			strconv.Itoa(f.column),
+			f.field,
+			strconv.FormatInt(d.fileOffset(f), 10),
+			hex.EncodeToString(f.sample),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write decode report: %w", err)
+	}
+	fmt.Printf("  >> Decode report: %s\n", flagDecodeReport)
+	return file.Close()
+}
+
+// validText reports whether a decoded cell is clean UTF-8 without the
+// U+FFFD a decoder substitutes for bytes it cannot decode
+func validText(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return utf8.Valid(b) && !bytes.Contains(b, []byte("\uFFFD"))
+		}
+	}
+	return true
+}
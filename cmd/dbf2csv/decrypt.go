@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// decrypter restores one raw record in place; recNo is the 0-based record
+// index, for schemes that vary the key per record. The deletion flag
+// (byte 0) is passed too but is never scrambled by the known schemes.
+type decrypter func(recNo uint32, record []byte)
+
+// decrypters holds the available -decrypt schemes by name. Each factory
+// receives the text after "name:" and returns the record decrypter.
+var decrypters = map[string]func(arg string) (decrypter, error){
+	"xor": newXORDecrypter,
+}
+
+// recordDecrypter is the decrypter selected with -decrypt, or nil
+var recordDecrypter decrypter
+
+// parseDecrypt resolves a "-decrypt scheme:argument" value
+func parseDecrypt(spec string) (decrypter, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	factory, ok := decrypters[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown decryption scheme '%s'", name)
+	}
+	return factory(arg)
+}
+
+// newXORDecrypter XORs the record data (after the deletion flag) with a
+// repeating key given in hex, restarting the key at every record
+func newXORDecrypter(arg string) (decrypter, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(arg), "0x"))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("invalid xor key '%s' (expected hex, e.g. xor:5A3C)", arg)
+	}
+	return func(recNo uint32, record []byte) {
+		data := record[1:]
+		for i := range data {
+			data[i] ^= key[i%len(key)]
+		}
+	}, nil
+}
+
+// isEncrypted reports whether the dBASE IV encryption flag (byte 15) is set
+func isEncrypted(h DBFHeader) bool {
+	return h.Reserved[15-12] != 0
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// versionNames describes the common DBF version bytes
+var versionNames = map[byte]string{
+	0x02: "FoxBASE",
+	0x03: "dBase III / FoxPro",
+	0x04: "dBase 7",
+	0x30: "Visual FoxPro",
+	0x31: "Visual FoxPro (autoincrement)",
+	0x32: "Visual FoxPro (varchar/varbinary)",
+	0x83: "dBase III with memo",
+	0x8B: "dBase IV with memo",
+	0x8C: "dBase 7 with memo",
+	0xF5: "FoxPro 2.x with memo",
+}
+
+// explainConversion prints the plan for -explain: how the table will be
+// read, how each field maps to a CSV column, and where the output goes
+func explainConversion(dbfPath, csvPath string, h DBFHeader, fields []FieldInfo, memoPath string, comma rune) {
+	names := headerNames(fields)
+	version := versionNames[h.Version]
+	if version == "" {
+		version = "unknown"
+	}
+
+	fmt.Println("  Plan:")
+	fmt.Printf("    Input     : %s (0x%02X %s, %d records of %d bytes)\n", dbfPath, h.Version, version, h.NumRecs, h.RecLen)
+	if outputFormat != formatCSV && outputFormat != formatSQLite {
+		fmt.Printf("    Encoding  : DBF %s -> %s UTF-8\n", strings.ToUpper(flagEncoding), strings.ToUpper(outputFormat))
+	} else if strings.EqualFold(flagOutEncoding, flagEncoding) {
+		fmt.Printf("    Encoding  : %s (text decoded from and CSV written in this encoding)\n", strings.ToUpper(flagEncoding))
+	} else {
+		fmt.Printf("    Encoding  : DBF %s -> CSV %s\n", strings.ToUpper(flagEncoding), strings.ToUpper(flagOutEncoding))
+	}
+	if cp := h.CodePage(); cp != 0 {
+		fmt.Printf("    Code page : %d (declared by the table)\n", cp)
+	}
+	if memoPath != "" {
+		fmt.Printf("    Memo      : %s\n", memoPath)
+	} else if hasMemoFields(fields) {
+		fmt.Println("    Memo      : not found (memo columns hold [MEMO/OLE])")
+	}
+	if flagDecrypt != "" {
+		fmt.Printf("    Decrypt   : %s\n", flagDecrypt)
+	}
+	switch flagDeleted {
+	case "skip":
+		fmt.Println("    Records   : active only (deleted records skipped)")
+	case "only":
+		fmt.Println("    Records   : deleted only")
+	default:
+		fmt.Println("    Records   : all, including deleted")
+	}
+
+	if flagBench {
+		fmt.Println("    Output    : none (benchmark mode)")
+	} else if sqlitePath != "" {
+		fmt.Printf("    Output    : %s (SQLite table %s)\n", sqlitePath, tableName(dbfPath))
+	} else if flagSplitRows > 0 {
+		fmt.Printf("    Output    : %s, %s, ... (%d records each)\n", chunkPath(csvPath, 1), chunkPath(csvPath, 2), flagSplitRows)
+	} else {
+		fmt.Printf("    Output    : %s\n", csvPath)
+	}
+	var extras string
+	if flagBOM {
+		extras += ", byte order mark"
+	}
+	if flagSepLine {
+		extras += ", sep= line"
+	}
+	if outputFormat == formatCSV {
+		fmt.Printf("    Dialect   : delimiter %s, quote %s (%s), %s line endings, header row%s\n", strconv.QuoteRune(comma), strconv.QuoteRune(quoteChar), quoting, lineEndings[newline], extras)
+	}
+	if flagJobs > 1 {
+		fmt.Printf("    Workers   : %d\n", flagJobs)
+	}
+	if flagCache != "" {
+		fmt.Printf("    Cache     : %s\n", flagCache)
+	}
+
+	fmt.Println("    Columns   :")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "      #\tFIELD\tTYPE\tLEN\tDEC\t\tCOLUMN\tCONVERSION")
+	for i, name := range names {
+		f := fields[i]
+		desc := describeConversion(f, memoPath != "")
+		if f.NullAt > 0 {
+			desc += fmt.Sprintf(", NULL as %q", flagNull)
+		}
+		fmt.Fprintf(tw, "      %d\t%s\t%c\t%d\t%d\t->\t%s\t%s\n", i+1, f.Name, f.Type, f.Length, f.Dec, name, desc)
+	}
+	if flagDeletedColumn {
+		fmt.Fprintf(tw, "      %d\t(flag)\t\t\t\t->\t_DELETED\tdeletion flag as %s/%s\n", len(fields)+1, logicalText(true), logicalText(false))
+	}
+	if joinTable != nil {
+		n := len(fields) + 1
+		if flagDeletedColumn {
+			n++
+		}
+		for i, name := range joinTable.names {
+			fmt.Fprintf(tw, "      %d\t(join)\t\t\t\t->\t%s\tfrom %s, matched on %s\n", n+i, name, joinTable.path, joinTable.field)
+		}
+	}
+	tw.Flush()
+}
+
+// describeConversion explains how values of a field are written to CSV
+func describeConversion(f FieldInfo, hasMemo bool) string {
+	switch f.Type {
+	case 'I', '+':
+		if f.Type == '+' || f.Flags&fieldFlagAutoInc != 0 {
+			return fmt.Sprintf("autoincrement (next %d, step %d), 32-bit integer", f.AutoNext, f.AutoStep)
+		}
+		return "32-bit integer"
+	case 'O':
+		return "double, shortest form"
+	case '@':
+		if dateTimeZone != nil {
+			return fmt.Sprintf("timestamp UTC -> %s as %s", dateTimeZone, dateTimeLayout)
+		}
+		return "timestamp as " + dateTimeLayout
+	case 'Y':
+		desc := fmt.Sprintf("currency, %d decimals", currencyDec)
+		if currencyTrim {
+			desc += ", trailing zeros trimmed"
+		}
+		if currencyGrouped {
+			desc += ", grouped"
+		}
+		return desc
+	case 'B':
+		return "double, shortest form"
+	case 'T':
+		if dateTimeZone != nil {
+			return fmt.Sprintf("datetime UTC -> %s as %s", dateTimeZone, dateTimeLayout)
+		}
+		return "datetime as " + dateTimeLayout
+	case 'D':
+		return "date YYYYMMDD as " + dateLayout
+	case 'L':
+		return fmt.Sprintf("logical as %s/%s", logicalText(true), logicalText(false))
+	case 'P':
+		if hasMemo && flagOLEDir != "" {
+			return "picture extracted to " + flagOLEDir + ", path"
+		}
+		if hasMemo {
+			return "picture as " + flagBinary
+		}
+		return "placeholder [MEMO/OLE]"
+	case 'M', 'W':
+		if hasMemo && isBinaryMemo(f) {
+			return "binary memo as " + flagBinary
+		}
+		if hasMemo {
+			return "memo text from memo file"
+		}
+		return "placeholder [MEMO/OLE]"
+	case 'G':
+		if hasMemo && flagOLEDir != "" {
+			return "object extracted to " + flagOLEDir + ", path"
+		}
+		return "placeholder [MEMO/OLE]"
+	case 'V':
+		return "varchar, actual length"
+	case 'Q':
+		return "varbinary as " + flagBinary
+	case 'F', 'N':
+		if flagTypedCSV {
+			return "number, trimmed (overflow markers blanked)"
+		}
+		return "number, trimmed"
+	}
+	switch flagTrim {
+	case "none":
+		return "text, padding kept"
+	case "right":
+		return "text, right-trimmed"
+	}
+	return "text, trimmed"
+}
@@ -0,0 +1,9 @@
+package main
+
+// VFP field flags (descriptor byte 18)
+const (
+	fieldFlagSystem   = 0x01
+	fieldFlagNullable = 0x02
+	fieldFlagBinary   = 0x04 // not translated between code pages (binary memo, Varbinary)
+	fieldFlagAutoInc  = 0x08 // autoincrement Integer
+)
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+
+	"github.com/dabiaoge/csv2dbf/dbf"
+)
+
+// rowBuilder turns raw DBF records into CSV rows with as few allocations as
+// possible: every field of a record is appended into one reusable scratch
+// buffer, converted to a string once, and the row cells are sliced from it.
+type rowBuilder struct {
+	fields  []FieldInfo
+	decoder *encoding.Decoder
+	memo    *memoFile // nil when the table has no memo file
+	report  bool      // add cells that fail to decode to decodeErrors
+	timed   bool      // add the build time to the -bench parse stage
+	memoRaw []byte    // the memo data of the last M field
+	scratch []byte
+	bounds  []int
+	row     []string
+}
+
+func newRowBuilder(fields []FieldInfo, enc encoding.Encoding, recLen int, memo *memoFile) *rowBuilder {
+	return &rowBuilder{
+		fields:  fields,
+		decoder: enc.NewDecoder(),
+		memo:    memo,
+		report:  true,
+		timed:   flagBench,
+		scratch: make([]byte, 0, recLen*2),
+		bounds:  make([]int, len(fields)+1),
+		row:     make([]string, len(fields), len(fields)+1),
+	}
+}
+
+// build parses one record (including the deletion flag byte); recno is its
+// 1-based number. The returned slice is reused by the next call.
+func (rb *rowBuilder) build(record []byte, recno uint32) []string {
+	if rb.timed {
+		defer since(&benchStages.parse, time.Now())
+	}
+	buf := rb.scratch[:0]
+
+	for j, field := range rb.fields {
+		start := len(buf)
+		rb.bounds[j] = start
+		offset := field.Offset
+		switch {
+		case offset+field.Length > len(record):
+		case field.Null(record):
+			// VFP null: left empty, so it is written as the -null token
+		case isObject(field) && rb.memo != nil && rb.memo.ole != nil:
+			buf = rb.appendObject(buf, field.Data(record), recno, field.Name)
+		case isBinaryMemo(field) && rb.memo != nil:
+			if data, err := rb.memo.Read(dbf.MemoBlock(field.Data(record))); err == nil {
+				buf = appendBinary(buf, data)
+			}
+		case field.Type == 'M' && rb.memo != nil:
+			buf = rb.appendMemo(buf, field.Data(record))
+		default:
+			// Parse data based on VFP/DBF field types; V and Q fields
+			// come cut to their actual length
+			buf = appendFieldData(buf, field.Data(record), field, rb.decoder)
+		}
+		if rb.report && !validText(buf[start:]) {
+			raw := record[offset:min(offset+field.Length, len(record))]
+			if field.Type == 'M' {
+				raw = rb.memoRaw
+			}
+			decodeErrors.add(recno, j+1, field, raw)
+		}
+		if len(buf) == start {
+			buf = append(buf, flagNull...)
+		}
+	}
+
+	rb.bounds[len(rb.fields)] = len(buf)
+	rb.scratch = buf
+
+	line := string(buf)
+	for j := range rb.row {
+		rb.row[j] = line[rb.bounds[j]:rb.bounds[j+1]]
+	}
+	return rb.row
+}
+
+// withStatus adds the optional _DELETED column for a record to row
+func withStatus(row []string, record []byte) []string {
+	if !flagDeletedColumn {
+		return row
+	}
+	return append(row, logicalText(record[0] == '*'))
+}
+
+// boolFormats lists the -boolfmt presets (case-insensitive)
+var boolFormats = []string{"TRUE/FALSE", "true/false", "1/0", "Y/N", "T/F", "yes/no"}
+
+// boolTrue and boolFalse are how logical values are written, set once at
+// startup from -boolfmt (or -typed-csv, which implies true/false)
+var boolTrue, boolFalse = "TRUE", "FALSE"
+
+// setBoolFormat applies a -boolfmt preset; the spelling given is kept, so
+// Yes/No writes "Yes" and "No"
+func setBoolFormat(spec string) error {
+	if spec == "" {
+		if flagTypedCSV {
+			boolTrue, boolFalse = "true", "false"
+		}
+		return nil
+	}
+	for _, preset := range boolFormats {
+		if strings.EqualFold(spec, preset) {
+			boolTrue, boolFalse, _ = strings.Cut(spec, "/")
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid bool format '%s' (presets: %s)", spec, strings.Join(boolFormats, ", "))
+}
+
+// logicalText returns the CSV spelling of a logical value
+func logicalText(v bool) string {
+	if v {
+		return boolTrue
+	}
+	return boolFalse
+}
+
+// isNumber reports whether b is a plain decimal number, so -typed-csv can
+// blank out overflow markers such as "*****" instead of emitting them
+func isNumber(b []byte) bool {
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		b = b[1:]
+	}
+	digits, dot := 0, false
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' && !dot:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// appendMemo appends the decoded memo text referenced by raw.
+// Unreadable memo blocks produce an empty cell.
+func (rb *rowBuilder) appendMemo(dst []byte, raw []byte) []byte {
+	data, err := rb.memo.Read(dbf.MemoBlock(raw))
+	if err != nil {
+		return dst
+	}
+	rb.memoRaw = data
+	start := len(dst)
+	dst = appendDecoded(dst, data, rb.decoder)
+	return dst[:start+len(bytes.TrimRight(dst[start:], "\x00\x1a"))]
+}
+
+// appendObject extracts the OLE object referenced by raw to a file and
+// appends its path. Unreadable memo blocks produce an empty cell.
+func (rb *rowBuilder) appendObject(dst []byte, raw []byte, recno uint32, field string) []byte {
+	data, err := rb.memo.Read(dbf.MemoBlock(raw))
+	if err != nil {
+		return dst
+	}
+	return rb.memo.ole.extract(dst, data, recno, field)
+}
+
+// appendFieldData appends the text form of raw to dst based on DBF field type.
+// Supports VFP specific types (Integer, Currency, Double, DateTime).
+func appendFieldData(dst []byte, raw []byte, f FieldInfo, decoder *encoding.Decoder) []byte {
+	switch f.Type {
+	case 'I', '+': // Integer - VFP, Autoincrement - dBase 7
+		if v, ok := f.Int(raw); ok {
+			return strconv.AppendInt(dst, v, 10)
+		}
+		return dst
+
+	case 'B', 'O': // Double (8 bytes IEEE 754) - VFP, dBase 7
+		if v, ok := f.Float(raw); ok {
+			return strconv.AppendFloat(dst, v, 'g', -1, 64)
+		}
+		return dst
+
+	case 'Y': // Currency (8 bytes, int64 scaled by 10000) - VFP
+		if v, ok := f.Currency(raw); ok {
+			return appendCurrency(dst, v)
+		}
+		return dst
+
+	case 'T', '@': // DateTime - VFP, Timestamp - dBase 7
+		if t, ok := f.Time(raw); ok {
+			if dateTimeZone != nil {
+				t = t.In(dateTimeZone)
+			}
+			return t.AppendFormat(dst, dateTimeLayout)
+		}
+		return dst
+
+	case 'D': // Date (ASCII YYYYMMDD)
+		if len(raw) == 8 && len(bytes.TrimSpace(raw)) != 0 {
+			if dateLayout != "2006-01-02" {
+				// Invalid dates fall through to the raw text below
+				if t, ok := parseDBFDate(raw); ok {
+					return t.AppendFormat(dst, dateLayout)
+				}
+				return append(dst, bytes.TrimSpace(raw)...)
+			}
+			dst = append(dst, raw[0:4]...)
+			dst = append(dst, '-')
+			dst = append(dst, raw[4:6]...)
+			dst = append(dst, '-')
+			return append(dst, raw[6:8]...)
+		}
+		return append(dst, bytes.TrimSpace(raw)...)
+
+	case 'L': // Logical
+		if len(raw) == 1 {
+			switch raw[0] {
+			case 'Y', 'y', 'T', 't':
+				return append(dst, logicalText(true)...)
+			case 'N', 'n', 'F', 'f':
+				return append(dst, logicalText(false)...)
+			}
+		}
+		return dst
+
+	case 'V': // Varchar, already cut to its actual length - VFP
+		start := len(dst)
+		dst = appendDecoded(dst, raw, decoder)
+		return dst[:start+len(bytes.TrimRight(dst[start:], "\x00"))]
+
+	case 'Q': // Varbinary, written per -binary - VFP
+		return appendBinary(dst, raw)
+
+	case 'M', 'G', 'W', 'P': // Memo / General (OLE) / Blob / Picture
+		// Data stored in external .fpt/.dbt file.
+		// This converter only handles the main .dbf file.
+		return append(dst, "[MEMO/OLE]"...)
+
+	case 'F', 'N': // Numeric / Float (ASCII)
+		val := bytes.TrimSpace(raw)
+		if flagTypedCSV && !isNumber(val) {
+			return dst
+		}
+		return append(dst, val...)
+
+	default: // Character (C) and others
+		// Optimization: Decode first, THEN trim.
+		// Trimming raw bytes before decoding corrupts multi-byte encodings (like GBK)
+		// where a trailing byte might legally be 0x20.
+		start := len(dst)
+		dst = appendDecoded(dst, raw, decoder)
+
+		// Remove VFP null terminators, then padding as -trim says
+		val := bytes.TrimRight(dst[start:], "\x00")
+		switch flagTrim {
+		case "both":
+			val = bytes.TrimSpace(val)
+		case "right":
+			val = bytes.TrimRight(val, " ")
+		}
+		n := copy(dst[start:], val)
+		return dst[:start+n]
+	}
+}
+
+// appendDecoded decodes raw into dst, reusing the decoder instead of letting
+// transform.Bytes allocate a fresh destination per call.
+// Falls back to the raw bytes if decoding fails.
+func appendDecoded(dst []byte, raw []byte, decoder *encoding.Decoder) []byte {
+	return appendTransformed(dst, raw, decoder)
+}
+
+// appendTransformed runs src through t (a decoder or encoder) into dst.
+// On failure the untransformed src is appended instead.
+func appendTransformed(dst []byte, src []byte, t transform.Transformer) []byte {
+	// Fast path: ASCII is identical in every DBF encoding (not in UTF-16)
+	ascii := true
+	for _, c := range src {
+		if c >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return append(dst, src...)
+	}
+	return transformBytes(dst, src, t)
+}
+
+// transformBytes is appendTransformed without the ASCII fast path
+func transformBytes(dst []byte, src []byte, t transform.Transformer) []byte {
+	start := len(dst)
+	raw := src
+	t.Reset()
+	for {
+		if cap(dst)-len(dst) < len(src)*2+utf8.UTFMax {
+			grown := make([]byte, len(dst), 2*cap(dst)+len(src)*2+utf8.UTFMax)
+			copy(grown, dst)
+			dst = grown
+		}
+		nDst, nSrc, err := t.Transform(dst[len(dst):cap(dst)], src, true)
+		dst = dst[:len(dst)+nDst]
+		src = src[nSrc:]
+		if err == nil {
+			return dst
+		}
+		if !errors.Is(err, transform.ErrShortDst) {
+			return append(dst[:start], raw...)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// indexExts maps a table extension to the extension of its structural index
+var indexExts = map[string]string{
+	".dbf": ".cdx",
+	".dbc": ".dcx",
+}
+
+// Table flags (header byte 28) written by FoxPro
+const (
+	tableFlagIndex = 0x01 // has a structural .cdx
+	tableFlagMemo  = 0x02 // has a memo file
+)
+
+// findSibling returns the file next to tablePath with extension ext, trying
+// the case of the table extension first (FOO.DBF -> FOO.CDX), or ""
+func findSibling(tablePath, ext string) string {
+	tableExt := filepath.Ext(tablePath)
+	base := strings.TrimSuffix(tablePath, tableExt)
+	candidates := []string{base + ext, base + strings.ToUpper(ext)}
+	if tableExt == strings.ToUpper(tableExt) {
+		candidates[0], candidates[1] = candidates[1], candidates[0]
+	}
+	for _, c := range candidates {
+		if st, err := os.Stat(c); err == nil && !st.IsDir() {
+			return c
+		}
+	}
+	return ""
+}
+
+// checkFileSet looks at the memo and index files around a table and returns
+// warnings for anything inconsistent with the table header, so problems are
+// reported before the conversion relies on those files
+func checkFileSet(dbfPath string, h DBFHeader, fields []FieldInfo, memo *memoFile) []string {
+	var warnings []string
+	flags := h.Reserved[28-12]
+	isFox := h.Version == 0x30 || h.Version == 0x31 || h.Version == 0x32 || h.Version == 0xF5
+
+	// Memo file
+	switch {
+	case hasMemoFields(fields) && memo == nil:
+		warnings = append(warnings, "table has memo fields but no memo file was found; memo columns will hold placeholders")
+	case !hasMemoFields(fields):
+		if p := findMemoFile(dbfPath); p != "" {
+			warnings = append(warnings, fmt.Sprintf("memo file %s found, but the table has no memo fields", filepath.Base(p)))
+		} else if isFox && flags&tableFlagMemo != 0 {
+			warnings = append(warnings, "table header says it has a memo file, but it has no memo fields")
+		}
+	}
+	if memo != nil {
+		warnings = append(warnings, checkMemo(memo)...)
+	}
+
+	// Structural index
+	indexExt, ok := indexExts[strings.ToLower(filepath.Ext(dbfPath))]
+	if !ok {
+		return warnings
+	}
+	indexPath := findSibling(dbfPath, indexExt)
+	switch {
+	case indexPath == "" && isFox && flags&tableFlagIndex != 0:
+		warnings = append(warnings, fmt.Sprintf("table header says it has a structural index, but no %s file was found", indexExt))
+	case indexPath != "":
+		if isFox && flags&tableFlagIndex == 0 {
+			warnings = append(warnings, fmt.Sprintf("index %s is not attached to the table (header flag not set)", filepath.Base(indexPath)))
+		}
+		tags, err := readIndexTags(indexPath)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("index %s: %v", filepath.Base(indexPath), err))
+			break
+		}
+		names := make([]string, len(tags))
+		for i, t := range tags {
+			names[i] = t.name
+			for _, ref := range unknownFields(t.expr, fields) {
+				warnings = append(warnings, fmt.Sprintf("index tag %s refers to unknown field %s (expression: %s)", t.name, ref, t.expr))
+			}
+		}
+		fmt.Printf("  >> Index: %s (%d tags: %s)\n", indexPath, len(tags), strings.Join(names, ", "))
+	}
+	return warnings
+}
+
+// checkMemo verifies the memo header against the file itself
+func checkMemo(m *memoFile) []string {
+	var hdr [4]byte
+	if _, err := m.f.ReadAt(hdr[:], 0); err != nil {
+		return []string{fmt.Sprintf("memo %s: failed to read header: %v", filepath.Base(m.path), err)}
+	}
+
+	var warnings []string
+	if m.fpt && m.Size() >= 8 {
+		var bs [2]byte
+		if _, err := m.f.ReadAt(bs[:], 6); err == nil && binary.BigEndian.Uint16(bs[:]) == 0 {
+			warnings = append(warnings, fmt.Sprintf("memo %s has no block size in its header; assuming %d", filepath.Base(m.path), m.BlockSize()))
+		}
+	}
+
+	// The next free block is big-endian in .fpt files, little-endian in .dbt
+	next := binary.LittleEndian.Uint32(hdr[:])
+	if m.fpt {
+		next = binary.BigEndian.Uint32(hdr[:])
+	}
+	if end := int64(next) * m.BlockSize(); end > m.Size() {
+		warnings = append(warnings, fmt.Sprintf("memo %s is %d bytes but its header expects at least %d; it may be truncated", filepath.Base(m.path), m.Size(), end))
+	}
+	return warnings
+}
+
+// indexTag is one tag of a compound index
+type indexTag struct {
+	name string
+	expr string
+}
+
+// readIndexTags lists the tags of a FoxPro compound (.cdx) index. The file
+// header's root node is a compact leaf whose keys are the tag names and
+// whose record numbers are the offsets of each tag's own header.
+func readIndexTags(path string) ([]indexTag, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.Size() < 1024 || st.Size()%512 != 0 {
+		return nil, fmt.Errorf("not a compound index (size %d is not a multiple of 512)", st.Size())
+	}
+
+	var hdr [512]byte
+	if _, err := f.ReadAt(hdr[:], 0); err != nil {
+		return nil, err
+	}
+	root := int64(binary.LittleEndian.Uint32(hdr[0:4]))
+	keyLen := int(binary.LittleEndian.Uint16(hdr[12:14]))
+	if hdr[14]&0x40 == 0 {
+		return nil, fmt.Errorf("not a compound index (options 0x%02X)", hdr[14])
+	}
+	if root <= 0 || root+512 > st.Size() || keyLen == 0 || keyLen > 240 {
+		return nil, fmt.Errorf("corrupt header (root %d, key length %d)", root, keyLen)
+	}
+
+	var node [512]byte
+	if _, err := f.ReadAt(node[:], root); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint16(node[0:2])&0x02 == 0 {
+		return nil, fmt.Errorf("tag directory is not a leaf node")
+	}
+
+	count := int(binary.LittleEndian.Uint16(node[2:4]))
+	recMask := binary.LittleEndian.Uint32(node[14:18])
+	dupMask, trailMask := uint32(node[18]), uint32(node[19])
+	recBits, dupBits := uint(node[20]), uint(node[21])
+	infoLen := int(node[23])
+	if infoLen == 0 || infoLen > 4 || 24+count*infoLen > len(node) {
+		return nil, fmt.Errorf("corrupt tag directory")
+	}
+
+	tags := make([]indexTag, 0, count)
+	key := make([]byte, keyLen)
+	pos := len(node)
+	for i := 0; i < count; i++ {
+		var info uint32
+		for j := infoLen - 1; j >= 0; j-- {
+			info = info<<8 | uint32(node[24+i*infoLen+j])
+		}
+		tagHeader := int64(info & recMask)
+		dup := int((info >> recBits) & dupMask)
+		trail := int((info >> (recBits + dupBits)) & trailMask)
+
+		take := keyLen - dup - trail
+		if take < 0 || pos-take < 24+count*infoLen {
+			return nil, fmt.Errorf("corrupt tag directory")
+		}
+		pos -= take
+		copy(key[dup:], node[pos:pos+take])
+		for j := keyLen - trail; j < keyLen; j++ {
+			key[j] = 0
+		}
+		name := strings.TrimRight(string(key), "\x00 ")
+
+		expr, err := readTagExpression(f, tagHeader, st.Size())
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", name, err)
+		}
+		tags = append(tags, indexTag{name: name, expr: expr})
+	}
+	return tags, nil
+}
+
+// readTagExpression returns the key expression stored at offset 512 of a
+// tag header
+func readTagExpression(f *os.File, offset, size int64) (string, error) {
+	if offset <= 0 || offset+1024 > size {
+		return "", fmt.Errorf("header offset %d out of range", offset)
+	}
+	var pool [512]byte
+	if _, err := f.ReadAt(pool[:], offset+512); err != nil {
+		return "", err
+	}
+	end := 0
+	for end < len(pool) && pool[end] != 0 {
+		end++
+	}
+	return strings.TrimSpace(string(pool[:end])), nil
+}
+
+// unknownFields returns the identifiers in an index expression that are
+// neither table fields nor function calls. String literals are skipped and
+// alias prefixes (ALIAS.FIELD, ALIAS->FIELD) are ignored.
+func unknownFields(expr string, fields []FieldInfo) []string {
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[strings.ToUpper(f.Name)] = true
+	}
+
+	var unknown []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case c == '"' || c == '\'' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			i++
+			for i < len(runes) && runes[i] != closing {
+				i++
+			}
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			ident := strings.ToUpper(string(runes[start:i]))
+			rest := strings.TrimLeft(string(runes[i:]), " ")
+			isCall := strings.HasPrefix(rest, "(")
+			isAlias := strings.HasPrefix(rest, "->") || (strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, ".."))
+			isLiteral := start > 0 && runes[start-1] == '.' // .T., .F., .AND.
+			if !isCall && !isAlias && !isLiteral && !known[ident] {
+				unknown = append(unknown, ident)
+			}
+		default:
+			i++
+		}
+	}
+	return unknown
+}
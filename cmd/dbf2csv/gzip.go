@@ -0,0 +1,107 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isGzip reports whether path names a gzip-compressed file (.dbf.gz)
+func isGzip(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gz")
+}
+
+// isZstd reports whether path names a zstd-compressed file (.dbf.zst),
+// which dbf2csv does not read
+func isZstd(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".zst")
+}
+
+// trimGzip returns the name of the table inside a .gz file, which decides
+// the names of the CSV and of the memo and index files next to it
+func trimGzip(path string) string {
+	if isGzip(path) {
+		return strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	return path
+}
+
+// tableFile reads a table, decompressing .gz files on the fly so archived
+// tables need no separate decompression step
+type tableFile struct {
+	f    *os.File
+	r    io.Reader // f, or the decompressor reading it
+	read int64     // bytes read from r
+}
+
+func openTable(path string) (*tableFile, error) {
+	if isZstd(path) {
+		return nil, fmt.Errorf("%s: zstd-compressed tables are not supported; decompress it first (zstd -d)", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &tableFile{f: f, r: f}
+	if isGzip(path) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		t.r = zr
+	}
+	return t, nil
+}
+
+func (t *tableFile) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	return n, err
+}
+
+func (t *tableFile) Close() error {
+	return t.f.Close()
+}
+
+// seekData positions the table at the first record. Compressed tables can
+// only move forward, so the rest of the header is skipped.
+func (t *tableFile) seekData(offset int64) error {
+	debugf(1, "records start at offset %d, %d bytes after the field definitions", offset, offset-t.read)
+	if t.r == io.Reader(t.f) {
+		_, err := t.f.Seek(offset, io.SeekStart)
+		return err
+	}
+	if offset < t.read {
+		return fmt.Errorf("header length %d is shorter than the field definitions", offset)
+	}
+	_, err := io.CopyN(io.Discard, t, offset-t.read)
+	return err
+}
+
+// gunzipTemp decompresses a .gz file into a temporary file, for readers
+// that need random access; the caller removes it
+func gunzipTemp(path string) (*os.File, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f, err := os.CreateTemp("", "dbf2csv-memo-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, zr); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// lookupTable is the -join lookup file: its rows by key, to be appended to
+// the exported records whose key field holds that key
+type lookupTable struct {
+	path    string
+	field   string   // DBF field holding the key
+	column  string   // key column of the lookup file
+	names   []string // the other columns, appended to every row
+	rows    map[string][]string
+	dupKeys int
+}
+
+// joinTable is the loaded -join lookup file, nil without -join
+var joinTable *lookupTable
+
+// loadLookup reads a -join spec, lookup.csv:KEY (the key column is named
+// like the field) or lookup.csv:FIELD=COLUMN. The file is read with the -f
+// delimiter in the CSV output encoding, like a file dbf2csv wrote.
+func loadLookup(spec string, comma rune) (*lookupTable, error) {
+	i := strings.LastIndex(spec, ":")
+	if i <= 0 || i == len(spec)-1 {
+		return nil, fmt.Errorf("invalid join '%s' (expected lookup.csv:KEY)", spec)
+	}
+	t := &lookupTable{path: spec[:i], rows: make(map[string][]string)}
+	t.field, t.column, _ = strings.Cut(spec[i+1:], "=")
+	t.field = strings.TrimSpace(t.field)
+	t.column = strings.TrimSpace(t.column)
+	if t.column == "" {
+		t.column = t.field
+	}
+
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lookup file: %w", err)
+	}
+	defer f.Close()
+
+	// A byte order mark picks UTF-8 or UTF-16 regardless of -oe
+	decoder := unicode.BOMOverride(outputEncoding.NewDecoder())
+	r := csv.NewReader(transform.NewReader(f, decoder))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to read header: %w", t.path, err)
+	}
+	keyAt := -1
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), t.column) {
+			keyAt = i
+			break
+		}
+	}
+	if keyAt < 0 {
+		return nil, fmt.Errorf("%s: no column named '%s'", t.path, t.column)
+	}
+	t.names = append(append([]string(nil), header[:keyAt]...), header[keyAt+1:]...)
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.path, err)
+		}
+		if keyAt >= len(row) {
+			continue
+		}
+		key := strings.TrimSpace(row[keyAt])
+		if _, dup := t.rows[key]; dup {
+			t.dupKeys++
+			continue
+		}
+		values := make([]string, len(t.names))
+		for i, v := range row {
+			switch {
+			case i < keyAt:
+				values[i] = v
+			case i > keyAt && i-1 < len(values):
+				values[i-1] = v
+			}
+		}
+		t.rows[key] = values
+	}
+	return t, nil
+}
+
+// joinWriter appends the lookup columns to every row it passes on: the
+// lookup's column names to the header row, then the values of the lookup
+// row matching each record's key (empty cells if none does)
+type joinWriter struct {
+	bufferedRowWriter
+	t       *lookupTable
+	keyAt   int
+	started bool // the header row is written
+	row     []string
+	blank   []string
+	records int
+	matched int
+}
+
+func newJoinWriter(w bufferedRowWriter, t *lookupTable, fields []FieldInfo) (*joinWriter, error) {
+	for i, f := range fields {
+		if strings.EqualFold(f.Name, t.field) {
+			return &joinWriter{bufferedRowWriter: w, t: t, keyAt: i, blank: make([]string, len(t.names))}, nil
+		}
+	}
+	return nil, fmt.Errorf("-join: no field named '%s'", t.field)
+}
+
+func (j *joinWriter) Write(row []string) error {
+	extra := j.t.names
+	if j.started {
+		extra = j.blank
+		if key := strings.TrimSpace(row[j.keyAt]); key != "" && key != flagNull {
+			if values, ok := j.t.rows[key]; ok {
+				extra = values
+				j.matched++
+			}
+		}
+		j.records++
+	}
+	j.started = true
+	j.row = append(append(j.row[:0], row...), extra...)
+	return j.bufferedRowWriter.Write(j.row)
+}
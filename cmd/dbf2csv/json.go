@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// JSON value kinds of the columns
+const (
+	jsonText   = iota // character and memo fields
+	jsonString        // dates, times and binary data
+	jsonNumber
+	jsonBool
+)
+
+// jsonKind returns how the values of a field are written in JSON
+func jsonKind(f FieldInfo) int {
+	switch f.Type {
+	case 'N', 'F', 'I', '+', 'B', 'O', 'Y':
+		return jsonNumber
+	case 'L':
+		return jsonBool
+	case 'D', 'T', '@', 'Q':
+		return jsonString
+	}
+	if isBinaryMemo(f) {
+		return jsonString
+	}
+	return jsonText
+}
+
+// jsonWriter writes rows as a JSON array of objects, or with lines set as
+// one object per line (NDJSON). The first row written is the header row,
+// whose names become the keys of the objects.
+type jsonWriter struct {
+	w     *bufio.Writer
+	lines bool
+	kinds []int
+	keys  [][]byte // `"NAME":` per column
+	rows  int
+	buf   []byte
+}
+
+func newJSONWriter(w *bufio.Writer, fields []FieldInfo, lines bool) *jsonWriter {
+	kinds := make([]int, len(fields))
+	for i, f := range fields {
+		kinds[i] = jsonKind(f)
+	}
+	if flagDeletedColumn {
+		kinds = append(kinds, jsonBool)
+	}
+	return &jsonWriter{w: w, lines: lines, kinds: kinds}
+}
+
+func (jw *jsonWriter) Write(row []string) error {
+	if jw.keys == nil {
+		jw.keys = make([][]byte, len(row))
+		for i, name := range row {
+			jw.keys[i] = append(appendJSONString(nil, name), ':')
+		}
+		if jw.lines {
+			return nil
+		}
+		_, err := jw.w.WriteString("[")
+		return err
+	}
+
+	buf := jw.buf[:0]
+	if !jw.lines {
+		if jw.rows > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '\n')
+	}
+	buf = append(buf, '{')
+	for i, cell := range row {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, jw.keys[i]...)
+		buf = appendJSONValue(buf, cell, jw.kinds[i])
+	}
+	buf = append(buf, '}')
+	if jw.lines {
+		buf = append(buf, '\n')
+	}
+	jw.buf = buf
+	jw.rows++
+	_, err := jw.w.Write(buf)
+	return err
+}
+
+// Flush is a no-op: rows go straight to the underlying buffer
+func (jw *jsonWriter) Flush() {}
+
+// Close ends the array and flushes the underlying buffer
+func (jw *jsonWriter) Close() error {
+	if !jw.lines {
+		if _, err := jw.w.WriteString("\n]\n"); err != nil {
+			return err
+		}
+	}
+	return jw.w.Flush()
+}
+
+// appendJSONValue appends a cell as a value of the given kind. Empty cells
+// (the -null token) are null, except in character and memo columns when
+// -null is not set; numbers and logicals that don't parse are kept as strings.
+func appendJSONValue(dst []byte, cell string, kind int) []byte {
+	if cell == flagNull && (flagNull != "" || kind != jsonText) {
+		return append(dst, "null"...)
+	}
+	switch kind {
+	case jsonNumber:
+		if isNumber([]byte(cell)) {
+			if json.Valid([]byte(cell)) {
+				return append(dst, cell...)
+			}
+			// "+5", ".5", "5." or "007"
+			if v, err := strconv.ParseFloat(cell, 64); err == nil && !math.IsInf(v, 0) {
+				return strconv.AppendFloat(dst, v, 'f', -1, 64)
+			}
+		}
+	case jsonBool:
+		switch cell {
+		case boolTrue:
+			return append(dst, "true"...)
+		case boolFalse:
+			return append(dst, "false"...)
+		}
+	}
+	return appendJSONString(dst, cell)
+}
+
+// appendJSONString appends s as a JSON string. Unlike encoding/json it
+// leaves <, > and & alone; invalid UTF-8 becomes U+FFFD.
+func appendJSONString(dst []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				dst = append(dst, `�`...)
+			} else {
+				dst = append(dst, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+		switch {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c == '\n':
+			dst = append(dst, `\n`...)
+		case c == '\r':
+			dst = append(dst, `\r`...)
+		case c == '\t':
+			dst = append(dst, `\t`...)
+		case c < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+		default:
+			dst = append(dst, c)
+		}
+		i++
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+)
+
+// deriveRecordCount fills in the record count of a table whose header says
+// 0 although records follow it, as some writers leave it, from the file
+// size. Compressed tables can't be measured and are left as they are.
+func deriveRecordCount(t *tableFile, h *DBFHeader) {
+	if h.NumRecs != 0 || h.RecLen == 0 || t.r != io.Reader(t.f) {
+		return
+	}
+	st, err := t.f.Stat()
+	if err != nil {
+		return
+	}
+	n := (st.Size() - int64(h.HeaderLen)) / int64(h.RecLen)
+	if n <= 0 {
+		return
+	}
+	// An empty table ends with the 0x1A marker where records would start
+	var flag [1]byte
+	if _, err := t.f.ReadAt(flag[:], int64(h.HeaderLen)); err != nil || flag[0] == 0x1A {
+		return
+	}
+	n = min(n, math.MaxUint32)
+	warnf("the header says 0 records, but %d follow it; exporting them", n)
+	h.NumRecs = uint32(n)
+}
+
+// recoverHeaderLen realigns the data start of a table whose header length
+// is a few bytes off, as some tools write it. The declared start is trusted
+// while it is past the field definitions and its records have a valid
+// deletion flag; otherwise the records must end where the file does (with
+// or without the 0x1A marker), which fixes where they start, and that start
+// is used if its records are plausible. fieldsEnd is the offset just past
+// the 0x0D field terminator.
+func recoverHeaderLen(t *tableFile, h *DBFHeader, fieldsEnd int64) {
+	if t.r != io.Reader(t.f) || h.RecLen == 0 {
+		return
+	}
+	declared := int64(h.HeaderLen)
+	if declared >= fieldsEnd && plausibleRecords(t.f, declared, h) {
+		return
+	}
+	st, err := t.f.Stat()
+	if err != nil {
+		return
+	}
+	if h.NumRecs == 0 {
+		if declared < fieldsEnd {
+			warnf("header length %d ends inside the field definitions; records start at %d", declared, fieldsEnd)
+			h.HeaderLen = uint16(fieldsEnd)
+		}
+		return
+	}
+
+	data := int64(h.NumRecs) * int64(h.RecLen)
+	for _, marker := range []int64{1, 0} {
+		start := st.Size() - data - marker
+		if start < fieldsEnd || start > math.MaxUint16 || start == declared {
+			continue
+		}
+		if marker == 1 {
+			var eof [1]byte
+			if _, err := t.f.ReadAt(eof[:], st.Size()-1); err != nil || eof[0] != 0x1A {
+				continue
+			}
+		}
+		if plausibleRecords(t.f, start, h) {
+			warnf("header length %d does not point at the records; realigned to %d (%+d bytes)", declared, start, start-declared)
+			h.HeaderLen = uint16(start)
+			return
+		}
+	}
+	warnf("header length %d does not point at valid records, and no better start was found", declared)
+}
+
+// plausibleRecords reports whether records starting at start have a valid
+// deletion flag: the first few, and the last one unless the file is cut
+// short before it (see -lenient)
+func plausibleRecords(f *os.File, start int64, h *DBFHeader) bool {
+	flagAt := func(i int64) (byte, error) {
+		var flag [1]byte
+		_, err := f.ReadAt(flag[:], start+i*int64(h.RecLen))
+		return flag[0], err
+	}
+	valid := func(b byte) bool { return b == ' ' || b == '*' }
+	for i := int64(0); i < min(int64(h.NumRecs), 16); i++ {
+		if b, err := flagAt(i); err != nil || !valid(b) {
+			return false
+		}
+	}
+	if h.NumRecs > 16 {
+		if b, err := flagAt(int64(h.NumRecs) - 1); err == nil && !valid(b) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,15 +3,17 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
-	"encoding/csv"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unicode/utf8"
 
@@ -19,17 +21,96 @@ import (
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
+
+	"github.com/dabiaoge/csv2dbf/dbf"
+	"github.com/dabiaoge/csv2dbf/internal/cli"
+	"github.com/dabiaoge/csv2dbf/internal/serve"
 )
 
 // Global configuration variables
 var (
-	flagDelimiter string
-	flagQuote     string
-	flagNewline   string
-	flagEncoding  string
-	flagProgress  int // Control progress reporting interval
+	flagDelimiter      string
+	flagQuote          string
+	flagQuoting        string
+	flagBOM            bool
+	flagSepLine        bool
+	flagNameCase       string
+	flagClipper        bool
+	flagNewline        string
+	flagEncoding       string
+	flagOutEncoding    string
+	flagBufSize        string
+	flagProgress       int // Control progress reporting interval
+	flagProgressFormat string
+	flagMetrics        string
+	flagTimeout        time.Duration
+	flagThrottle       string
+	flagDeleted        string
+	flagDeletedColumn  bool
+	flagTypedCSV       bool
+	flagRename         string
+	flagExplain        bool
+	flagDateFmt        string
+	flagOnlyNewer      bool
+	flagTZ             string
+	flagRFC3339        bool
+	flagBoolFmt        string
+	flagNull           string
+	flagCurrency       string
+	flagTrim           string
+	flagBinary         string
+	flagJobs           int
+	flagCache          string
+	flagOutput         string
+	flagOLEDir         string
+	flagCompress       string
+	flagWatch          string
+	flagServe          string
+	flagMaxUpload      string
+	flagWatchDebounce  time.Duration
+	flagDecrypt        string
+	flagBench          bool
+	flagTo             string
+	flagSplitRows      int
+	flagJoin           string
+	flagShapefile      bool
+	flagLenient        bool
+	flagDecodeReport   string
+	flagQuiet          bool
+	flagLog            string
+	flagFailFast       bool
+	flagCPUProfile     string
+	flagMemProfile     string
+	flagVerbose        bool
+	flagDebug          bool
 )
 
+// Output formats (-to)
+const (
+	formatCSV     = "csv"
+	formatJSON    = "json"
+	formatNDJSON  = "ndjson"
+	formatParquet = "parquet"
+	formatAvro    = "avro"
+	formatXLSX    = "xlsx"
+	formatSQLite  = "sqlite"
+)
+
+// outputFormat is the resolved -to format
+var outputFormat = formatCSV
+
+// outputExts are the file extensions of the formats written to files
+var outputExts = map[string]string{formatCSV: ".csv", formatJSON: ".json", formatNDJSON: ".ndjson", formatParquet: ".parquet", formatAvro: ".avro", formatXLSX: ".xlsx"}
+
+// bufSize is the resolved -bufsize value in bytes (0 means auto)
+var bufSize int
+
+// maxUpload is the resolved -max-upload value in bytes
+var maxUpload int64
+
+// throttleRate is the resolved -throttle value in bytes per second (0 means unlimited)
+var throttleRate float64
+
 // Constants for program info
 const (
 	AppVersion = "1.7.0"
@@ -37,45 +118,91 @@ const (
 )
 
 // DBFHeader represents the file header structure (32 bytes)
-type DBFHeader struct {
-	Version   byte     // 0-0
-	Year      byte     // 1-1 (Year - 1900)
-	Month     byte     // 2-2
-	Day       byte     // 3-3
-	NumRecs   uint32   // 4-7
-	HeaderLen uint16   // 8-9 (Position of first record)
-	RecLen    uint16   // 10-11
-	Reserved  [20]byte // 12-31
-}
+type DBFHeader = dbf.Header
 
-// FieldInfo holds internal metadata for a column
+// FieldInfo holds internal metadata for a column: the field as the dbf
+// package reads it, and its name in the original CSV file
 type FieldInfo struct {
-	Name   string
-	Type   byte
-	Length int
-	Dec    int
+	dbf.Field
+	Column string // original CSV column name from the names sidecar
+	Mapped bool   // Column is set, possibly to an empty name
 }
 
 func init() {
 	// Define command line flags
 	flag.StringVar(&flagDelimiter, "f", ",", "Output field delimiter (single char)")
 	flag.StringVar(&flagQuote, "q", "\"", "Quote character")
-	flag.StringVar(&flagNewline, "l", "\n", "Output line ending (e.g. \"\\n\", \"\\r\\n\")")
+	flag.StringVar(&flagQuoting, "quoting", "minimal", "Quote fields: minimal (only when needed), always, or none (fail on fields that need quotes)")
+	flag.BoolVar(&flagBOM, "bom", false, "Start UTF-8 output with a byte order mark, so Excel detects the encoding")
+	flag.BoolVar(&flagSepLine, "sep-line", false, "Start the CSV with a \"sep=;\" line naming the delimiter, so Excel splits columns in any locale")
+	flag.StringVar(&flagNewline, "l", "\n", "Output line ending: \"\\n\", \"\\r\\n\" or \"\\r\"")
 	flag.StringVar(&flagEncoding, "e", "UTF-8", "Source DBF Encoding (UTF-8, GBK, GB18030)")
+	flag.StringVar(&flagOutEncoding, "oe", "", "CSV output encoding, if different from the DBF encoding (-e); also UTF-16 (with BOM), UTF-16LE, UTF-16BE")
 	flag.IntVar(&flagProgress, "c", 0, "Show progress every N rows (default 0, disable output)")
+	flag.BoolVar(&flagVerbose, "v", false, "Verbose: log the decoded header, field descriptors, where the records start and the time of each stage")
+	flag.BoolVar(&flagDebug, "vv", false, "More verbose than -v: also dump the header and descriptor bytes in hex")
+	flag.StringVar(&flagCPUProfile, "cpuprofile", "", "Write a CPU profile of the run to this file, for go tool pprof")
+	flag.StringVar(&flagMemProfile, "memprofile", "", "Write a heap profile at the end of the run to this file, for go tool pprof")
+	flag.BoolVar(&flagFailFast, "fail-fast", false, "Stop at the first file that fails to convert, leaving the rest; the exit code is then 1, or 3 if earlier files were converted")
+	flag.StringVar(&flagLog, "log", "text", "Log format: text, or json (start, stage, warning, done and failed events with level, file, record counts and errors, one JSON object per line on stderr, instead of the text output)")
+	flag.BoolVar(&flagQuiet, "quiet", false, "Print only errors (on stderr): no Processing/Done lines, statistics, progress or warnings, e.g. for cron jobs")
+	flag.StringVar(&flagOLEDir, "ole-dir", "", "Extract General (G) and Picture (P) field objects to files <table>_<record>_<field>.bin in this directory (.png, .jpg, .gif or .bmp for images); cells hold their paths relative to the CSV")
+	flag.StringVar(&flagWatch, "watch", "", "Watch this directory and convert tables as they are created or modified (until Ctrl+C)")
+	flag.StringVar(&flagServe, "serve", "", "Serve conversions over HTTP on this address (e.g. :8080): POST a table to /convert and receive the CSV, or to /jobs to convert it in the background; query parameters set options, e.g. ?e=GBK&deleted=skip")
+	flag.StringVar(&flagMaxUpload, "max-upload", "1GB", "With -serve, the largest request body accepted (e.g. 200MB); larger uploads are refused with 413 Request Entity Too Large")
+	flag.DurationVar(&flagWatchDebounce, "watch-debounce", 2*time.Second, "With -watch, wait until a table has been unchanged this long before converting it")
+	flag.StringVar(&flagCompress, "compress", "", "Compress the CSV as it is written: gzip (data.csv.gz) or zstd (data.csv.zst)")
+	flag.StringVar(&flagTo, "to", "csv", "Output format: csv, json (an array of objects with typed values, written as UTF-8 to data.json), ndjson (one such object per line, data.ndjson), parquet (typed columns, data.parquet), avro (an object container file with the record schema, data.avro), xlsx (an Excel workbook with typed cells, data.xlsx), or sqlite:FILE to load each table into a SQLite database table named after the DBF file")
+	flag.StringVar(&flagJoin, "join", "", "Append the columns of a lookup CSV to each record, matched on a key field: lookup.csv:KEY, or lookup.csv:FIELD=COLUMN if the lookup names the key column differently")
+	flag.StringVar(&flagDecodeReport, "decode-report", "", "Write every cell whose bytes are not valid in the table encoding to this CSV file (record, column, field, file offset, bytes in hex); the first few are always listed after the conversion")
+	flag.BoolVar(&flagLenient, "lenient", false, "Read tables whose header claims more records than the file holds up to the end-of-file marker or last complete record, and export those")
+	flag.BoolVar(&flagShapefile, "shapefile", false, "Export the attribute table of a shapefile safely: every record in table order, deleted ones included and flagged in a _DELETED column, with the count checked against the .shp")
+	flag.IntVar(&flagSplitRows, "split-rows", 0, "Split the CSV into files of at most N records each (data_001.csv, data_002.csv, ...), every one with the header row")
+	flag.StringVar(&flagOutput, "o", "", "Write CSV files to this directory instead of next to each table; s3://bucket/prefix uploads them to S3")
+	flag.StringVar(&flagCache, "cache", "", "Cache decoded records in this directory; repeated exports of an unchanged table skip decoding")
+	flag.BoolVar(&flagDeletedColumn, "deleted-column", false, "Append a _DELETED column (TRUE/FALSE) with each record's deletion flag")
+	flag.BoolVar(&flagOnlyNewer, "only-newer", false, "Skip tables whose CSV already exists and is newer than the table and its memo file")
+	flag.StringVar(&flagTrim, "trim", "both", "Whitespace trimmed from character fields: none (keep padding), right, or both")
+	flag.StringVar(&flagBinary, "binary", binaryHex, "Binary data (Varbinary and binary memo or Blob fields): hex, base64, or skip (empty cells)")
+	flag.StringVar(&flagCurrency, "currency", "4", "Currency (Y) format: decimal places 0-4, plus optional trim (drop trailing zeros) and grouped (1,234.50), e.g. 2,grouped")
+	flag.StringVar(&flagNull, "null", "", "Write empty/uninitialized fields as this token (e.g. \\N or NULL; default empty)")
+	flag.StringVar(&flagBoolFmt, "boolfmt", "", "Logical value format: TRUE/FALSE (default), true/false, 1/0, Y/N, T/F, yes/no")
+	flag.StringVar(&flagTZ, "tz", "", "Convert DateTime values, stored as UTC, to this zone (e.g. Asia/Shanghai, local)")
+	flag.BoolVar(&flagRFC3339, "rfc3339", false, "Write DateTime values as RFC 3339 with the zone offset (2024-01-31T13:01:01+08:00)")
+	flag.StringVar(&flagDateFmt, "datefmt", "", "Date output format for D fields and the date part of T fields: Go layout (02/01/2006) or strftime (%d/%m/%Y)")
+	flag.BoolVar(&flagExplain, "explain", false, "Print the conversion plan (dialect, encoding, field mapping, output) and exit without converting")
+	flag.StringVar(&flagNameCase, "namecase", "preserve", "Header case: upper, lower, or preserve (as stored in the table)")
+	flag.BoolVar(&flagClipper, "clipper", false, "Read character fields as Clipper long fields (length = Len + 256*Dec); detected automatically when only that fits the record")
+	flag.StringVar(&flagRename, "rename", "", "Rename columns: OLD1=NEW1,OLD2=NEW2, or a file with one OLD=NEW per line")
+	flag.BoolVar(&flagTypedCSV, "typed-csv", false, "Write values csvkit/pandas infer as typed: ISO dates and times, true/false, bare numbers")
+	flag.StringVar(&flagDecrypt, "decrypt", "", "Decrypt scrambled records, e.g. xor:5A3C (repeating hex key)")
+	flag.IntVar(&flagJobs, "j", 1, "Number of parallel workers parsing and encoding records")
+	flag.StringVar(&flagDeleted, "deleted", "include", "Deleted records: include, skip, or only (export just the deleted ones)")
+	flag.StringVar(&flagThrottle, "throttle", "", "Limit the combined speed of table and memo reads and output writes (e.g. 50MB/s; default no limit)")
+	flag.DurationVar(&flagTimeout, "timeout", 0, "Abort a file's conversion after this long (e.g. 30s, 10m; default 0, no limit)")
+	flag.StringVar(&flagMetrics, "metrics", "", "Serve conversion metrics on this address (e.g. :9100) at /metrics and /debug/vars")
+	flag.StringVar(&flagProgressFormat, "progress", "text", "Progress output format: text, or json (events on stderr)")
+	flag.BoolVar(&flagBench, "bench", false, "Benchmark mode: convert without writing output and report throughput, with rows/s and MB/s of the parse (decoding fields) and encode (CSV and output encoding) stages")
+	flag.StringVar(&flagBufSize, "bufsize", "auto", "I/O buffer size (e.g. 512K, 4MB); auto tunes it from the record length")
 
 	// Custom usage message
 	flag.Usage = func() {
 		fmt.Printf("DBF2CSV Converter\n")
 		fmt.Printf("Version: %s\n", AppVersion)
 		fmt.Printf("Author : %s\n\n", AppAuthor)
-		fmt.Printf("Usage: %s [options] <dbf_file1> [dbf_file2] ...\n\n", os.Args[0])
+		fmt.Printf("Usage: %s [options] <dbf_file1> [dbf_file2] ...\n\nAlso accepts FoxPro SCX/VCX/FRX/LBX/MNX/PJX/DBC files with their memo files,\ngzip-compressed tables and memo files (data.dbf.gz, data.fpt.gz), decompressed\non the fly, and https:// or s3:// URLs, downloaded with their memo files.\n\n", os.Args[0])
 		fmt.Println("Options:")
 		flag.PrintDefaults()
 		fmt.Println("\nExamples:")
 		fmt.Printf("  %s data.dbf\n", os.Args[0])
 		fmt.Printf("  %s -e GBK -c 5000 data.dbf\n", os.Args[0])
 		fmt.Printf("  %s -f '|' data.dbf\n", os.Args[0])
+		fmt.Printf("  %s form.scx classes.vcx report.frx\n", os.Args[0])
+		fmt.Printf("  %s -o s3://bucket/csv s3://bucket/feeds/data.dbf\n", os.Args[0])
+		fmt.Printf("  %s -to sqlite:sales.db orders.dbf customers.dbf\n", os.Args[0])
+		fmt.Printf("  %s -split-rows 1000000 big.dbf\n", os.Args[0])
+		fmt.Printf("  %s -join regions.csv:REGION_ID orders.dbf\n", os.Args[0])
+		fmt.Printf("  %s -shapefile roads.dbf\n", os.Args[0])
 	}
 }
 
@@ -84,39 +211,417 @@ func main() {
 	args := flag.Args()
 
 	// Show help if no files provided
-	if len(args) < 1 {
+	if len(args) < 1 && flagWatch == "" && flagServe == "" {
 		flag.Usage()
 		os.Exit(0)
 	}
 
 	// Parse escaped characters in flags
 	delimiter := parseEscapedChar(flagDelimiter)
+	quoteChar = parseEscapedChar(flagQuote)
+	if quoteChar == 0 || quoteChar == delimiter || quoteChar == '\r' || quoteChar == '\n' {
+		fmt.Fprintf(os.Stderr, "Error: Invalid quote character '%s'\n", flagQuote)
+		os.Exit(cli.ExitUsage)
+	}
+	nl, err := parseNewline(flagNewline)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cli.ExitUsage)
+	}
+	newline = nl
+	flagNameCase = strings.ToLower(flagNameCase)
+	if flagNameCase != "upper" && flagNameCase != "lower" && flagNameCase != "preserve" {
+		fmt.Fprintf(os.Stderr, "Error: Invalid name case '%s'\n", flagNameCase)
+		os.Exit(cli.ExitUsage)
+	}
+	quoting = strings.ToLower(flagQuoting)
+	if quoting != quoteMinimal && quoting != quoteAlways && quoting != quoteNone {
+		fmt.Fprintf(os.Stderr, "Error: Invalid quoting policy '%s'\n", flagQuoting)
+		os.Exit(cli.ExitUsage)
+	}
+
+	flagDeleted = strings.ToLower(flagDeleted)
+	if flagDeleted != "include" && flagDeleted != "skip" && flagDeleted != "only" {
+		fmt.Fprintf(os.Stderr, "Error: Invalid deleted policy '%s'\n", flagDeleted)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if flagShapefile {
+		if flagDeleted != "include" {
+			fmt.Fprintf(os.Stderr, "Error: -shapefile exports every record; it cannot be combined with -deleted %s\n", flagDeleted)
+			os.Exit(cli.ExitUsage)
+		}
+		if flagJoin != "" {
+			fmt.Fprintf(os.Stderr, "Error: -shapefile cannot be combined with -join\n")
+			os.Exit(cli.ExitUsage)
+		}
+		flagDeletedColumn = true
+	}
+
+	if flagDecrypt != "" {
+		d, err := parseDecrypt(flagDecrypt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
+		}
+		recordDecrypter = d
+	}
+
+	switch lower := strings.ToLower(flagTo); {
+	case lower == formatCSV || lower == formatJSON || lower == formatNDJSON || lower == formatParquet || lower == formatAvro || lower == formatXLSX:
+		outputFormat = lower
+	case strings.HasPrefix(lower, "sqlite:") && len(flagTo) > len("sqlite:"):
+		outputFormat, sqlitePath = formatSQLite, flagTo[len("sqlite:"):]
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid output format '%s' (expected csv, json, ndjson, parquet, avro, xlsx or sqlite:FILE)\n", flagTo)
+		os.Exit(cli.ExitUsage)
+	}
+	if (outputFormat == formatParquet || outputFormat == formatAvro || outputFormat == formatXLSX) && flagCompress != "" {
+		fmt.Fprintf(os.Stderr, "Error: -to %s cannot be combined with -compress (the format compresses its data itself)\n", outputFormat)
+		os.Exit(cli.ExitUsage)
+	}
+	if sqlitePath != "" {
+		// Options that only apply to output files
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "o", "compress", "cache", "ole-dir", "only-newer", "bench", "serve":
+				fmt.Fprintf(os.Stderr, "Error: -to %s cannot be combined with -%s\n", flagTo, f.Name)
+				os.Exit(cli.ExitUsage)
+			}
+		})
+	}
+
+	if flagSplitRows < 0 {
+		fmt.Fprintf(os.Stderr, "Error: Invalid split row count %d\n", flagSplitRows)
+		os.Exit(cli.ExitUsage)
+	}
+	if flagSplitRows > 0 && outputFormat != formatCSV {
+		fmt.Fprintf(os.Stderr, "Error: -split-rows needs -to csv\n")
+		os.Exit(cli.ExitUsage)
+	}
+
+	if err := setDateLayouts(flagDateFmt); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cli.ExitUsage)
+	}
+	flagBinary = strings.ToLower(flagBinary)
+	if flagBinary != binaryHex && flagBinary != binaryBase64 && flagBinary != binarySkip {
+		fmt.Fprintf(os.Stderr, "Error: Invalid binary format '%s'\n", flagBinary)
+		os.Exit(cli.ExitUsage)
+	}
+
+	flagTrim = strings.ToLower(flagTrim)
+	if flagTrim != "none" && flagTrim != "right" && flagTrim != "both" {
+		fmt.Fprintf(os.Stderr, "Error: Invalid trim mode '%s'\n", flagTrim)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if err := setCurrencyFormat(flagCurrency); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if err := setBoolFormat(flagBoolFmt); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if flagTZ != "" {
+		loc, err := parseZone(flagTZ)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
+		}
+		dateTimeZone = loc
+	}
+
+	if flagRename != "" {
+		renames, err := parseRenames(flagRename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
+		}
+		fieldRenames = renames
+	}
+
+	if flagOLEDir != "" && flagCache != "" {
+		fmt.Fprintln(os.Stderr, "Error: -ole-dir cannot be combined with -cache")
+		os.Exit(cli.ExitUsage)
+	}
+	if flagOutput != "" {
+		if isRemote(flagOutput) && !strings.HasPrefix(strings.ToLower(flagOutput), "s3://") {
+			fmt.Fprintf(os.Stderr, "Error: Invalid output '%s' (expected a directory or s3://bucket/prefix)\n", flagOutput)
+			os.Exit(cli.ExitUsage)
+		}
+		if !isRemote(flagOutput) {
+			if err := os.MkdirAll(flagOutput, 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(cli.ExitFailed)
+			}
+		}
+	}
+	if flagServe != "" && flagWatch != "" {
+		fmt.Fprintln(os.Stderr, "Error: -serve cannot be combined with -watch")
+		os.Exit(cli.ExitUsage)
+	}
+
+	flagCompress = strings.ToLower(flagCompress)
+	if _, ok := compressExts[flagCompress]; flagCompress != "" && !ok {
+		fmt.Fprintf(os.Stderr, "Error: Invalid compression '%s' (expected gzip or zstd)\n", flagCompress)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if flagWatchDebounce <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: Invalid watch debounce %s\n", flagWatchDebounce)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if flagJobs < 1 {
+		fmt.Fprintf(os.Stderr, "Error: Invalid worker count %d\n", flagJobs)
+		os.Exit(cli.ExitUsage)
+	}
+
+	flagProgressFormat = strings.ToLower(flagProgressFormat)
+	if flagProgressFormat != "text" && flagProgressFormat != "json" {
+		fmt.Fprintf(os.Stderr, "Error: Invalid progress format '%s'\n", flagProgressFormat)
+		os.Exit(cli.ExitUsage)
+	}
 
 	// Determine encoding
 	enc := getEncoding(flagEncoding)
 	if enc == nil {
 		fmt.Fprintf(os.Stderr, "Error: Unsupported encoding '%s'\n", flagEncoding)
-		os.Exit(1)
+		os.Exit(cli.ExitUsage)
+	}
+	if enc == utf16LE || enc == utf16BE {
+		fmt.Fprintf(os.Stderr, "Error: DBF text cannot be UTF-16; use -oe to write UTF-16 CSV\n")
+		os.Exit(cli.ExitUsage)
+	}
+	if flagOutEncoding == "" {
+		flagOutEncoding = flagEncoding
+	}
+	outputEncoding = getEncoding(flagOutEncoding)
+	if outputEncoding == nil {
+		fmt.Fprintf(os.Stderr, "Error: Unsupported encoding '%s'\n", flagOutEncoding)
+		os.Exit(cli.ExitUsage)
+	}
+	// Plain UTF-16 is ambiguous without a byte order mark
+	if n := strings.ToLower(strings.TrimSpace(flagOutEncoding)); n == "utf-16" || n == "utf16" {
+		flagBOM = true
+	}
+	if flagBOM && outputEncoding != unicode.UTF8 && outputEncoding != utf16LE && outputEncoding != utf16BE {
+		fmt.Fprintf(os.Stderr, "Error: -bom needs UTF-8 or UTF-16 output, but the CSV is written as %s\n", flagOutEncoding)
+		os.Exit(cli.ExitUsage)
 	}
 
-	for _, dbfFile := range args {
-		if _, err := os.Stat(dbfFile); os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "Error: File not found [%s]\n", dbfFile)
-			continue
+	if flagJoin != "" {
+		if outputFormat != formatCSV {
+			fmt.Fprintf(os.Stderr, "Error: -join needs -to csv\n")
+			os.Exit(cli.ExitUsage)
+		}
+		t, err := loadLookup(flagJoin, delimiter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(cli.ExitUsage)
 		}
+		if t.dupKeys > 0 {
+			warnf("%s: %d rows repeat an earlier key; the first row is used", t.path, t.dupKeys)
+		}
+		joinTable = t
+	}
 
-		fmt.Printf("Processing: %s\n", dbfFile)
-		startTime := time.Now()
+	// Resolve buffer size ("auto" tunes per file from the record length)
+	if !strings.EqualFold(flagBufSize, "auto") {
+		n, err := parseSize(flagBufSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid buffer size '%s'\n", flagBufSize)
+			os.Exit(cli.ExitUsage)
+		}
+		bufSize = int(n)
+	}
+
+	if n, err := parseSize(flagMaxUpload); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid upload limit '%s'\n", flagMaxUpload)
+		os.Exit(cli.ExitUsage)
+	} else {
+		maxUpload = n
+	}
 
-		err := convertDBFtoCSV(dbfFile, delimiter, enc)
+	if flagThrottle != "" {
+		rate, err := parseRate(flagThrottle)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed [%s]: %v\n", dbfFile, err)
+			fmt.Fprintf(os.Stderr, "Error: Invalid throttle rate '%s'\n", flagThrottle)
+			os.Exit(cli.ExitUsage)
+		}
+		throttleRate = rate
+	}
+
+	switch strings.ToLower(flagLog) {
+	case "text":
+	case "json":
+		logJSON = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Invalid log format '%s' (text or json)\n", flagLog)
+		os.Exit(cli.ExitUsage)
+	}
+	if flagQuiet && (flagExplain || flagBench || flagVerbose || flagDebug) {
+		fmt.Fprintln(os.Stderr, "Error: -quiet cannot be combined with -explain, -bench, -v or -vv")
+		os.Exit(cli.ExitUsage)
+	}
+	if logJSON && (flagExplain || flagBench || flagVerbose || flagDebug) {
+		fmt.Fprintln(os.Stderr, "Error: -log json cannot be combined with -explain, -bench, -v or -vv")
+		os.Exit(cli.ExitUsage)
+	}
+	if flagDebug {
+		verbosity = 2
+	} else if flagVerbose {
+		verbosity = 1
+	}
+	if flagMetrics != "" {
+		serve.Metrics(flagMetrics, warnf)
+	}
+	if flagQuiet || logJSON {
+		cli.SilenceOutput()
+	}
+
+	if flagFailFast && (flagWatch != "" || flagServe != "") {
+		fmt.Fprintln(os.Stderr, "Error: -fail-fast cannot be combined with -watch or -serve")
+		os.Exit(cli.ExitUsage)
+	}
+	if err := cli.StartProfiles(flagCPUProfile, flagMemProfile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(cli.ExitUsage)
+	}
+
+	// Stop cleanly on Ctrl+C / SIGTERM instead of leaving a half-written CSV
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	convert := func(dbfFile string) error {
+		return convertFile(ctx, dbfFile, delimiter, enc)
+	}
+	var batch cli.Batch
+	for i, dbfFile := range args {
+		if ctx.Err() != nil {
+			break
+		}
+		err := convert(dbfFile)
+		batch.Add(err)
+		if err != nil && flagFailFast {
+			stopBatch(len(args) - i - 1)
+			break
+		}
+	}
+	if flagWatch != "" && ctx.Err() == nil {
+		if err := watchDir(ctx, flagWatch, convert); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cli.Exit(cli.ExitFailed)
+		}
+	}
+	if flagServe != "" && ctx.Err() == nil {
+		if err := serveConversions(ctx, flagServe); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cli.Exit(cli.ExitFailed)
+		}
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		cli.Exit(cli.ExitInterrupted)
+	}
+	cli.Exit(batch.ExitCode())
+}
+
+// convertFile converts one table, reporting progress and failures on the
+// console; the error is returned for -watch, which only records successes
+func convertFile(ctx context.Context, dbfFile string, delimiter rune, enc encoding.Encoding) error {
+	if isRemote(dbfFile) {
+		// Always converted: -only-newer can't compare remote timestamps
+	} else if _, err := os.Stat(dbfFile); os.IsNotExist(err) {
+		logNotFound(dbfFile)
+		return err
+	} else if flagOnlyNewer && !flagBench && upToDate(outputPathFor(trimGzip(dbfFile)), dbfFile, findMemoFile(trimGzip(dbfFile))) {
+		fmt.Printf("Skipped: %s (up to date)\n", dbfFile)
+		emitLog(logEvent{Level: "info", Event: "skipped", File: dbfFile, Message: "up to date"})
+		return nil
+	}
+
+	fmt.Printf("Processing: %s\n", dbfFile)
+	logFile = dbfFile
+	defer func() { logFile = "" }()
+	emitLog(logEvent{Level: "info", Event: "start"})
+	startTime := time.Now()
+
+	err := convertWithTimeout(ctx, dbfFile, func(ctx context.Context) error {
+		return convertTable(ctx, dbfFile, delimiter, enc)
+	})
+	elapsed := time.Since(startTime)
+	serve.RecordConversion(err, elapsed)
+	if err != nil {
+		logFailure(dbfFile, elapsed, err)
+		return err
+	}
+
+	fmt.Printf("Done: %s (Time: %.3fs)\n", dbfFile, elapsed.Seconds())
+	emitLog(logEvent{Level: "info", Event: "done", Elapsed: elapsed.Seconds()})
+	return nil
+}
+
+// csvPathFor returns the CSV (or other -to file) written for a table, next
+// to it or in the local -o directory
+func csvPathFor(dbfPath string) string {
+	if flagOutput != "" && !isRemote(flagOutput) {
+		dbfPath = filepath.Join(flagOutput, filepath.Base(dbfPath))
+	}
+	if isFoxSourceTable(dbfPath) {
+		// form.scx -> form.scx.csv, so form.scx and form.vcx don't collide
+		return dbfPath + outputExts[outputFormat] + compressExts[flagCompress]
+	}
+	return strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath)) + outputExts[outputFormat] + compressExts[flagCompress]
+}
+
+// outputPathFor returns the file -only-newer compares with a table: its
+// CSV, or the first chunk with -split-rows
+func outputPathFor(dbfPath string) string {
+	if flagSplitRows > 0 {
+		return chunkPath(csvPathFor(dbfPath), 1)
+	}
+	return csvPathFor(dbfPath)
+}
+
+// upToDate reports whether output exists and is newer than every input, so
+// -only-newer can skip it (make-style). Inputs that don't exist are ignored.
+func upToDate(output string, inputs ...string) bool {
+	out, err := os.Stat(output)
+	if err != nil {
+		return false
+	}
+	for _, in := range inputs {
+		if in == "" {
 			continue
 		}
+		st, err := os.Stat(in)
+		if err == nil && !out.ModTime().After(st.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
 
-		elapsed := time.Since(startTime)
-		fmt.Printf("Done: %s (Time: %.3fs)\n", dbfFile, elapsed.Seconds())
+// convertWithTimeout runs one file's conversion, bounded by -timeout
+func convertWithTimeout(ctx context.Context, path string, convert func(context.Context) error) error {
+	if flagTimeout <= 0 {
+		return convert(ctx)
 	}
+
+	ctx, cancel := context.WithTimeout(ctx, flagTimeout)
+	defer cancel()
+
+	err := convert(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", flagTimeout, err)
+	}
+	return err
 }
 
 func parseEscapedChar(s string) rune {
@@ -143,11 +648,65 @@ func parseEscapedChar(s string) rune {
 	return r
 }
 
+// parseSize parses a byte size such as "65536", "512K" or "4MB"
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// bufferSize returns the I/O buffer size used for records of recLen bytes.
+// An explicit -bufsize wins; otherwise about 2048 records are batched per
+// flush, clamped to [256KB, 16MB], so tiny and huge records both stay efficient.
+func bufferSize(recLen int) int {
+	if bufSize > 0 {
+		return bufSize
+	}
+	size := recLen * 2048
+	if size < 256*1024 {
+		size = 256 * 1024
+	}
+	if size > 16*1024*1024 {
+		size = 16 * 1024 * 1024
+	}
+	return size
+}
+
+// utf16LE and utf16BE never add or strip a BOM themselves: parallel workers
+// encode every chunk separately, so the BOM is written once up front instead
+var (
+	utf16LE = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	utf16BE = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+)
+
+// outputEncoding is the resolved CSV encoding (-oe, defaulting to -e)
+var outputEncoding encoding.Encoding
+
 func getEncoding(name string) encoding.Encoding {
 	name = strings.ToLower(strings.TrimSpace(name))
 	switch name {
 	case "utf-8", "utf8":
 		return unicode.UTF8
+	case "utf-16", "utf16", "utf-16le", "utf16le":
+		return utf16LE
+	case "utf-16be", "utf16be":
+		return utf16BE
 	case "gbk", "gb2312", "gb18030":
 		return simplifiedchinese.GB18030
 	default:
@@ -155,271 +714,470 @@ func getEncoding(name string) encoding.Encoding {
 	}
 }
 
-func convertDBFtoCSV(dbfPath string, comma rune, enc encoding.Encoding) error {
+func convertDBFtoCSV(ctx context.Context, dbfPath, csvPath string, comma rune, enc encoding.Encoding) (err error) {
 	// --- Pass 1: Read Structure ---
-	f, err := os.Open(dbfPath)
+	stages := startStages()
+	f, err := openTable(dbfPath)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
+	tablePath := trimGzip(dbfPath)
 
 	header, fields, err := readStructure(f, enc)
 	if err != nil {
 		return err
 	}
+	recoverHeaderLen(f, &header, f.read)
+	deriveRecordCount(f, &header)
+	decodeErrors.reset(header)
+	stages.done("structure", header.NumRecs)
 	fmt.Printf("  >> Version: 0x%02X, Records: %d, Fields: %d\n", header.Version, header.NumRecs, len(fields))
-
-	// --- Prepare CSV File ---
-	csvPath := strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath)) + ".csv"
-	csvFile, err := os.Create(csvPath)
-	if err != nil {
-		return fmt.Errorf("failed to create CSV: %w", err)
+	if isEncrypted(header) && recordDecrypter == nil {
+		warnf("table is flagged as encrypted; records may be scrambled (see -decrypt)")
 	}
-	defer csvFile.Close()
-
-	encodedWriter := transform.NewWriter(csvFile, enc.NewEncoder())
-
-	// Setup CSV Writer with buffer
 
-	bufWriter := bufio.NewWriterSize(encodedWriter, 4*1024*1024)
-	w := csv.NewWriter(bufWriter)
-	w.Comma = comma
-
-	if strings.Contains(flagNewline, "\r\n") {
-		w.UseCRLF = true
+	// Table and memo reads and the output writes share the -throttle rate
+	limit := newThrottle(throttleRate)
+
+	// --- Pair Memo File ---
+	var memo *memoFile
+	var memoPath string
+	if hasMemoFields(fields) {
+		if memoPath = findMemoFile(tablePath); memoPath != "" {
+			memo, err = openMemo(memoPath, header.Version, limit)
+			if err != nil {
+				return fmt.Errorf("failed to open memo file: %w", err)
+			}
+			defer memo.Close()
+			fmt.Printf("  >> Memo: %s (block size %d)\n", memoPath, memo.BlockSize())
+			debugf(1, "memo: %d bytes, %s layout", memo.Size(), memo.Layout())
+		}
+		stages.done("memo", 0)
 	}
-
-	// --- Write CSV Header ---
-	var headerRow []string
-	for _, field := range fields {
-		headerRow = append(headerRow, field.Name)
+	for _, w := range checkFileSet(tablePath, header, fields, memo) {
+		warnf("%s", w)
 	}
-	if err := w.Write(headerRow); err != nil {
-		return err
+	if flagShapefile {
+		for _, w := range checkShapefile(tablePath, header) {
+			warnf("%s", w)
+		}
 	}
-
-	// --- Pass 2: Read Data & Write ---
-	// Important: Seek exactly to HeaderLen.
-	// VFP files have a 263+ bytes backlink area between the field terminator (0x0D)
-	// and the actual data start. We must skip this area.
-	if _, err := f.Seek(int64(header.HeaderLen), 0); err != nil {
-		return fmt.Errorf("failed to seek to data: %w", err)
+	if namesPath, err := applyNameMap(tablePath, fields); err != nil {
+		warnf("%v", err)
+	} else if namesPath != "" {
+		fmt.Printf("  >> Names: %s\n", namesPath)
 	}
 
-	if err := writeRecords(f, w, header, fields, enc); err != nil {
+	// --- Prepare CSV File ---
+	// The records are read from after the header area (see seekData below);
+	// with -progress json the reader announces the table as the "schema"
+	// event once its structure is settled, which is here
+	reader := recordReader(bufio.NewReaderSize(throttleReader(f, limit), bufferSize(int(header.RecLen))), header, fields)
+	if flagProgressFormat == "json" {
+		reader.OnSchema = func(s dbf.Schema) {
+			emitSchema(dbfPath, s, fields, memoPath)
+		}
+	}
+	if _, err := reader.Schema(); err != nil {
 		return err
 	}
 
-	w.Flush()
-	return bufWriter.Flush()
-}
-
-// readStructure reads the DBF header and field definitions.
-// OPTIMIZATION: Instead of calculating field count from HeaderLen (which causes ghost columns in VFP),
-// we loop reading fields until the 0x0D terminator is found.
-func readStructure(r io.Reader, enc encoding.Encoding) (DBFHeader, []FieldInfo, error) {
-	var h DBFHeader
-	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
-		return h, nil, fmt.Errorf("failed to read header: %w", err)
+	if flagExplain {
+		explainConversion(dbfPath, csvPath, header, fields, memoPath, comma)
+		return nil
 	}
 
-	// Sanity check
-	if h.HeaderLen < 32 {
-		return h, nil, fmt.Errorf("invalid header length")
+	if sqlitePath != "" {
+		if err := f.seekData(int64(header.HeaderLen)); err != nil {
+			return fmt.Errorf("failed to seek to data: %w", err)
+		}
+		return exportSQLite(ctx, reader, dbfPath, header, fields, enc, memo)
 	}
 
-	var fields []FieldInfo
-	decoder := enc.NewDecoder()
-	maxFields := 4096 // Safety limit to prevent infinite loops on corrupted files
+	if memo != nil && flagOLEDir != "" && hasObjectFields(fields) {
+		memo.ole, err = newOLEExtractor(flagOLEDir, tablePath, csvPath)
+		if err != nil {
+			return fmt.Errorf("failed to create object directory: %w", err)
+		}
+		fmt.Printf("  >> Objects: %s\n", flagOLEDir)
+	}
 
-	for i := 0; i < maxFields; i++ {
-		// Read first byte to check for terminator (0x0D)
-		var marker [1]byte
-		if _, err := r.Read(marker[:]); err != nil {
-			return h, nil, fmt.Errorf("error reading field marker: %w", err)
+	// Benchmark mode measures the conversion without writing any output
+	var out io.Writer = io.Discard
+	if flagBench {
+		out = &benchStages
+	} else if flagSplitRows == 0 {
+		var csvFile *os.File
+		csvFile, err = os.Create(csvPath)
+		if err != nil {
+			return fmt.Errorf("failed to create CSV: %w", err)
 		}
+		defer csvFile.Close()
 
-		if marker[0] == 0x0D {
-			// End of field definitions
-			break
+		var zw io.WriteCloser
+		zw, err = newCompressor(throttleWriter(csvFile, limit))
+		if err != nil {
+			return fmt.Errorf("failed to create CSV: %w", err)
 		}
+		defer zw.Close()
+		out = zw
+
+		// Never leave a partial CSV behind on failure or interruption
+		defer func() {
+			if err != nil {
+				csvFile.Close()
+				os.Remove(csvPath)
+			}
+		}()
+	}
 
-		// Read remaining 31 bytes of the 32-byte field structure
-		var remaining [31]byte
-		if _, err := io.ReadFull(r, remaining[:]); err != nil {
-			return h, nil, fmt.Errorf("error reading field definition: %w", err)
+	// Setup the row writer with buffer: CSV in the output encoding, or
+	// UTF-8 JSON, Parquet, Avro or XLSX, which need closing to end the file
+	var bufWriter *bufio.Writer
+	var w bufferedRowWriter
+	var closer io.Closer
+	switch outputFormat {
+	case formatJSON, formatNDJSON:
+		bufWriter = bufio.NewWriterSize(out, bufferSize(int(header.RecLen)))
+		jw := newJSONWriter(bufWriter, fields, outputFormat == formatNDJSON)
+		w, closer = jw, jw
+	case formatParquet:
+		bufWriter = bufio.NewWriterSize(out, bufferSize(int(header.RecLen)))
+		pw := newParquetWriter(bufWriter, fields)
+		w, closer = pw, pw
+	case formatAvro:
+		bufWriter = bufio.NewWriterSize(out, bufferSize(int(header.RecLen)))
+		aw := newAvroWriter(bufWriter, fields, tableName(dbfPath))
+		w, closer = aw, aw
+	case formatXLSX:
+		bufWriter = bufio.NewWriterSize(out, bufferSize(int(header.RecLen)))
+		xw := newXLSXWriter(bufWriter, fields, tableName(dbfPath))
+		w, closer = xw, xw
+	default:
+		if flagBOM {
+			bom, _ := outputEncoding.NewEncoder().String("\uFEFF")
+			if _, err := io.WriteString(out, bom); err != nil {
+				return err
+			}
+		}
+		encodedWriter := transform.NewWriter(out, outputEncoding.NewEncoder())
+		bufWriter = bufio.NewWriterSize(encodedWriter, bufferSize(int(header.RecLen)))
+		cw := newCSVWriter(bufWriter, comma)
+		if flagSepLine {
+			if err := cw.WriteSepLine(); err != nil {
+				return err
+			}
 		}
+		w = cw
+	}
 
-		// Reconstruct buffer
-		fieldBuf := append(marker[:], remaining[:]...)
+	if flagSplitRows > 0 && !flagBench {
+		// The chunk files are created as the rows arrive
+		chunks := newChunkWriter(csvPath, comma, int(header.RecLen), limit)
+		defer func() {
+			if err != nil {
+				chunks.remove()
+			}
+		}()
+		w, closer = chunks, chunks
+	}
+	var join *joinWriter
+	if joinTable != nil {
+		if join, err = newJoinWriter(w, joinTable, fields); err != nil {
+			return err
+		}
+		w = join
+	}
 
-		// Field Name (bytes 0-10)
-		rawName := bytes.TrimRight(fieldBuf[0:11], "\x00")
-		// Use decoder for field names (usually ASCII, but helps with specific encodings)
-		nameStr, _, _ := transform.Bytes(decoder, rawName)
+	// --- Write Header ---
+	headerRow := headerNames(fields)
+	if flagDeletedColumn {
+		headerRow = append(headerRow, "_DELETED")
+	}
+	if err := w.Write(headerRow); err != nil {
+		return err
+	}
 
-		// Create field info
-		// Byte 11: Type, Byte 16: Length, Byte 17: Decimal count
-		info := FieldInfo{
-			Name:   string(nameStr),
-			Type:   fieldBuf[11],
-			Length: int(fieldBuf[16]),
-			Dec:    int(fieldBuf[17]),
-		}
-		fields = append(fields, info)
+	// --- Pass 2: Read Data & Write ---
+	// Important: Seek exactly to HeaderLen.
+	// VFP files have a 263+ bytes backlink area between the field terminator (0x0D)
+	// and the actual data start. We must skip this area.
+	if err := f.seekData(int64(header.HeaderLen)); err != nil {
+		return fmt.Errorf("failed to seek to data: %w", err)
 	}
 
-	return h, fields, nil
-}
+	bench := startBench()
+	progress := newProgress(dbfPath, header.NumRecs)
 
-func writeRecords(r io.Reader, w *csv.Writer, h DBFHeader, fields []FieldInfo, enc encoding.Encoding) error {
-	recordBuf := make([]byte, h.RecLen)
-	row := make([]string, len(fields))
-	decoder := enc.NewDecoder()
+	// --- Decoded Record Cache ---
+	var cache *cacheWriter
+	var cacheFile string
+	if flagCache != "" {
+		key, kerr := cacheKey(dbfPath, memoPath)
+		if kerr != nil {
+			return fmt.Errorf("failed to hash input: %w", kerr)
+		}
+		cacheFile = cachePath(key)
+		if _, serr := os.Stat(cacheFile); serr != nil {
+			cache, err = createCache(cacheFile, header, fields)
+			if err != nil {
+				return fmt.Errorf("failed to create cache: %w", err)
+			}
+			// Uses the function's named err, so a failed export drops the cache
+			defer func() {
+				if err != nil {
+					cache.abort()
+				}
+			}()
+		}
+	}
 
 	var processed uint32
+	if cacheFile != "" && cache == nil {
+		fmt.Printf("  >> Cache hit: %s\n", cacheFile)
+		processed, err = exportFromCache(ctx, cacheFile, timeWrites(w), fields, int(header.RecLen), progress)
+		if err != nil {
+			return err
+		}
 
-	for i := uint32(0); i < h.NumRecs; i++ {
-		// Read exact record length
-		_, err := io.ReadFull(r, recordBuf)
-		if err == io.EOF {
-			break
+		w.Flush()
+		if err := bufWriter.Flush(); err != nil {
+			return err
 		}
+	} else if flagJobs > 1 && outputFormat == formatCSV && flagSplitRows == 0 && joinTable == nil {
+		// Workers emit encoded CSV bytes, so after the header the output
+		// bypasses the CSV encoder
+		w.Flush()
+		if err := bufWriter.Flush(); err != nil {
+			return err
+		}
+		rawWriter := bufio.NewWriterSize(out, bufferSize(int(header.RecLen)))
+		processed, err = writeRecordsParallel(ctx, reader, rawWriter, comma, header, fields, enc, memo, progress, flagJobs, cache)
+		if err != nil {
+			return err
+		}
+		if err := rawWriter.Flush(); err != nil {
+			return err
+		}
+	} else {
+		processed, err = writeRecords(ctx, reader, timeWrites(w), header, fields, enc, memo, progress, cache)
 		if err != nil {
-			return fmt.Errorf("error reading record %d: %w", i, err)
+			return err
 		}
 
-		// Check deletion flag (Byte 0): 0x2A ('*') means deleted.
-		// We export deleted records as well, but this logic can be modified to skip them.
+		w.Flush()
+		if err := bufWriter.Flush(); err != nil {
+			return err
+		}
+	}
+	stages.done("records", processed)
 
-		offset := 1 // Start after deletion flag
-		for j, field := range fields {
-			if offset+field.Length > len(recordBuf) {
-				break
-			}
+	if closer != nil {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
 
-			// Extract raw bytes for field
-			rawField := recordBuf[offset : offset+field.Length]
+	// Finish the compressed stream, if any
+	if c, ok := out.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	stages.done("close", 0)
 
-			// Parse data based on VFP/DBF field types
-			row[j] = parseFieldData(rawField, field, decoder)
+	if processed < header.NumRecs && ctx.Err() == nil {
+		warnf("the header claims %d records, the file holds %d; exported those", header.NumRecs, processed)
+	}
+	if flagShapefile && processed != header.NumRecs {
+		warnf("exported %d records, the header says %d; attributes will not line up with shapes", processed, header.NumRecs)
+	}
 
-			offset += field.Length
-		}
+	if err := decodeErrors.finish(tablePath, flagEncoding); err != nil {
+		return err
+	}
+
+	if join != nil {
+		fmt.Printf("  >> Joined: %d of %d records matched a row of %s\n", join.matched, join.records, joinTable.path)
+	}
 
-		if err := w.Write(row); err != nil {
+	if memo != nil && memo.ole != nil {
+		if err := memo.ole.Err(); err != nil {
 			return err
 		}
+	}
 
-		processed++
-		if flagProgress > 0 && processed%uint32(flagProgress) == 0 {
-			fmt.Printf("  >> Exported %d / %d ...\r", processed, h.NumRecs)
+	if cache != nil {
+		if err := cache.commit(); err != nil {
+			warnf("failed to save cache: %v", err)
+		} else {
+			fmt.Printf("  >> Cache saved: %s\n", cacheFile)
 		}
 	}
 
-	if flagProgress > 0 {
-		fmt.Printf("  >> Exported %d / %d ...\n", processed, h.NumRecs)
+	if flagBench {
+		bench.report(processed, int64(processed)*int64(header.RecLen))
 	}
 	return nil
 }
 
-// parseFieldData converts raw bytes to string based on DBF field type.
-// Supports VFP specific types (Integer, Currency, Double, DateTime).
-func parseFieldData(raw []byte, f FieldInfo, decoder *encoding.Decoder) string {
-	switch f.Type {
-	case 'I': // Integer (4 bytes, Little Endian) - VFP
-		if len(raw) == 4 {
-			val := int32(binary.LittleEndian.Uint32(raw))
-			return fmt.Sprintf("%d", val)
-		}
-		return ""
+// readStructure reads the DBF header and field definitions with the dbf
+// package, and prints them at -v (and their bytes at -vv)
+func readStructure(r io.Reader, enc encoding.Encoding) (DBFHeader, []FieldInfo, error) {
+	// Keep the header bytes (a few KB at most) for the debug output
+	var raw bytes.Buffer
+	s, err := dbf.ReadStructure(io.TeeReader(r, &raw), &dbf.Options{Encoding: enc, Clipper: flagClipper})
+	h := s.Header
+	if h != (DBFHeader{}) {
+		debugHeader(h)
+	}
 
-	case 'Y': // Currency (8 bytes, int64 scaled by 10000) - VFP
-		if len(raw) == 8 {
-			val := int64(binary.LittleEndian.Uint64(raw))
-			return fmt.Sprintf("%.4f", float64(val)/10000.0)
+	// dBase 7 (level 7) tables have a language driver name after the
+	// header and 48-byte field descriptors with 32-character names
+	descStart, descLen := 32, 32
+	if h.Level7() {
+		descStart, descLen = 32+36, 48
+		debugf(1, "dBase 7 table: 36-byte language driver, 48-byte field descriptors")
+	}
+	if raw.Len() > descStart {
+		desc := raw.Bytes()[descStart:]
+		terminated := err == nil || len(desc)%descLen == 1 && desc[len(desc)-1] == 0x0D
+		if terminated {
+			desc = desc[:len(desc)-1]
 		}
-		return ""
-
-	case 'B': // Double (8 bytes IEEE 754) - VFP
-		if len(raw) == 8 {
-			bits := binary.LittleEndian.Uint64(raw)
-			val := math.Float64frombits(bits)
-			return fmt.Sprintf("%v", val)
+		for i := 0; i*descLen < len(desc); i++ {
+			debugf(2, "descriptor %d:", i+1)
+			debugHex(int64(descStart+i*descLen), desc[i*descLen:min((i+1)*descLen, len(desc))])
 		}
-		return ""
+		if terminated {
+			debugf(1, "field terminator 0x0D after %d descriptors", len(desc)/descLen)
+		}
+	}
+	if err != nil {
+		return h, nil, err
+	}
+	if s.Clipper {
+		debugf(1, "character fields with decimals read as Clipper long fields, record length %d", h.RecLen)
+	}
 
-	case 'T': // DateTime (8 bytes) - VFP
-		if len(raw) == 8 {
-			julianDay := binary.LittleEndian.Uint32(raw[:4])
-			millis := binary.LittleEndian.Uint32(raw[4:])
+	fields := make([]FieldInfo, len(s.Fields))
+	for i, f := range s.Fields {
+		fields[i] = FieldInfo{Field: f}
+	}
+	debugFields(fields)
+	return h, fields, nil
+}
 
-			if julianDay == 0 && millis == 0 {
-				return ""
-			}
-			t := julianDayToTime(int(julianDay), int(millis))
-			return t.Format("2006-01-02 15:04:05")
+// hasMemoFields reports whether any field keeps its data in the memo file
+func hasMemoFields(fields []FieldInfo) bool {
+	for _, f := range fields {
+		if f.Type == 'M' || f.Type == 'G' || f.Type == 'W' || f.Type == 'P' {
+			return true
 		}
-		return ""
+	}
+	return false
+}
 
-	case 'D': // Date (ASCII YYYYMMDD)
-		s := string(raw)
-		if len(s) == 8 && strings.TrimSpace(s) != "" {
-			return fmt.Sprintf("%s-%s-%s", s[0:4], s[4:6], s[6:8])
-		}
-		return strings.TrimSpace(s)
+// rowWriter receives the rows of an export: a CSV or JSON file, or a
+// database
+type rowWriter interface {
+	Write(row []string) error
+}
+
+// bufferedRowWriter is a rowWriter that buffers rows until Flush
+type bufferedRowWriter interface {
+	rowWriter
+	Flush()
+}
 
-	case 'L': // Logical
-		s := strings.ToUpper(string(raw))
-		if s == "Y" || s == "T" {
-			return "TRUE"
-		} else if s == "N" || s == "F" {
-			return "FALSE"
+func writeRecords(ctx context.Context, reader *dbf.Reader, w rowWriter, h DBFHeader, fields []FieldInfo, enc encoding.Encoding, memo *memoFile, progress *progressReporter, cache *cacheWriter) (uint32, error) {
+	recLen := int(h.RecLen)
+	rb := newRowBuilder(fields, enc, recLen, memo)
+
+	// Start the read stage; it stops early if we return on a write error
+	readCtx, cancel := context.WithCancel(ctx)
+	batches := reader.Batches(readCtx, 4)
+	defer func() {
+		cancel()
+		for b := range batches {
+			b.Release()
 		}
-		return ""
+	}()
 
-	case 'M', 'G': // Memo / General (OLE)
-		// Data stored in external .fpt/.dbt file.
-		// This converter only handles the main .dbf file.
-		return "[MEMO/OLE]"
+	var processed, filtered uint32
 
-	case 'F', 'N': // Numeric / Float (ASCII)
-		return strings.TrimSpace(string(raw))
+	for b := range batches {
+		if err := ctx.Err(); err != nil {
+			b.Release()
+			return processed, fmt.Errorf("stopped after %d records: %w", processed, err)
+		}
+
+		for k := 0; k < b.Count; k++ {
+			record := b.Record(k)
+			processed++
+
+			if cache != nil {
+				// Cache every record so later runs can filter differently
+				row := rb.build(record, processed)
+				cache.add(record[0] == '*', row)
+				if !exportRecord(record) {
+					filtered++
+				} else if err := w.Write(withStatus(row, record)); err != nil {
+					b.Release()
+					return processed, fmt.Errorf("record %d: %w", processed, err)
+				}
+			} else if exportRecord(record) {
+				if err := w.Write(withStatus(rb.build(record, processed), record)); err != nil {
+					b.Release()
+					return processed, fmt.Errorf("record %d: %w", processed, err)
+				}
+			} else {
+				filtered++
+			}
 
-	default: // Character (C) and others
-		// Optimization: Decode first, THEN trim.
-		// Trimming raw bytes before decoding corrupts multi-byte encodings (like GBK)
-		// where a trailing byte might legally be 0x20.
+			progress.update(processed, int64(processed)*int64(recLen))
+		}
 
-		// 1. Decode bytes using specified encoding
-		decodedBytes, _, err := transform.Bytes(decoder, raw)
-		strVal := ""
+		err := batchErr(b)
+		b.Release()
 		if err != nil {
-			// Fallback to raw string if decoding fails
-			strVal = string(raw)
-		} else {
-			strVal = string(decodedBytes)
+			return processed, err
 		}
+	}
+
+	finishRecords(progress, processed, filtered, recLen)
+	return processed, nil
+}
 
-		// 2. Remove VFP null terminators and surrounding spaces
-		return strings.TrimSpace(strings.TrimRight(strVal, "\x00"))
+// finishRecords reports the final counts of an export
+func finishRecords(progress *progressReporter, processed, filtered uint32, recLen int) {
+	progress.finish(processed, int64(processed)*int64(recLen))
+	serve.AddRows(int64(processed - filtered))
+	if filtered > 0 {
+		fmt.Printf("  >> Filtered %d records (-deleted %s)\n", filtered, flagDeleted)
 	}
 }
 
-// julianDayToTime converts VFP Julian Day + Milliseconds to Go Time.
-// Algorithm based on Fliegel and Van Flandern (1968).
-func julianDayToTime(jd int, millis int) time.Time {
-	l := jd + 68569
-	n := (4 * l) / 146097
-	l = l - (146097*n+3)/4
-	i := (4000 * (l + 1)) / 1461001
-	l = l - (1461*i)/4 + 31
-	j := (80 * l) / 2447
-	d := l - (2447*j)/80
-	l = j / 11
-	m := j + 2 - 12*l
-	y := 100*(n-49) + i + l
-
-	seconds := millis / 1000
-	return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC).Add(time.Duration(seconds) * time.Second)
+// newCSVWriter creates a CSV writer using the output delimiter, quote
+// character and line ending
+func newCSVWriter(w io.Writer, comma rune) *csvWriter {
+	cw := newCSVRecordWriter(w, comma, quoteChar)
+	cw.Quoting = quoting
+	cw.Newline = newline
+	return cw
+}
+
+// exportRecord applies the -deleted policy to a raw record.
+// The deletion flag (byte 0) is 0x2A ('*') for deleted records.
+func exportRecord(record []byte) bool {
+	deleted := record[0] == '*'
+	switch flagDeleted {
+	case "skip":
+		return !deleted
+	case "only":
+		return deleted
+	default:
+		return true
+	}
 }
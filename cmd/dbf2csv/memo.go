@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dabiaoge/csv2dbf/dbf"
+)
+
+// memoExts maps a table extension to the extension of its memo file.
+// Besides plain tables this covers the FoxPro source artifacts (forms,
+// class libraries, reports, labels, menus, projects, databases), which are
+// ordinary DBF+FPT pairs under different names.
+var memoExts = map[string][]string{
+	".dbf": {".fpt", ".dbt"},
+	".scx": {".sct"},
+	".vcx": {".vct"},
+	".frx": {".frt"},
+	".lbx": {".lbt"},
+	".mnx": {".mnt"},
+	".pjx": {".pjt"},
+	".dbc": {".dct"},
+}
+
+// isFoxSourceTable reports whether path is a FoxPro form/report/class
+// library etc. rather than a plain data table
+func isFoxSourceTable(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	_, ok := memoExts[ext]
+	return ok && ext != ".dbf"
+}
+
+// memoFile is a .fpt/.dbt memo file opened for random access
+type memoFile struct {
+	*dbf.Memo
+	f    *os.File
+	path string
+	fpt  bool          // FoxPro layout (typed, length-prefixed blocks)
+	ole  *oleExtractor // with -ole-dir, G objects are saved as files
+}
+
+// findMemoFile returns the memo file paired with a table, or "" if none
+// exists. A compressed memo file (data.fpt.gz, as csv2dbf -compress writes
+// it) is found too; openMemo decompresses it or rejects it.
+func findMemoFile(dbfPath string) string {
+	for _, memoExt := range memoExts[strings.ToLower(filepath.Ext(dbfPath))] {
+		for _, ext := range []string{memoExt, memoExt + ".gz", memoExt + ".zst"} {
+			if p := findSibling(dbfPath, ext); p != "" {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// openMemo opens a memo file; version is the DBF version byte, which tells
+// dBase III (0x83) and dBase IV (0x8B) .dbt layouts apart. Reads are paced
+// by limit, if it is set. A .gz memo file is decompressed to a temporary
+// file first, since memo blocks are read at random.
+func openMemo(path string, version byte, limit *throttle) (*memoFile, error) {
+	if isZstd(path) {
+		return nil, fmt.Errorf("%s: zstd-compressed memo files are not supported; decompress it first (zstd -d)", path)
+	}
+	var f *os.File
+	var err error
+	if isGzip(path) {
+		f, err = gunzipTemp(path)
+	} else {
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		closeMemoFile(f, path)
+		return nil, err
+	}
+
+	fpt := !strings.EqualFold(filepath.Ext(trimGzip(path)), ".dbt")
+	memo, err := dbf.NewMemo(throttleReaderAt(f, limit), st.Size(), fpt, version)
+	if err != nil {
+		closeMemoFile(f, path)
+		return nil, err
+	}
+	return &memoFile{Memo: memo, f: f, path: path, fpt: fpt}, nil
+}
+
+func (m *memoFile) Close() error {
+	return closeMemoFile(m.f, m.path)
+}
+
+// closeMemoFile closes a memo file opened for path, removing it when it is
+// the decompressed copy of a .gz file
+func closeMemoFile(f *os.File, path string) error {
+	err := f.Close()
+	if isGzip(path) {
+		os.Remove(f.Name())
+	}
+	return err
+}
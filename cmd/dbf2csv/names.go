@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nameMap is the names sidecar csv2dbf -names-map writes next to a table:
+// the original CSV column of each DBF field
+type nameMap struct {
+	Columns []struct {
+		Field  string `json:"field"`
+		Column string `json:"column"`
+	} `json:"columns"`
+}
+
+func namesPathFor(dbfPath string) string {
+	return strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath)) + ".names.json"
+}
+
+// applyNameMap sets the Column of each field listed in the table's names
+// sidecar and returns the sidecar path, or "" if the table has none
+func applyNameMap(dbfPath string, fields []FieldInfo) (string, error) {
+	path := namesPathFor(dbfPath)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var m nameMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	columns := make(map[string]string, len(m.Columns))
+	for _, c := range m.Columns {
+		columns[strings.ToUpper(c.Field)] = c.Column
+	}
+	for i := range fields {
+		fields[i].Column, fields[i].Mapped = columns[strings.ToUpper(fields[i].Name)]
+	}
+	return path, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// oleExtractor writes the objects of General (G) fields to files in the
+// -ole-dir directory, one per record and field, so the CSV can reference
+// them by path. It is shared by the -j workers.
+type oleExtractor struct {
+	dir    string // where the files go
+	rel    string // dir as seen from the CSV file, for the cells
+	prefix string // table name, keeping the files of several tables apart
+
+	mu  sync.Mutex
+	err error // first write error, reported once the export ends
+}
+
+func newOLEExtractor(dir, dbfPath, csvPath string) (*oleExtractor, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	e := &oleExtractor{dir: dir, rel: dir, prefix: strings.TrimSuffix(filepath.Base(dbfPath), filepath.Ext(dbfPath))}
+	if abs, err := filepath.Abs(dir); err == nil {
+		if csvDir, err := filepath.Abs(filepath.Dir(csvPath)); err == nil {
+			if rel, err := filepath.Rel(csvDir, abs); err == nil {
+				e.rel = rel
+			}
+		}
+	}
+	return e, nil
+}
+
+// isObject reports whether f holds objects -ole-dir extracts: General (OLE)
+// and Picture fields
+func isObject(f FieldInfo) bool {
+	return f.Type == 'G' || f.Type == 'P'
+}
+
+// hasObjectFields reports whether any field holds objects
+func hasObjectFields(fields []FieldInfo) bool {
+	for _, f := range fields {
+		if isObject(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// imageSignatures name the image formats recognized by their first bytes
+var imageSignatures = []struct {
+	magic []byte
+	ext   string
+}{
+	{[]byte("\x89PNG\r\n\x1a\n"), ".png"},
+	{[]byte("\xff\xd8\xff"), ".jpg"},
+	{[]byte("GIF8"), ".gif"},
+	{[]byte("BM"), ".bmp"},
+}
+
+// objectExt returns the file extension for an extracted object
+func objectExt(data []byte) string {
+	for _, sig := range imageSignatures {
+		if bytes.HasPrefix(data, sig.magic) {
+			return sig.ext
+		}
+	}
+	return ".bin"
+}
+
+// extract saves the object of one G field and appends its path relative to
+// the CSV to dst. Empty objects produce no file and an empty cell.
+func (e *oleExtractor) extract(dst []byte, data []byte, recno uint32, field string) []byte {
+	if len(data) == 0 {
+		return dst
+	}
+	name := e.prefix + "_" + strconv.FormatUint(uint64(recno), 10) + "_" + safeFileName(field) + objectExt(data)
+	if err := os.WriteFile(filepath.Join(e.dir, name), data, 0644); err != nil {
+		e.mu.Lock()
+		if e.err == nil {
+			e.err = fmt.Errorf("record %d, field %s: failed to extract object: %w", recno, field, err)
+		}
+		e.mu.Unlock()
+		return dst
+	}
+	return append(dst, filepath.ToSlash(filepath.Join(e.rel, name))...)
+}
+
+// safeFileName makes a field name usable as part of a file name: it keeps
+// only the last path element and replaces every character other than
+// letters, digits, '-' and '_' with '_', so a name read from the table can
+// never leave -ole-dir
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, filepath.Base(name))
+}
+
+// Err returns the first failed extraction
+func (e *oleExtractor) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
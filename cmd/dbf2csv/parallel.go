@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding"
+
+	"github.com/dabiaoge/csv2dbf/dbf"
+)
+
+// chunkResult is one batch serialized to encoded CSV bytes by a worker
+type chunkResult struct {
+	seq      int
+	records  uint32 // records read from the table
+	filtered uint32 // records dropped by -deleted
+	buf      *bytes.Buffer
+	err      error
+}
+
+var chunkBufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// writeRecordsParallel is the -j N variant of writeRecords. Record batches
+// are handed to N workers, each of which parses, quotes and encodes its
+// batch into a private buffer with its own decoder/encoder; the buffers are
+// then merged in batch order, so the output is identical to a sequential run.
+// out receives already encoded bytes and must bypass the CSV encoder.
+// When cache is set, the same batches are teed to a goroutine filling it.
+func writeRecordsParallel(ctx context.Context, reader *dbf.Reader, out *bufio.Writer, comma rune, h DBFHeader, fields []FieldInfo, enc encoding.Encoding, memo *memoFile, progress *progressReporter, workers int, cache *cacheWriter) (uint32, error) {
+	recLen := int(h.RecLen)
+	benchStages.workers.Store(int64(workers))
+
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan chunkResult, workers*2)
+
+	var readers, wg sync.WaitGroup
+	var batches <-chan *dbf.Batch
+	if cache != nil {
+		outs := reader.Tee(ctx, 2, workers*2)
+		batches = outs[0]
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			fillCache(outs[1], cache, fields, enc, memo, recLen)
+		}()
+	} else {
+		batches = reader.Batches(ctx, workers*2)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serializeBatches(ctx, batches, results, comma, fields, enc, memo, recLen)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	defer func() {
+		cancel()
+		for res := range results {
+			chunkBufPool.Put(res.buf)
+		}
+		readers.Wait()
+		for b := range batches {
+			b.Release()
+		}
+	}()
+
+	// --- Ordered Merge ---
+	var processed, filtered uint32
+	pending := make(map[int]chunkResult)
+	next := 0
+
+	for res := range results {
+		pending[res.seq] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			_, werr := out.Write(res.buf.Bytes())
+			chunkBufPool.Put(res.buf)
+			processed += res.records
+			filtered += res.filtered
+			progress.update(processed, int64(processed)*int64(recLen))
+
+			if werr != nil {
+				return processed, werr
+			}
+			if res.err != nil {
+				return processed, res.err
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return processed, fmt.Errorf("stopped after %d records: %w", processed, err)
+		}
+	}
+
+	// Results closed early means the context was cancelled before all batches arrived
+	if err := ctx.Err(); err != nil {
+		return processed, fmt.Errorf("stopped after %d records: %w", processed, err)
+	}
+
+	finishRecords(progress, processed, filtered, recLen)
+	return processed, nil
+}
+
+// serializeBatches is a worker of writeRecordsParallel
+func serializeBatches(ctx context.Context, batches <-chan *dbf.Batch, results chan<- chunkResult, comma rune, fields []FieldInfo, enc encoding.Encoding, memo *memoFile, recLen int) {
+	rb := newRowBuilder(fields, enc, recLen, memo)
+	encoder := outputEncoding.NewEncoder()
+	encode := appendTransformed
+	if outputEncoding == utf16LE || outputEncoding == utf16BE {
+		encode = transformBytes // not ASCII-compatible
+	}
+	var utf8Buf bytes.Buffer
+	cw := newCSVWriter(&utf8Buf, comma)
+	w := timeWrites(cw)
+
+	for b := range batches {
+		res := chunkResult{seq: b.Seq, records: uint32(b.Count), err: batchErr(b)}
+
+		utf8Buf.Reset()
+		for k := 0; k < b.Count; k++ {
+			record := b.Record(k)
+			if !exportRecord(record) {
+				res.filtered++
+				continue
+			}
+			recno := b.First + uint32(k) + 1
+			if err := w.Write(withStatus(rb.build(record, recno), record)); err != nil && res.err == nil {
+				res.err = fmt.Errorf("record %d: %w", recno, err)
+			}
+		}
+		cw.Flush()
+		b.Release()
+
+		start := time.Now()
+		res.buf = chunkBufPool.Get().(*bytes.Buffer)
+		res.buf.Reset()
+		res.buf.Write(encode(res.buf.AvailableBuffer(), utf8Buf.Bytes(), encoder))
+		if flagBench {
+			since(&benchStages.encode, start)
+		}
+
+		select {
+		case results <- res:
+		case <-ctx.Done():
+			chunkBufPool.Put(res.buf)
+			return
+		}
+	}
+}
+
+// fillCache decodes every record of the teed batches into the cache
+func fillCache(batches <-chan *dbf.Batch, cache *cacheWriter, fields []FieldInfo, enc encoding.Encoding, memo *memoFile, recLen int) {
+	rb := newRowBuilder(fields, enc, recLen, memo)
+	rb.report = false // the export workers report the same records
+	rb.timed = false  // nor is filling the cache part of the export
+	for b := range batches {
+		for k := 0; k < b.Count; k++ {
+			record := b.Record(k)
+			cache.add(record[0] == '*', rb.build(record, b.First+uint32(k)+1))
+		}
+		b.Release()
+	}
+}
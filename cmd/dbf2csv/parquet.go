@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetColumn is the Parquet type of a column and how its cells are
+// converted; cells that don't convert are written as null and reported
+type parquetColumn struct {
+	node  parquet.Node
+	value func(cell string) (parquet.Value, bool)
+	text  bool // character data: blank cells are empty strings, not null
+}
+
+var (
+	parquetString = parquetColumn{node: parquet.String(), text: true, value: func(cell string) (parquet.Value, bool) {
+		return parquet.ByteArrayValue([]byte(cell)), true
+	}}
+	parquetBytes = parquetColumn{node: parquet.Leaf(parquet.ByteArrayType), value: func(cell string) (parquet.Value, bool) {
+		data, err := decodeBinary(cell)
+		return parquet.ByteArrayValue(data), err == nil
+	}}
+	parquetDouble = parquetColumn{node: parquet.Leaf(parquet.DoubleType), value: func(cell string) (parquet.Value, bool) {
+		v, err := strconv.ParseFloat(cell, 64)
+		return parquet.DoubleValue(v), err == nil && !math.IsInf(v, 0) && !math.IsNaN(v)
+	}}
+	parquetInt32 = parquetColumn{node: parquet.Int(32), value: func(cell string) (parquet.Value, bool) {
+		v, err := strconv.ParseInt(cell, 10, 32)
+		return parquet.Int32Value(int32(v)), err == nil
+	}}
+	parquetInt64 = parquetColumn{node: parquet.Int(64), value: func(cell string) (parquet.Value, bool) {
+		v, err := strconv.ParseInt(cell, 10, 64)
+		return parquet.Int64Value(v), err == nil
+	}}
+	parquetBool = parquetColumn{node: parquet.Leaf(parquet.BooleanType), value: func(cell string) (parquet.Value, bool) {
+		return parquet.BooleanValue(cell == boolTrue), cell == boolTrue || cell == boolFalse
+	}}
+	parquetDate = parquetColumn{node: parquet.Date(), value: func(cell string) (parquet.Value, bool) {
+		days, ok := parseDateCell(cell)
+		return parquet.Int32Value(days), ok
+	}}
+	parquetTimestamp = parquetColumn{node: parquet.Timestamp(parquet.Millisecond), value: func(cell string) (parquet.Value, bool) {
+		ms, ok := parseDateTimeCell(cell)
+		return parquet.Int64Value(ms), ok
+	}}
+)
+
+// parquetDecimal is a DECIMAL column with scale digits after the point
+func parquetDecimal(scale, precision int) parquetColumn {
+	if precision <= 9 {
+		return parquetColumn{node: parquet.Decimal(scale, precision, parquet.Int32Type), value: func(cell string) (parquet.Value, bool) {
+			v, ok := parseDecimal(cell, scale)
+			return parquet.Int32Value(int32(v)), ok && v >= math.MinInt32 && v <= math.MaxInt32
+		}}
+	}
+	return parquetColumn{node: parquet.Decimal(scale, precision, parquet.Int64Type), value: func(cell string) (parquet.Value, bool) {
+		v, ok := parseDecimal(cell, scale)
+		return parquet.Int64Value(v), ok
+	}}
+}
+
+// parquetColumnFor maps a DBF field to a Parquet column: N fields become
+// integers or decimals of their declared size (doubles when too wide),
+// Y fields DECIMAL(18,4), D dates and T timestamps
+func parquetColumnFor(f FieldInfo) parquetColumn {
+	switch f.Type {
+	case 'N':
+		if f.Dec == 0 && f.Length <= 9 {
+			return parquetInt32
+		}
+		if f.Dec == 0 && f.Length <= 18 {
+			return parquetInt64
+		}
+		// The digits that fit beside the point: N(10,2) holds 9999999.99
+		if precision := max(f.Length-1, f.Dec); precision <= 18 {
+			return parquetDecimal(f.Dec, precision)
+		}
+		return parquetDouble
+	case 'F', 'B', 'O':
+		return parquetDouble
+	case 'I', '+':
+		return parquetInt32
+	case 'Y':
+		return parquetDecimal(4, 18)
+	case 'D':
+		return parquetDate
+	case 'T', '@':
+		return parquetTimestamp
+	case 'L':
+		return parquetBool
+	case 'Q':
+		return parquetBytes
+	}
+	if isBinaryMemo(f) {
+		return parquetBytes
+	}
+	return parquetString
+}
+
+// parquetGroup is a parquet.Group whose fields keep the column order of the
+// table instead of being sorted by name
+type parquetGroup struct {
+	parquet.Group
+	names []string
+}
+
+func (g parquetGroup) Fields() []parquet.Field {
+	fields := g.Group.Fields()
+	slices.SortFunc(fields, func(a, b parquet.Field) int {
+		return slices.Index(g.names, a.Name()) - slices.Index(g.names, b.Name())
+	})
+	return fields
+}
+
+// parquetWriter writes rows to a Parquet file with Snappy-compressed
+// columns. The first row written is the header row, which names the
+// columns; all columns are optional, so blank cells are null.
+type parquetWriter struct {
+	w       *bufio.Writer
+	columns []parquetColumn
+	pw      *parquet.Writer
+	row     parquet.Row
+	rows    []parquet.Row
+	written int
+	failed  convertReport
+}
+
+func newParquetWriter(w *bufio.Writer, fields []FieldInfo) *parquetWriter {
+	columns := make([]parquetColumn, len(fields))
+	for i, f := range fields {
+		columns[i] = parquetColumnFor(f)
+	}
+	if flagDeletedColumn {
+		columns = append(columns, parquetBool)
+	}
+	return &parquetWriter{w: w, columns: columns}
+}
+
+func (pw *parquetWriter) Write(row []string) error {
+	if pw.pw == nil {
+		group := parquet.Group{}
+		for i, name := range row {
+			if _, dup := group[name]; dup {
+				return fmt.Errorf("duplicate column name '%s'", name)
+			}
+			group[name] = parquet.Optional(pw.columns[i].node)
+		}
+		schema := parquet.NewSchema("dbf", parquetGroup{Group: group, names: slices.Clone(row)})
+		pw.pw = parquet.NewWriter(pw.w, schema, parquet.Compression(&parquet.Snappy))
+		pw.row = make(parquet.Row, len(row))
+		pw.rows = []parquet.Row{pw.row}
+		pw.failed.names = slices.Clone(row)
+		return nil
+	}
+
+	pw.written++
+	for i, cell := range row {
+		v, def := parquet.NullValue(), 0
+		if c := pw.columns[i]; cell != flagNull || flagNull == "" && c.text {
+			if val, ok := c.value(cell); ok {
+				v, def = val, 1
+			} else if cell != "" {
+				pw.failed.add(pw.written, i, cell)
+			}
+		}
+		pw.row[i] = v.Level(0, def, i)
+	}
+	_, err := pw.pw.WriteRows(pw.rows)
+	return err
+}
+
+// Flush is a no-op: the Parquet writer buffers whole row groups
+func (pw *parquetWriter) Flush() {}
+
+// Close writes the last row group and the file footer, and flushes the
+// underlying buffer
+func (pw *parquetWriter) Close() error {
+	pw.failed.finish("Parquet")
+	if err := pw.pw.Close(); err != nil {
+		return err
+	}
+	return pw.w.Flush()
+}
+
+// parseDecimal parses a decimal such as "-1,234.5" into an integer count of
+// 10^-scale units, rounding half away from zero. Thousands separators (from
+// -currency grouped) are ignored.
+func parseDecimal(s string, scale int) (int64, bool) {
+	s = strings.ReplaceAll(s, ",", "")
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, false
+	}
+
+	digits := whole + (frac + strings.Repeat("0", scale))[:scale]
+	var n int64
+	for _, c := range digits {
+		if c < '0' || c > '9' || n > (math.MaxInt64-9)/10 {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if len(frac) > scale {
+		for _, c := range frac[scale:] {
+			if c < '0' || c > '9' {
+				return 0, false
+			}
+		}
+		if frac[scale] >= '5' {
+			n++
+		}
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
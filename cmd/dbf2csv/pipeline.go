@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dabiaoge/csv2dbf/dbf"
+)
+
+// recordReader returns a dbf.Reader for the records of a table; r is
+// positioned at the first record. -lenient and -decrypt are applied as the
+// records are read. Its batches are the read stage of the export pipeline,
+// so disk I/O overlaps with parsing and CSV encoding.
+func recordReader(r io.Reader, h DBFHeader, fields []FieldInfo) *dbf.Reader {
+	schema := dbf.Schema{Header: h, Fields: make([]dbf.Field, len(fields))}
+	for i, f := range fields {
+		schema.Fields[i] = f.Field
+	}
+	reader := dbf.NewRecordReader(r, schema)
+	reader.Lenient = flagLenient
+	reader.Decrypt = recordDecrypter
+	return reader
+}
+
+// batchErr returns the read error that ended the records after b, if any
+func batchErr(b *dbf.Batch) error {
+	if errors.Is(b.Err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w, see -lenient", b.Err)
+	}
+	return b.Err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dabiaoge/csv2dbf/dbf"
+)
+
+// progressEvent is one line of -progress json output
+type progressEvent struct {
+	Event   string  `json:"event"`
+	File    string  `json:"file"`
+	Rows    uint32  `json:"rows"`
+	Total   uint32  `json:"total"`
+	Bytes   int64   `json:"bytes"`
+	Elapsed float64 `json:"elapsed"`
+}
+
+// schemaEvent is emitted with -progress json once a table's header has been
+// parsed, before any "progress" event, so a UI can show the table layout
+// while rows are still being converted
+type schemaEvent struct {
+	Event          string        `json:"event"`
+	File           string        `json:"file"`
+	Version        string        `json:"version"`
+	CodePage       int           `json:"codepage,omitempty"`
+	Encoding       string        `json:"encoding"`
+	Records        uint32        `json:"records"`
+	RecordLength   int           `json:"record_length"`
+	EstimatedBytes int64         `json:"estimated_bytes"`
+	Memo           string        `json:"memo,omitempty"`
+	Fields         []schemaField `json:"fields"`
+}
+
+type schemaField struct {
+	Name   string `json:"name"`
+	Column string `json:"column"`
+	Type   string `json:"type"`
+	Length int    `json:"length"`
+	Dec    int    `json:"dec,omitempty"`
+}
+
+// emitSchema writes the "schema" event for a table; it is the OnSchema
+// callback of the table's dbf.Reader
+func emitSchema(file string, s dbf.Schema, fields []FieldInfo, memoPath string) {
+	h := s.Header
+	ev := schemaEvent{
+		Event:          "schema",
+		File:           file,
+		Version:        fmt.Sprintf("0x%02X", h.Version),
+		CodePage:       s.CodePage(),
+		Encoding:       strings.ToUpper(flagEncoding),
+		Records:        h.NumRecs,
+		RecordLength:   int(h.RecLen),
+		EstimatedBytes: s.Size(),
+		Memo:           memoPath,
+		Fields:         make([]schemaField, len(fields)),
+	}
+	for i, name := range headerNames(fields) {
+		f := fields[i]
+		ev.Fields[i] = schemaField{Name: f.Name, Column: name, Type: string(f.Type), Length: f.Length, Dec: f.Dec}
+	}
+	line, _ := json.Marshal(ev)
+	fmt.Fprintf(os.Stderr, "%s\n", line)
+}
+
+// progressReporter prints conversion progress, either as the human
+// "Exported N / M" line on stdout or as JSON events on stderr.
+// Text output is driven by -c; JSON events are emitted every -c rows, or
+// once per second when -c is 0, plus a final "done" event.
+type progressReporter struct {
+	file  string
+	total uint32
+	start time.Time
+	last  time.Time
+	rows  uint32 // rows at the previous update
+}
+
+func newProgress(file string, total uint32) *progressReporter {
+	now := time.Now()
+	return &progressReporter{file: file, total: total, start: now, last: now}
+}
+
+// update is called as records complete (per record or per batch);
+// n is the number of record bytes done
+func (p *progressReporter) update(rows uint32, n int64) {
+	prev := p.rows
+	p.rows = rows
+
+	if flagProgressFormat == "json" {
+		if flagProgress > 0 {
+			if crossed(prev, rows, uint32(flagProgress)) {
+				p.emit("progress", rows, n)
+			}
+		} else if crossed(prev, rows, 1024) && time.Since(p.last) >= time.Second {
+			p.emit("progress", rows, n)
+		}
+		return
+	}
+
+	if flagProgress > 0 && crossed(prev, rows, uint32(flagProgress)) {
+		fmt.Printf("  >> Exported %d / %d ...\r", rows, p.total)
+	}
+}
+
+// crossed reports whether a multiple of step lies in (prev, cur]
+func crossed(prev, cur, step uint32) bool {
+	return cur/step != prev/step
+}
+
+// finish reports the final counts
+func (p *progressReporter) finish(rows uint32, n int64) {
+	if flagProgressFormat == "json" {
+		p.emit("done", rows, n)
+		return
+	}
+
+	// Only print completion line if progress reporting was enabled
+	if flagProgress > 0 {
+		fmt.Printf("  >> Exported %d / %d ...\n", rows, p.total)
+	}
+}
+
+func (p *progressReporter) emit(event string, rows uint32, n int64) {
+	p.last = time.Now()
+	line, _ := json.Marshal(progressEvent{
+		Event:   event,
+		File:    p.file,
+		Rows:    rows,
+		Total:   p.total,
+		Bytes:   n,
+		Elapsed: p.last.Sub(p.start).Seconds(),
+	})
+	fmt.Fprintf(os.Stderr, "%s\n", line)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/encoding"
+)
+
+// isRemote reports whether path is a URL (https://, http:// or s3://)
+// rather than a local file
+func isRemote(path string) bool {
+	for _, scheme := range []string{"https://", "http://", "s3://"} {
+		if len(path) > len(scheme) && strings.EqualFold(path[:len(scheme)], scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusError is a failed HTTP or S3 request
+type statusError struct {
+	url  string
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.url, e.msg)
+}
+
+// missing reports whether a memo file probe found nothing. S3 answers 403
+// instead of 404 when the credentials may not list the bucket.
+func missing(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && (se.code == http.StatusNotFound || se.code == http.StatusForbidden)
+}
+
+// convertTable converts one table. Remote tables are downloaded with their
+// memo file into a scratch directory first, since memo blocks need random
+// access; their CSV is written to the current directory (or -o). With an
+// s3:// output the CSV is staged there too and uploaded when complete.
+func convertTable(ctx context.Context, dbfFile string, comma rune, enc encoding.Encoding) error {
+	if !isRemote(dbfFile) && !isRemote(flagOutput) {
+		return convertDBFtoCSV(ctx, dbfFile, csvPathFor(trimGzip(dbfFile)), comma, enc)
+	}
+
+	dir, err := os.MkdirTemp("", "dbf2csv-remote-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	local := dbfFile
+	if isRemote(dbfFile) {
+		if local, err = fetchRemote(ctx, dbfFile, dir); err != nil {
+			return err
+		}
+	}
+	csvPath := csvPathFor(trimGzip(filepath.Base(local)))
+	if isRemote(flagOutput) {
+		csvPath = filepath.Join(dir, filepath.Base(csvPath))
+	}
+	if err := convertDBFtoCSV(ctx, local, csvPath, comma, enc); err != nil {
+		return err
+	}
+	if !isRemote(flagOutput) || flagBench || flagExplain {
+		return nil
+	}
+	if flagSplitRows > 0 {
+		// Every chunk in the scratch directory, in order
+		for n := 1; ; n++ {
+			chunk := chunkPath(csvPath, n)
+			if _, err := os.Stat(chunk); err != nil {
+				return nil
+			}
+			if err := uploadS3(ctx, chunk, strings.TrimSuffix(flagOutput, "/")+"/"+filepath.Base(chunk)); err != nil {
+				return err
+			}
+		}
+	}
+	return uploadS3(ctx, csvPath, strings.TrimSuffix(flagOutput, "/")+"/"+filepath.Base(csvPath))
+}
+
+// fetchRemote downloads a table and its memo file, if there is one, into
+// dir under their own names, and returns the local table path
+func fetchRemote(ctx context.Context, rawURL, dir string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return "", fmt.Errorf("%s: URL has no file name", rawURL)
+	}
+	local := filepath.Join(dir, name)
+	if err := download(ctx, rawURL, local); err != nil {
+		return "", err
+	}
+
+	// The memo file sits next to the table, with an extension of the same
+	// case; next to a compressed table it is usually compressed too
+	table := trimGzip(u.Path)
+	ext := path.Ext(table)
+	var memoNames []string
+	for _, memoExt := range memoExts[strings.ToLower(ext)] {
+		if ext != strings.ToLower(ext) {
+			memoExt = strings.ToUpper(memoExt)
+		}
+		if isGzip(u.Path) {
+			memoNames = append(memoNames, memoExt+path.Ext(u.Path))
+		}
+		memoNames = append(memoNames, memoExt)
+	}
+	for _, memoExt := range memoNames {
+		m := *u
+		m.Path, m.RawPath, m.RawQuery = strings.TrimSuffix(table, ext)+memoExt, "", ""
+		err := download(ctx, m.String(), filepath.Join(dir, path.Base(m.Path)))
+		if missing(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+	return local, nil
+}
+
+// download streams a remote object into the file dst
+func download(ctx context.Context, rawURL, dst string) error {
+	var resp *http.Response
+	var err error
+	if strings.HasPrefix(strings.ToLower(rawURL), "s3://") {
+		resp, err = s3Request(ctx, http.MethodGet, rawURL, nil, 0)
+	} else {
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil); err == nil {
+			resp, err = http.DefaultClient.Do(req)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{url: rawURL, code: resp.StatusCode, msg: resp.Status}
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	fmt.Printf("  >> Downloaded: %s (%d bytes)\n", rawURL, n)
+	return nil
+}
+
+// uploadS3 copies a finished output file to an s3:// URL
+func uploadS3(ctx context.Context, src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	resp, err := s3Request(ctx, http.MethodPut, dst, f, st.Size())
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", dst, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{url: dst, code: resp.StatusCode, msg: resp.Status}
+	}
+	fmt.Printf("  >> Uploaded: %s (%d bytes)\n", dst, st.Size())
+	return nil
+}
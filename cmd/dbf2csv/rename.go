@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fieldRenames is the resolved -rename map, keyed by the upper-cased old name
+var fieldRenames map[string]string
+
+// parseRenames reads a -rename value: OLD=NEW pairs separated by commas, or
+// the path of a mapping file with one OLD=NEW pair per line ('#' comments)
+func parseRenames(spec string) (map[string]string, error) {
+	text := spec
+	if !strings.Contains(spec, "=") {
+		data, err := os.ReadFile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rename map: %w", err)
+		}
+		text = string(data)
+	}
+
+	renames := make(map[string]string)
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		old, name, ok := strings.Cut(line, "=")
+		old, name = strings.TrimSpace(old), strings.TrimSpace(name)
+		if !ok || old == "" || name == "" {
+			return nil, fmt.Errorf("invalid rename '%s' (expected OLD=NEW)", line)
+		}
+		renames[strings.ToUpper(old)] = name
+	}
+	return renames, nil
+}
+
+// headerNames returns the CSV header row for fields with -namecase and
+// -rename applied. Names restored from a names sidecar and renamed columns
+// keep the case they were given.
+func headerNames(fields []FieldInfo) []string {
+	names := make([]string, len(fields))
+	used := make(map[string]bool, len(fieldRenames))
+	for i, f := range fields {
+		switch {
+		case f.Mapped:
+			names[i] = f.Column
+		case flagNameCase == "upper":
+			names[i] = strings.ToUpper(f.Name)
+		case flagNameCase == "lower":
+			names[i] = strings.ToLower(f.Name)
+		default:
+			names[i] = f.Name
+		}
+		key := strings.ToUpper(f.Name)
+		if name, ok := fieldRenames[key]; ok {
+			names[i] = name
+			used[key] = true
+		}
+	}
+	for old := range fieldRenames {
+		if !used[old] {
+			warnf("-rename: no field named '%s'", old)
+		}
+	}
+	return names
+}
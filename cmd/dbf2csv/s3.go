@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Request sends a request for an s3://bucket/key object, signed with
+// Signature Version 4 from the standard AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables (unsigned when they
+// are not set, for public buckets). AWS_REGION picks the region, and
+// AWS_ENDPOINT_URL an S3-compatible server such as MinIO.
+func s3Request(ctx context.Context, method, rawURL string, body io.Reader, size int64) (*http.Response, error) {
+	bucket, key, _ := strings.Cut(rawURL[len("s3://"):], "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid S3 URL %q (expected s3://bucket/key)", rawURL)
+	}
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	escaped := "/" + s3Escape(key)
+	endpoint := "https://" + bucket + ".s3." + region + ".amazonaws.com"
+	if e := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); e != "" {
+		// Custom endpoints use path-style addressing
+		endpoint, escaped = strings.TrimSuffix(e, "/"), "/"+s3Escape(bucket)+escaped
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+escaped, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	signS3(req, escaped, region, time.Now().UTC())
+	return http.DefaultClient.Do(req)
+}
+
+// signS3 adds the Signature Version 4 headers; path is the URI-encoded
+// request path. The payload is not hashed (UNSIGNED-PAYLOAD), so uploads
+// can stream from the file.
+func signS3(req *http.Request, path, region string, now time.Time) {
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id == "" || secret == "" {
+		return
+	}
+	date := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", date)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(values[0])
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{req.Method, path, req.URL.RawQuery, canonical.String(), signed, "UNSIGNED-PAYLOAD"}, "\n")
+	hash := sha256.Sum256([]byte(request))
+	scope := date[:8] + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date[:8], region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		id, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape URI-encodes an object key the way Signature Version 4 expects:
+// everything but unreserved characters and '/'
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// firstEnv returns the first of the environment variables that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// countShapes returns the number of records in a .shp file. The .shx index
+// holds one 8-byte entry per record after its 100-byte header; without it
+// the records of the .shp are walked.
+func countShapes(shpPath string) (uint32, error) {
+	if shx := findSibling(shpPath, ".shx"); shx != "" {
+		st, err := os.Stat(shx)
+		if err != nil {
+			return 0, err
+		}
+		if st.Size() < 100 || (st.Size()-100)%8 != 0 {
+			return 0, fmt.Errorf("%s: invalid index size %d", shx, st.Size())
+		}
+		return uint32((st.Size() - 100) / 8), nil
+	}
+
+	f, err := os.Open(shpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// The file length (bytes 24-27) and record content lengths count
+	// 16-bit words, big-endian
+	var header [100]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	if code := binary.BigEndian.Uint32(header[0:4]); code != 9994 {
+		return 0, fmt.Errorf("not a shapefile (file code %d)", code)
+	}
+	size := int64(binary.BigEndian.Uint32(header[24:28])) * 2
+	var n uint32
+	for pos := int64(100); pos+8 <= size; n++ {
+		var rec [8]byte
+		if _, err := f.ReadAt(rec[:], pos); err != nil {
+			return 0, fmt.Errorf("failed to read record %d: %w", n+1, err)
+		}
+		pos += 8 + int64(binary.BigEndian.Uint32(rec[4:8]))*2
+	}
+	return n, nil
+}
+
+// checkShapefile compares the record count of a -shapefile attribute table
+// with the shapes of its .shp, whose records pair with the table's by
+// position, and returns warnings for a mismatch
+func checkShapefile(tablePath string, h DBFHeader) []string {
+	shp := findSibling(tablePath, ".shp")
+	if shp == "" {
+		return []string{"no .shp file next to the table; record count not checked"}
+	}
+	shapes, err := countShapes(shp)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", filepath.Base(shp), err)}
+	}
+	fmt.Printf("  >> Shapefile: %s (%d shapes)\n", shp, shapes)
+	if shapes != h.NumRecs {
+		return []string{fmt.Sprintf("table has %d records but %s has %d shapes; attributes will not line up with shapes", h.NumRecs, filepath.Base(shp), shapes)}
+	}
+	return nil
+}
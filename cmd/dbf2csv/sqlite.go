@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	_ "modernc.org/sqlite"
+
+	"github.com/dabiaoge/csv2dbf/dbf"
+)
+
+// sqlitePath is the database of -to sqlite:FILE, empty for CSV output
+var sqlitePath string
+
+// sqliteTypes maps DBF field types to SQLite column types; types not
+// listed (C, V, M, G, ...) are TEXT
+var sqliteTypes = map[byte]string{
+	'N': "NUMERIC", 'F': "REAL", 'Y': "NUMERIC",
+	'I': "INTEGER", '+': "INTEGER", 'B': "REAL", 'O': "REAL",
+	'D': "DATE", 'T': "DATETIME", '@': "DATETIME",
+	'L': "BOOLEAN", 'Q': "BLOB",
+}
+
+// sqliteType returns the SQLite column type of a field
+func sqliteType(f FieldInfo) string {
+	if isBinaryMemo(f) {
+		return "BLOB"
+	}
+	if t, ok := sqliteTypes[f.Type]; ok {
+		return t
+	}
+	return "TEXT"
+}
+
+// tableName names the table of a DBF file in outputs that hold named
+// tables (SQLite, Avro) after the file: data.dbf -> data, form.scx ->
+// form.scx (like the CSV name)
+func tableName(dbfPath string) string {
+	base := filepath.Base(trimGzip(dbfPath))
+	if isFoxSourceTable(base) {
+		return base
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// quoteIdent quotes a table or column name for SQLite
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqliteWriter inserts rows with a prepared statement; cells are converted
+// to the column types, so logicals are stored as 1/0 and blank cells as NULL
+type sqliteWriter struct {
+	stmt  *sql.Stmt
+	types []string
+	args  []any
+}
+
+func (sw *sqliteWriter) Write(row []string) error {
+	for i, cell := range row {
+		sw.args[i] = sqliteValue(cell, sw.types[i])
+	}
+	_, err := sw.stmt.Exec(sw.args...)
+	return err
+}
+
+// sqliteValue converts a cell to the value stored in a column of type typ;
+// numbers, dates and text are stored as text and SQLite applies the column
+// affinity
+func sqliteValue(cell, typ string) any {
+	if cell == flagNull {
+		return nil
+	}
+	switch typ {
+	case "BOOLEAN":
+		switch cell {
+		case boolTrue:
+			return 1
+		case boolFalse:
+			return 0
+		}
+	case "BLOB":
+		if data, err := decodeBinary(cell); err == nil {
+			return data
+		}
+	}
+	return cell
+}
+
+// exportSQLite loads the records read from r into a table of the -to
+// SQLite database named after the DBF file, replacing any table of that
+// name. The table is created and filled in one transaction, so a failed
+// or interrupted export leaves the database as it was.
+func exportSQLite(ctx context.Context, reader *dbf.Reader, dbfPath string, header DBFHeader, fields []FieldInfo, enc encoding.Encoding, memo *memoFile) error {
+	db, err := sql.Open("sqlite", sqlitePath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	names := headerNames(fields)
+	types := make([]string, len(fields))
+	for i, f := range fields {
+		types[i] = sqliteType(f)
+	}
+	if flagDeletedColumn {
+		names = append(names, "_DELETED")
+		types = append(types, "BOOLEAN")
+	}
+	columns := make([]string, len(names))
+	for i, name := range names {
+		columns[i] = quoteIdent(name) + " " + types[i]
+	}
+
+	table := tableName(dbfPath)
+	if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+quoteIdent(table)); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	create := fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(table), strings.Join(columns, ", "))
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s VALUES (%s)", quoteIdent(table), strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "))
+	stmt, err := tx.PrepareContext(ctx, insert)
+	if err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	defer stmt.Close()
+
+	w := &sqliteWriter{stmt: stmt, types: types, args: make([]any, len(names))}
+	progress := newProgress(dbfPath, header.NumRecs)
+	if _, err := writeRecords(ctx, reader, w, header, fields, enc, memo, progress, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	fmt.Printf("  >> SQLite: %s (table %s)\n", sqlitePath, table)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttle paces I/O to a fixed byte rate so large conversions don't
+// saturate shared storage. A conversion shares one throttle between the
+// table and memo reads and the output writes, so -throttle limits their
+// sum; the -j workers use it concurrently.
+type throttle struct {
+	rate  float64 // bytes per second
+	start time.Time
+
+	mu   sync.Mutex
+	done int64
+}
+
+// newThrottle returns a throttle for rate, or nil (no limit) when rate is 0
+func newThrottle(rate float64) *throttle {
+	if rate <= 0 {
+		return nil
+	}
+	return &throttle{rate: rate, start: time.Now()}
+}
+
+// wait accounts for n transferred bytes and sleeps until they fit the rate
+func (t *throttle) wait(n int) {
+	t.mu.Lock()
+	t.done += int64(n)
+	due := t.start.Add(time.Duration(float64(t.done) / t.rate * float64(time.Second)))
+	t.mu.Unlock()
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	tr.t.wait(n)
+	return n, err
+}
+
+type throttledWriter struct {
+	w io.Writer
+	t *throttle
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	n, err := tw.w.Write(p)
+	tw.t.wait(n)
+	return n, err
+}
+
+type throttledReaderAt struct {
+	r io.ReaderAt
+	t *throttle
+}
+
+func (tr *throttledReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := tr.r.ReadAt(p, off)
+	tr.t.wait(n)
+	return n, err
+}
+
+// throttleReader paces reads from r with t, if it is set
+func throttleReader(r io.Reader, t *throttle) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{r: r, t: t}
+}
+
+// throttleReaderAt paces random-access reads from r with t, if it is set
+func throttleReaderAt(r io.ReaderAt, t *throttle) io.ReaderAt {
+	if t == nil {
+		return r
+	}
+	return &throttledReaderAt{r: r, t: t}
+}
+
+// throttleWriter paces writes to w with t, if it is set
+func throttleWriter(w io.Writer, t *throttle) io.Writer {
+	if t == nil {
+		return w
+	}
+	return &throttledWriter{w: w, t: t}
+}
+
+// parseRate parses a rate such as "50MB/s" or "512K" into bytes per second
+func parseRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "/S")
+	n, err := parseSize(s)
+	return float64(n), err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// verbosity is the debug level: 1 with -v, 2 with -vv
+var verbosity int
+
+// debugf prints a debug line when the verbosity is at least level
+func debugf(level int, format string, args ...any) {
+	if verbosity >= level {
+		fmt.Printf("  [debug] "+format+"\n", args...)
+	}
+}
+
+// debugHex prints b as hex lines of 16 bytes, with their file offset, at -vv
+func debugHex(offset int64, b []byte) {
+	if verbosity < 2 {
+		return
+	}
+	for i := 0; i < len(b); i += 16 {
+		line := b[i:min(i+16, len(b))]
+		fmt.Printf("  [debug]   %06x  % x\n", offset+int64(i), line)
+	}
+}
+
+// debugHeader prints the decoded header and, at -vv, its bytes
+func debugHeader(h DBFHeader) {
+	if verbosity < 1 {
+		return
+	}
+	debugf(1, "header: version 0x%02X, updated %04d-%02d-%02d, %d records, header length %d, record length %d",
+		h.Version, 1900+int(h.Year), h.Month, h.Day, h.NumRecs, h.HeaderLen, h.RecLen)
+	debugf(1, "header: table flags 0x%02X (byte 28), language driver 0x%02X (byte 29)", h.Reserved[28-12], h.Reserved[29-12])
+	var raw bytes.Buffer
+	binary.Write(&raw, binary.LittleEndian, h)
+	debugHex(0, raw.Bytes())
+}
+
+// debugFields prints the fields as resolved from their descriptors: the
+// offsets in the record after Clipper lengths and VFP null flags
+func debugFields(fields []FieldInfo) {
+	for i, f := range fields {
+		debugf(1, "field %d %s: type %c, length %d, decimals %d, offset %d, flags 0x%02X", i+1, f.Name, f.Type, f.Length, f.Dec, f.Offset, f.Flags)
+		if f.NullAt > 0 {
+			debugf(2, "field %d %s: null bit 0x%02X at record offset %d", i+1, f.Name, f.NullMask, f.NullAt)
+		}
+		if f.VarAt > 0 {
+			debugf(2, "field %d %s: varlength bit 0x%02X at record offset %d", i+1, f.Name, f.VarMask, f.VarAt)
+		}
+	}
+}
+
+// stageTimer times the stages of a conversion for -v and -log json
+type stageTimer struct {
+	last time.Time
+}
+
+func startStages() *stageTimer {
+	return &stageTimer{last: time.Now()}
+}
+
+// done prints the time since the previous stage ended, with its record
+// count if any (in the header, or exported), and logs it with -log json
+func (s *stageTimer) done(stage string, records uint32) {
+	now := time.Now()
+	elapsed := now.Sub(s.last).Seconds()
+	if records > 0 {
+		debugf(1, "stage %s: %.3fs, %d records", stage, elapsed, records)
+	} else {
+		debugf(1, "stage %s: %.3fs", stage, elapsed)
+	}
+	emitLog(logEvent{Level: "info", Event: "stage", Stage: stage, Records: records, Elapsed: elapsed})
+	s.last = now
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ledgerName is the file in a -watch directory that remembers which
+// tables were converted, so restarts don't convert them again
+const ledgerName = ".dbf2csv-ledger.json"
+
+// ledgerEntry identifies the version of a file that was converted
+type ledgerEntry struct {
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// ledger maps file names in the watched directory to the version last
+// converted successfully
+type ledger struct {
+	path  string
+	Files map[string]ledgerEntry `json:"files"`
+}
+
+func loadLedger(dir string) (*ledger, error) {
+	l := &ledger{path: filepath.Join(dir, ledgerName), Files: map[string]ledgerEntry{}}
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("invalid ledger %s: %w", l.path, err)
+	}
+	if l.Files == nil {
+		l.Files = map[string]ledgerEntry{}
+	}
+	return l, nil
+}
+
+// changed reports whether path differs from the version in the ledger
+func (l *ledger) changed(path string, st os.FileInfo) bool {
+	e, ok := l.Files[filepath.Base(path)]
+	return !ok || e.Size != st.Size() || !e.Modified.Equal(st.ModTime())
+}
+
+func (l *ledger) record(path string, st os.FileInfo) error {
+	l.Files[filepath.Base(path)] = ledgerEntry{Size: st.Size(), Modified: st.ModTime()}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, append(data, '\n'), 0644)
+}
+
+// isWatchedTable reports whether -watch converts path: the table types
+// dbf2csv accepts, gzip-compressed or not
+func isWatchedTable(path string) bool {
+	_, ok := memoExts[strings.ToLower(filepath.Ext(trimGzip(path)))]
+	return ok && !strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// watchDir converts the tables in dir that are new or changed since the
+// ledger was written, then keeps converting tables as they are created or
+// modified until ctx is done. A file is converted once it has seen no
+// changes for the -watch-debounce period, so tables still being copied in
+// are not picked up half-written.
+func watchDir(ctx context.Context, dir string, convert func(path string) error) error {
+	l, err := loadLedger(dir)
+	if err != nil {
+		return err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if err := w.Add(dir); err != nil {
+		return err
+	}
+
+	// Files already there are due right away
+	pending := make(map[string]time.Time)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if p := filepath.Join(dir, e.Name()); !e.IsDir() && isWatchedTable(p) {
+			pending[p] = time.Time{}
+		}
+	}
+
+	fmt.Printf("Watching: %s (debounce %s, ledger %s)\n", dir, flagWatchDebounce, ledgerName)
+	tick := time.NewTicker(flagWatchDebounce / 4)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) != 0 && isWatchedTable(ev.Name) {
+				pending[ev.Name] = time.Now()
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			warnf("watch: %v", err)
+		case <-tick.C:
+			var due []string
+			for p, t := range pending {
+				if time.Since(t) >= flagWatchDebounce {
+					due = append(due, p)
+				}
+			}
+			sort.Strings(due)
+			for _, p := range due {
+				delete(pending, p)
+				st, err := os.Stat(p)
+				if err != nil || !st.Mode().IsRegular() || !l.changed(p, st) {
+					continue // removed, renamed away, or already converted
+				}
+				if convert(p) != nil || ctx.Err() != nil {
+					continue
+				}
+				if err := l.record(p, st); err != nil {
+					warnf("failed to update ledger: %v", err)
+				}
+			}
+		}
+	}
+}
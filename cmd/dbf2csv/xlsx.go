@@ -0,0 +1,278 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// xlsxMaxRows is the number of rows an Excel sheet holds, the header row
+// included
+const xlsxMaxRows = 1048576
+
+// xlsxEpoch is the Excel serial date of 1970-01-01
+const xlsxEpoch = 25569
+
+// xlsxMaxCell is the number of characters a cell holds; longer text (memo
+// fields) is cut
+const xlsxMaxCell = 32767
+
+// XLSX cell kinds and their cell styles (indexes into cellXfs below)
+const (
+	xlsxText = iota
+	xlsxNumber
+	xlsxBool
+	xlsxDate
+	xlsxDateTime
+)
+
+const (
+	xlsxStyleDate     = 1
+	xlsxStyleDateTime = 2
+	xlsxStyleHeader   = 3
+)
+
+// The fixed parts of the workbook; the sheet is streamed as rows arrive
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd"/><numFmt numFmtId="165" formatCode="yyyy\-mm\-dd\ hh:mm:ss"/></numFmts><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="4"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/><selection pane="bottomLeft"/></sheetView></sheetViews><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxKind returns how the values of a field are stored in a cell
+func xlsxKind(f FieldInfo) int {
+	switch f.Type {
+	case 'N', 'F', 'I', '+', 'B', 'O', 'Y':
+		return xlsxNumber
+	case 'L':
+		return xlsxBool
+	case 'D':
+		return xlsxDate
+	case 'T', '@':
+		return xlsxDateTime
+	}
+	return xlsxText
+}
+
+// xlsxSheetName makes name a valid sheet name: at most 31 characters,
+// without []:*?/\
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if utf8.RuneCountInString(name) > 31 {
+		name = string([]rune(name)[:31])
+	}
+	if name == "" {
+		return "Sheet1"
+	}
+	return name
+}
+
+// xlsxColumn returns the column letters of the 0-based column i: A, ..., Z,
+// AA, ...
+func xlsxColumn(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+// xlsxWriter writes rows to an Excel workbook with a single sheet, streamed
+// into the zip archive as rows arrive. The first row written is the header
+// row, shown in bold and frozen above the data.
+type xlsxWriter struct {
+	w       *bufio.Writer
+	zw      *zip.Writer
+	sheet   io.Writer
+	name    string
+	kinds   []int
+	refs    []string // column letters
+	rows    int
+	buf     []byte
+	started bool
+}
+
+func newXLSXWriter(w *bufio.Writer, fields []FieldInfo, name string) *xlsxWriter {
+	kinds := make([]int, len(fields))
+	for i, f := range fields {
+		kinds[i] = xlsxKind(f)
+	}
+	if flagDeletedColumn {
+		kinds = append(kinds, xlsxBool)
+	}
+	refs := make([]string, len(kinds))
+	for i := range refs {
+		refs[i] = xlsxColumn(i)
+	}
+	return &xlsxWriter{w: w, zw: zip.NewWriter(w), name: xlsxSheetName(name), kinds: kinds, refs: refs}
+}
+
+// start writes the fixed parts and opens the sheet
+func (xw *xlsxWriter) start() error {
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, appendXMLText(nil, xw.name))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := xw.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return err
+		}
+	}
+	sheet, err := xw.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	xw.sheet = sheet
+	_, err = io.WriteString(sheet, xlsxSheetStart)
+	return err
+}
+
+func (xw *xlsxWriter) Write(row []string) error {
+	header := !xw.started
+	if header {
+		xw.started = true
+		if err := xw.start(); err != nil {
+			return err
+		}
+	}
+	if xw.rows == xlsxMaxRows {
+		return fmt.Errorf("more rows than an XLSX sheet holds (%d)", xlsxMaxRows)
+	}
+	xw.rows++
+
+	rowNum := strconv.Itoa(xw.rows)
+	buf := append(xw.buf[:0], `<row r="`...)
+	buf = append(buf, rowNum...)
+	buf = append(buf, `">`...)
+	for i, cell := range row {
+		kind := xw.kinds[i]
+		if header {
+			kind = xlsxText
+		} else if cell == flagNull && (flagNull != "" || kind != xlsxText) {
+			continue // null: no cell
+		}
+		ref := xw.refs[i] + rowNum
+		buf = appendXLSXCell(buf, ref, cell, kind, header)
+	}
+	buf = append(buf, "</row>"...)
+	xw.buf = buf
+	_, err := xw.sheet.Write(buf)
+	return err
+}
+
+// appendXLSXCell appends one cell; values that don't parse as their kind
+// are written as text
+func appendXLSXCell(dst []byte, ref, cell string, kind int, header bool) []byte {
+	dst = append(dst, `<c r="`...)
+	dst = append(dst, ref...)
+	dst = append(dst, '"')
+
+	switch kind {
+	case xlsxNumber:
+		num := strings.ReplaceAll(cell, ",", "") // -currency grouped
+		if v, err := strconv.ParseFloat(num, 64); err == nil && isNumber([]byte(num)) {
+			dst = append(dst, "><v>"...)
+			dst = strconv.AppendFloat(dst, v, 'g', -1, 64)
+			return append(dst, "</v></c>"...)
+		}
+	case xlsxBool:
+		if cell == boolTrue || cell == boolFalse {
+			dst = append(dst, ` t="b"><v>`...)
+			if cell == boolTrue {
+				dst = append(dst, '1')
+			} else {
+				dst = append(dst, '0')
+			}
+			return append(dst, "</v></c>"...)
+		}
+	case xlsxDate:
+		// Excel serial dates count days from 1899-12-30 and start at 1
+		if days, ok := parseDateCell(cell); ok && days+xlsxEpoch >= 1 {
+			dst = append(dst, ` s="`+strconv.Itoa(xlsxStyleDate)+`"><v>`...)
+			dst = strconv.AppendInt(dst, int64(days+xlsxEpoch), 10)
+			return append(dst, "</v></c>"...)
+		}
+	case xlsxDateTime:
+		if ms, ok := parseDateTimeCell(cell); ok && float64(ms)/86400000+xlsxEpoch >= 1 {
+			dst = append(dst, ` s="`+strconv.Itoa(xlsxStyleDateTime)+`"><v>`...)
+			dst = strconv.AppendFloat(dst, float64(ms)/86400000+xlsxEpoch, 'f', -1, 64)
+			return append(dst, "</v></c>"...)
+		}
+	}
+
+	if header {
+		dst = append(dst, ` s="`+strconv.Itoa(xlsxStyleHeader)+`"`...)
+	}
+	dst = append(dst, ` t="inlineStr"><is><t xml:space="preserve">`...)
+	if utf8.RuneCountInString(cell) > xlsxMaxCell {
+		cell = string([]rune(cell)[:xlsxMaxCell])
+	}
+	dst = appendXMLText(dst, cell)
+	return append(dst, "</t></is></c>"...)
+}
+
+// appendXMLText appends s escaped as XML character data, dropping the
+// control characters XML cannot hold and invalid UTF-8
+func appendXMLText(dst []byte, s string) []byte {
+	for _, r := range s {
+		switch {
+		case r == '&':
+			dst = append(dst, "&amp;"...)
+		case r == '<':
+			dst = append(dst, "&lt;"...)
+		case r == '>':
+			dst = append(dst, "&gt;"...)
+		case r == '"':
+			dst = append(dst, "&quot;"...)
+		case r == utf8.RuneError, r < 0x20 && r != '\t' && r != '\n' && r != '\r':
+		default:
+			dst = utf8.AppendRune(dst, r)
+		}
+	}
+	return dst
+}
+
+// Flush is a no-op: rows go straight into the archive
+func (xw *xlsxWriter) Flush() {}
+
+// Close ends the sheet and the archive, and flushes the underlying buffer
+func (xw *xlsxWriter) Close() error {
+	if !xw.started {
+		if err := xw.start(); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(xw.sheet, xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := xw.zw.Close(); err != nil {
+		return err
+	}
+	return xw.w.Flush()
+}
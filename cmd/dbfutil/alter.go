@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// alterField is a field of the altered table with the input field its
+// values come from (-1 for an added field)
+type alterField struct {
+	FieldInfo
+	src     int
+	nullBit int // bit in the output _NullFlags, -1 if none
+	varBit  int
+}
+
+func runAlter(args []string) error {
+	fs := newFlagSet("alter")
+	out := fs.String("o", "", "Output DBF file (required)")
+	add := fs.String("add", "", "Fields to add after the last one, as NAME:TYPE[:LEN[:DEC]],...")
+	drop := fs.String("drop", "", "Fields to drop, comma separated")
+	rename := fs.String("rename", "", "Fields to rename: OLD1=NEW1,OLD2=NEW2")
+	resize := fs.String("resize", "", "Character and numeric fields to resize, as NAME:LEN[:DEC],...")
+	encName := fs.String("e", "", "Encoding of the table, so shrunk character fields are cut between characters (default: its code page mark, else UTF-8)")
+	addIndexFlag(fs)
+	inputs := parseArgs(fs, args)
+	if err := checkIndexPolicy(); err != nil {
+		return err
+	}
+
+	if *out == "" || len(inputs) != 1 {
+		fs.Usage()
+		return fmt.Errorf("need one input table and -o")
+	}
+	if *add == "" && *drop == "" && *rename == "" && *resize == "" {
+		fs.Usage()
+		return fmt.Errorf("nothing to do: need -add, -drop, -rename or -resize")
+	}
+	if inputs[0] == *out {
+		return fmt.Errorf("output %s is also the input", *out)
+	}
+
+	t, err := openTable(inputs[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputs[0], err)
+	}
+	defer t.Close()
+	warnIndex(t, *out)
+
+	fields, err := alterFields(t, *add, *drop, *rename, *resize)
+	if err != nil {
+		return fmt.Errorf("%s: %w", t.Path, err)
+	}
+
+	if *encName == "" {
+		*encName = "utf-8"
+		if name, ok := declaredEncoding(t.Header); ok {
+			*encName = name
+		}
+	}
+	enc, ok := lookupRecodeEncoding(*encName)
+	if !ok {
+		return fmt.Errorf("unsupported encoding '%s' (supported: %s)", *encName, strings.Join(sortedKeys(recodeEncodings), ", "))
+	}
+
+	// --- Copy Memo File ---
+	// Memo pointers are copied unchanged, so the memo file goes along as is
+	// (the memos of dropped fields stay behind until pack -memo)
+	hasMemo := false
+	for _, f := range fields {
+		hasMemo = hasMemo || f.Type == 'M' || f.Type == 'G' || f.Type == 'P'
+	}
+	memoPath := findMemoFile(t.Path)
+	if hasMemo {
+		if memoPath == "" {
+			return fmt.Errorf("%s: memo file not found (memo fields can only be added to a table with a memo file)", t.Path)
+		}
+		if err := copyFile(memoPath, memoPathFor(*out, memoPath)); err != nil {
+			return fmt.Errorf("failed to copy memo: %w", err)
+		}
+	}
+
+	// --- Write Altered Table ---
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create DBF: %w", err)
+	}
+	defer f.Close()
+
+	header, recLen := alterHeader(t, fields, hasMemo)
+	w := bufio.NewWriterSize(f, 4*1024*1024)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	var nullFlags FieldInfo // of the input table
+	for _, sf := range t.Fields {
+		if sf.Flags&fieldFlagSystem != 0 {
+			nullFlags = sf
+		}
+	}
+	srcBits := nullFlagBits(t.Fields)
+
+	r := bufio.NewReaderSize(t.records(), 1024*1024)
+	record := make([]byte, t.Header.RecLen)
+	outRec := make([]byte, recLen)
+	var cut, overflow int
+	for n := uint32(0); n < t.Header.NumRecs; n++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return fmt.Errorf("%s: error reading record %d: %w", t.Path, n, err)
+		}
+		outRec[0] = record[0] // deletion flag
+		for _, df := range fields {
+			slot := outRec[df.Offset : df.Offset+df.Length]
+			if df.src < 0 {
+				blankValue(slot, df.Type)
+				continue
+			}
+			sf := t.Fields[df.src]
+			raw := record[sf.Offset : sf.Offset+sf.Length]
+			switch {
+			case df.Flags&fieldFlagSystem != 0:
+				clear(slot)
+			case sf.Length == df.Length && sf.Dec == df.Dec:
+				copy(slot, raw)
+			case df.Type == 'C':
+				value := bytes.TrimRight(raw, " \x00")
+				if len(value) > df.Length {
+					cut++
+					if df.Flags&fieldFlagBinary == 0 {
+						value = truncateEncoded(value, df.Length, enc.enc)
+					}
+				}
+				blankValue(slot, 'C')
+				copy(slot, value)
+			default:
+				if !resizeNumber(slot, raw, sf.Dec, df.Dec) {
+					overflow++
+				}
+			}
+		}
+		// Move the null and varlength bits to their new places
+		for _, df := range fields {
+			if df.src < 0 || nullFlags.Length == 0 {
+				continue
+			}
+			bits := srcBits[df.src]
+			for i, to := range []int{df.varBit, df.nullBit} {
+				if to >= 0 && bits[i] >= 0 && bits[i]/8 < nullFlags.Length && record[nullFlags.Offset+bits[i]/8]&(1<<(bits[i]%8)) != 0 {
+					outRec[fields[len(fields)-1].Offset+to/8] |= 1 << (to % 8)
+				}
+			}
+		}
+		if _, err := w.Write(outRec); err != nil {
+			return err
+		}
+	}
+
+	// Write EOF marker
+	if err := w.WriteByte(0x1A); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("  >> Output: %s (%d fields, record length %d -> %d, %d records)\n", *out, len(fields), t.Header.RecLen, recLen, t.Header.NumRecs)
+	if hasMemo {
+		fmt.Printf("  >> Memo: %s\n", memoPathFor(*out, memoPath))
+	}
+	if cut > 0 {
+		fmt.Printf("  Warning: %d character values were cut to their new field length\n", cut)
+	}
+	if overflow > 0 {
+		fmt.Printf("  Warning: %d numeric values do not fit their new field size and were filled with '*'\n", overflow)
+	}
+	return dropIndex(*out)
+}
+
+// alterFields applies the -drop, -rename, -resize and -add specs to the
+// fields of t. Fields are named by their names in the input table.
+func alterFields(t *Table, add, drop, rename, resize string) ([]alterField, error) {
+	var fields []alterField
+	for i, f := range t.Fields {
+		if f.Flags&fieldFlagSystem == 0 {
+			fields = append(fields, alterField{FieldInfo: f, src: i})
+		}
+	}
+	find := func(name string) (int, error) {
+		for i, f := range fields {
+			if f.src >= 0 && strings.EqualFold(t.Fields[f.src].Name, strings.TrimSpace(name)) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("no field named '%s'", strings.TrimSpace(name))
+	}
+
+	if rename != "" {
+		for _, item := range strings.Split(rename, ",") {
+			old, name, ok := strings.Cut(item, "=")
+			name = strings.ToUpper(strings.TrimSpace(name))
+			if !ok || name == "" {
+				return nil, fmt.Errorf("invalid rename '%s' (expected OLD=NEW)", item)
+			}
+			if len(name) > 10 {
+				return nil, fmt.Errorf("field name '%s' is longer than 10 characters", name)
+			}
+			i, err := find(old)
+			if err != nil {
+				return nil, err
+			}
+			fields[i].Name = name
+		}
+	}
+
+	if resize != "" {
+		for _, item := range strings.Split(resize, ",") {
+			parts := strings.Split(strings.TrimSpace(item), ":")
+			if len(parts) < 2 || len(parts) > 3 {
+				return nil, fmt.Errorf("invalid resize '%s' (expected NAME:LEN[:DEC])", item)
+			}
+			i, err := find(parts[0])
+			if err != nil {
+				return nil, err
+			}
+			f := &fields[i]
+			if f.Type != 'C' && f.Type != 'N' && f.Type != 'F' {
+				return nil, fmt.Errorf("field %s: type '%c' fields cannot be resized", f.Name, f.Type)
+			}
+			n, err := strconv.Atoi(parts[1])
+			if err != nil || n < 1 || n > 254 || (f.Type != 'C' && n > 20) {
+				return nil, fmt.Errorf("field %s: invalid length '%s'", f.Name, parts[1])
+			}
+			f.Length = n
+			if len(parts) > 2 {
+				if f.Type == 'C' {
+					return nil, fmt.Errorf("field %s: character fields have no decimals", f.Name)
+				}
+				n, err := strconv.Atoi(parts[2])
+				if err != nil || n < 0 || (n > 0 && n > f.Length-2) {
+					return nil, fmt.Errorf("field %s: invalid decimals '%s'", f.Name, parts[2])
+				}
+				f.Dec = n
+			}
+			if f.Dec > 0 && f.Dec > f.Length-2 {
+				return nil, fmt.Errorf("field %s: length %d leaves no room for %d decimals", f.Name, f.Length, f.Dec)
+			}
+		}
+	}
+
+	if drop != "" {
+		for _, name := range strings.Split(drop, ",") {
+			i, err := find(name)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields[:i], fields[i+1:]...)
+		}
+	}
+
+	if add != "" {
+		vfp := t.Header.Version == 0x30 || t.Header.Version == 0x31 || t.Header.Version == 0x32
+		added, err := parseFieldSpec(add, vfp)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range added {
+			f.Flags = 0
+			fields = append(fields, alterField{FieldInfo: f, src: -1})
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields left")
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if seen[strings.ToUpper(f.Name)] {
+			return nil, fmt.Errorf("duplicate field name %s", f.Name)
+		}
+		seen[strings.ToUpper(f.Name)] = true
+	}
+
+	// The null and varlength bits of the remaining fields are numbered
+	// again, in field order, in a _NullFlags field as wide as they need
+	bit := 0
+	for i := range fields {
+		fields[i].varBit, fields[i].nullBit = -1, -1
+		if fields[i].Type == 'V' || fields[i].Type == 'Q' {
+			fields[i].varBit = bit
+			bit++
+		}
+		if fields[i].Flags&fieldFlagNullable != 0 {
+			fields[i].nullBit = bit
+			bit++
+		}
+	}
+	if bit > 0 {
+		nf := alterField{FieldInfo: FieldInfo{Name: "_NullFlags", Type: '0', Length: (bit + 7) / 8, Flags: fieldFlagSystem}, src: -1}
+		for i, f := range t.Fields {
+			if f.Flags&fieldFlagSystem != 0 {
+				nf.src = i
+			}
+		}
+		fields = append(fields, nf)
+	}
+
+	offset := 1
+	for i := range fields {
+		fields[i].Offset = offset
+		offset += fields[i].Length
+	}
+	if offset > math.MaxUint16 {
+		return nil, fmt.Errorf("record length %d is too large", offset)
+	}
+	return fields, nil
+}
+
+// nullFlagBits returns the varlength and null bit of every field of a
+// VFP table, -1 where a field has none
+func nullFlagBits(fields []FieldInfo) [][2]int {
+	bits := make([][2]int, len(fields))
+	bit := 0
+	for i, f := range fields {
+		bits[i] = [2]int{-1, -1}
+		if f.Type == 'V' || f.Type == 'Q' {
+			bits[i][0] = bit
+			bit++
+		}
+		if f.Flags&fieldFlagNullable != 0 {
+			bits[i][1] = bit
+			bit++
+		}
+	}
+	return bits
+}
+
+// alterHeader returns the header area of the altered table: t's header and
+// the descriptors of its remaining fields, with the new names, sizes and
+// offsets, followed by descriptors for the added fields. A table left
+// without memo fields is marked as having no memo file.
+func alterHeader(t *Table, fields []alterField, hasMemo bool) ([]byte, int) {
+	vfp := t.Header.Version == 0x30 || t.Header.Version == 0x31 || t.Header.Version == 0x32
+	tail := t.Raw[t.descriptorEnd():] // terminator and VFP backlink area
+
+	raw := make([]byte, 32+32*len(fields)+len(tail))
+	copy(raw, newHeader(t, t.Header.NumRecs)[:32])
+	copy(raw[32+32*len(fields):], tail)
+	if !hasMemo {
+		switch t.Header.Version {
+		case 0x83, 0x8B, 0xF5:
+			raw[0] = 0x03
+		}
+		if vfp {
+			raw[28] &^= 0x02
+		}
+	}
+
+	recLen := 1
+	for i, f := range fields {
+		desc := raw[32+32*i : 64+32*i]
+		if f.src >= 0 {
+			copy(desc, t.Raw[32+32*f.src:64+32*f.src])
+		} else {
+			desc[11] = f.Type
+			desc[18] = f.Flags
+		}
+		clear(desc[0:11])
+		copy(desc[0:11], f.Name)
+		desc[16], desc[17] = byte(f.Length), byte(f.Dec)
+		if f.Type == 'C' {
+			desc[17] = byte(f.Length >> 8)
+		}
+		if vfp {
+			binary.LittleEndian.PutUint32(desc[12:16], uint32(f.Offset))
+		}
+		recLen += f.Length
+	}
+	binary.LittleEndian.PutUint16(raw[8:10], uint16(len(raw)))
+	binary.LittleEndian.PutUint16(raw[10:12], uint16(recLen))
+	return raw, recLen
+}
+
+// blankValue fills slot with the empty value of a field of type typ
+func blankValue(slot []byte, typ byte) {
+	fill := byte(' ')
+	switch typ {
+	case 'I', 'Y', 'B', 'T', '0':
+		fill = 0
+	case 'M', 'G', 'P':
+		if len(slot) == 4 {
+			fill = 0
+		}
+	}
+	for i := range slot {
+		slot[i] = fill
+	}
+}
+
+// resizeNumber writes the numeric value raw, which has from decimals, into
+// slot with to decimals, right-aligned. A value that does not fit fills slot
+// with '*', like dBase does; false is returned then.
+func resizeNumber(slot, raw []byte, from, to int) bool {
+	blankValue(slot, 'N')
+	text := strings.TrimSpace(string(bytes.TrimRight(raw, "\x00")))
+	if text == "" {
+		return true
+	}
+	if from != to {
+		if v, err := strconv.ParseFloat(text, 64); err == nil {
+			text = strconv.FormatFloat(v, 'f', to, 64)
+		}
+	}
+	if len(text) > len(slot) {
+		for i := range slot {
+			slot[i] = '*'
+		}
+		return false
+	}
+	copy(slot[len(slot)-len(text):], text)
+	return true
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+func runCat(args []string) error {
+	fs := newFlagSet("cat")
+	out := fs.String("o", "", "Output DBF file (required)")
+	addIndexFlag(fs)
+	inputs := parseArgs(fs, args)
+	if err := checkIndexPolicy(); err != nil {
+		return err
+	}
+
+	if *out == "" || len(inputs) < 1 {
+		fs.Usage()
+		return fmt.Errorf("need input tables and -o")
+	}
+	for _, in := range inputs {
+		if in == *out {
+			return fmt.Errorf("output %s is also an input", *out)
+		}
+	}
+
+	// --- Verify Structures ---
+	tables := make([]*Table, 0, len(inputs))
+	defer func() {
+		for _, t := range tables {
+			t.Close()
+		}
+	}()
+
+	var total uint64
+	for _, in := range inputs {
+		t, err := openTable(in)
+		if err != nil {
+			return fmt.Errorf("%s: %w", in, err)
+		}
+		tables = append(tables, t)
+
+		if err := sameStructure(tables[0], t); err != nil {
+			return fmt.Errorf("%s: structure differs from %s: %v", in, tables[0].Path, err)
+		}
+		total += uint64(t.Header.NumRecs)
+		fmt.Printf("  >> %s: %d records\n", in, t.Header.NumRecs)
+	}
+	warnIndex(tables[0], *out)
+	if total > 0xFFFFFFFF {
+		return fmt.Errorf("combined record count %d exceeds the DBF limit", total)
+	}
+
+	// --- Combine Memo Files ---
+	var memoOffsets []uint32
+	var outMemo string
+	memoCols := memoFields(tables[0].Fields)
+	if len(memoCols) > 0 {
+		var err error
+		outMemo, memoOffsets, err = catMemos(tables, *out)
+		if err != nil {
+			return err
+		}
+	}
+
+	// --- Write Combined Table ---
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create DBF: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 4*1024*1024)
+	if _, err := w.Write(newHeader(tables[0], uint32(total))); err != nil {
+		return err
+	}
+
+	recLen := int(tables[0].Header.RecLen)
+	record := make([]byte, recLen)
+	for i, t := range tables {
+		r := bufio.NewReaderSize(t.records(), 1024*1024)
+		for n := uint32(0); n < t.Header.NumRecs; n++ {
+			if _, err := io.ReadFull(r, record); err != nil {
+				return fmt.Errorf("%s: error reading record %d: %w", t.Path, n, err)
+			}
+			// Memo pointers of later tables move by the size of the memos before them
+			if memoOffsets != nil && memoOffsets[i] > 0 {
+				for _, mf := range memoCols {
+					raw := record[mf.Offset : mf.Offset+mf.Length]
+					if block := getMemoBlock(raw); block != 0 {
+						putMemoBlock(raw, block+memoOffsets[i])
+					}
+				}
+			}
+			if _, err := w.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Write EOF marker
+	if err := w.WriteByte(0x1A); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("  >> Output: %s (%d records)\n", *out, total)
+	if outMemo != "" {
+		fmt.Printf("  >> Memo: %s\n", outMemo)
+	}
+	return dropIndex(*out)
+}
+
+// catMemos appends the memo files of all tables into one and returns the
+// block offset each table's memo pointers must be shifted by
+func catMemos(tables []*Table, out string) (string, []uint32, error) {
+	var memoPaths []string
+	var blockSize int64
+	for _, t := range tables {
+		p := findMemoFile(t.Path)
+		if p == "" {
+			return "", nil, fmt.Errorf("%s: memo file not found", t.Path)
+		}
+		bs, err := memoBlockSize(p, t.Header.Version)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if blockSize != 0 && bs != blockSize {
+			return "", nil, fmt.Errorf("%s: memo block size %d differs from %d", p, bs, blockSize)
+		}
+		blockSize = bs
+		memoPaths = append(memoPaths, p)
+	}
+
+	outMemo := memoPathFor(out, memoPaths[0])
+	mf, err := os.Create(outMemo)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create memo: %w", err)
+	}
+	defer mf.Close()
+
+	offsets := make([]uint32, len(tables))
+	var size int64
+	for i, p := range memoPaths {
+		// Each memo file is appended whole (header included) on a block
+		// boundary, so its pointers just move by the starting block
+		if pad := (blockSize - size%blockSize) % blockSize; pad > 0 {
+			if _, err := mf.Write(make([]byte, pad)); err != nil {
+				return "", nil, err
+			}
+			size += pad
+		}
+		offsets[i] = uint32(size / blockSize)
+
+		src, err := os.Open(p)
+		if err != nil {
+			return "", nil, err
+		}
+		n, err := io.Copy(mf, src)
+		src.Close()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to copy memo %s: %w", p, err)
+		}
+		size += n
+	}
+
+	next := uint32((size + blockSize - 1) / blockSize)
+	if err := setMemoNextBlock(mf, next); err != nil {
+		return "", nil, fmt.Errorf("failed to update memo header: %w", err)
+	}
+	return outMemo, offsets, nil
+}
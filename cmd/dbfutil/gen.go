@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// genVersions maps -version names to the version byte written without and
+// with memo fields
+var genVersions = map[string][2]byte{
+	"dbase3": {0x03, 0x83},
+	"dbase4": {0x03, 0x8B},
+	"foxpro": {0x03, 0xF5},
+	"vfp":    {0x30, 0x30},
+}
+
+// genDefaultFields are used when -fields is not given
+var genDefaultFields = map[string]string{
+	"dbase3": "NAME:C:20,QTY:N:10:2,DT:D,OK:L,NOTE:M",
+	"dbase4": "NAME:C:20,QTY:N:10:2,RATE:F:12:4,DT:D,OK:L,NOTE:M",
+	"foxpro": "NAME:C:20,QTY:N:10:2,RATE:F:12:4,DT:D,OK:L,NOTE:M",
+	"vfp":    "NAME:C:20,QTY:N:10:2,DT:D,OK:L,CNT:I,PRICE:Y,RATE:B,TS:T,NOTE:M",
+}
+
+// genCorruptions describes the -corrupt patterns
+var genCorruptions = map[string]string{
+	"truncate":  "cut the file in the middle of the last record",
+	"count":     "header claims 10 more records than the file holds",
+	"zerocount": "header record count is 0",
+	"headerlen": "header length points 1 byte past the first record",
+	"noeof":     "no 0x1A end-of-file marker",
+	"memo":      "one memo pointer refers past the end of the memo file",
+	"garbage":   "some N and D fields hold non-numeric junk",
+	"badchar":   "some C fields hold bytes that are invalid in the encoding",
+}
+
+var genWords = []string{
+	"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel",
+	"india", "juliet", "kilo", "lima", "mike", "november", "oscar", "papa",
+	"张三", "李四", "王五", "赵六", "北京", "上海", "广州", "深圳", "订单", "客户",
+}
+
+func runGen(args []string) error {
+	fs := newFlagSet("gen")
+	out := fs.String("o", "", "Output table (required)")
+	version := fs.String("version", "dbase3", "Table format: dbase3, dbase4, foxpro, or vfp")
+	fieldSpec := fs.String("fields", "", "Fields as NAME:TYPE[:LEN[:DEC]],... (default depends on -version)")
+	rows := fs.Int("rows", 1000, "Number of records")
+	encName := fs.String("e", "UTF-8", "Text encoding (UTF-8, GBK, GB18030)")
+	seed := fs.Uint64("seed", 1, "Random seed; the same seed gives the same table")
+	deleted := fs.Float64("deleted", 0.05, "Fraction of records flagged as deleted")
+	corrupt := fs.String("corrupt", "", "Corruption patterns, comma separated: "+strings.Join(sortedKeys(genCorruptions), ", "))
+	parseArgs(fs, args)
+
+	if *out == "" || *rows < 0 {
+		fs.Usage()
+		return fmt.Errorf("need -o and a non-negative -rows")
+	}
+	versions, ok := genVersions[strings.ToLower(*version)]
+	if !ok {
+		return fmt.Errorf("unknown version '%s'", *version)
+	}
+	var enc encoding.Encoding
+	switch strings.ToLower(*encName) {
+	case "utf-8", "utf8":
+		enc = unicode.UTF8
+	case "gbk", "gb2312", "cp936", "gb18030":
+		enc = simplifiedchinese.GB18030
+	default:
+		return fmt.Errorf("unsupported encoding '%s'", *encName)
+	}
+	if *fieldSpec == "" {
+		*fieldSpec = genDefaultFields[strings.ToLower(*version)]
+	}
+
+	corruptions := make(map[string]bool)
+	for _, c := range strings.Split(*corrupt, ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c == "" {
+			continue
+		}
+		if _, ok := genCorruptions[c]; !ok {
+			return fmt.Errorf("unknown corruption pattern '%s'", c)
+		}
+		corruptions[c] = true
+	}
+
+	vfp := versions[0] == 0x30
+	fields, err := parseFieldSpec(*fieldSpec, vfp)
+	if err != nil {
+		return err
+	}
+
+	g := &generator{
+		rng:     rand.New(rand.NewPCG(*seed, 0x5eed)),
+		encoder: enc.NewEncoder(),
+		fields:  fields,
+		vfp:     vfp,
+		corrupt: corruptions,
+	}
+	g.version = versions[0]
+	if len(memoFields(fields)) > 0 {
+		g.version = versions[1]
+		if err := g.createMemo(*out); err != nil {
+			return err
+		}
+		defer g.memo.Close()
+	}
+
+	if err := g.writeTable(*out, *rows, *deleted); err != nil {
+		return err
+	}
+
+	var applied []string
+	for _, c := range sortedKeys(genCorruptions) {
+		if corruptions[c] {
+			applied = append(applied, c)
+		}
+	}
+	fmt.Printf("  >> %s: version 0x%02X, %d fields, %d records\n", *out, g.version, len(fields), *rows)
+	if g.memo != nil {
+		fmt.Printf("  >> Memo: %s (%d blocks)\n", g.memo.Name(), g.memoNext)
+	}
+	if len(applied) > 0 {
+		fmt.Printf("  >> Corrupted: %s\n", strings.Join(applied, ", "))
+	}
+	return nil
+}
+
+// parseFieldSpec parses NAME:TYPE[:LEN[:DEC]] entries. Types with a fixed
+// size (D, L, I, Y, B, T, M) don't need a length.
+func parseFieldSpec(spec string, vfp bool) ([]FieldInfo, error) {
+	var fields []FieldInfo
+	offset := 0
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) < 2 || parts[0] == "" || len(parts[1]) != 1 {
+			return nil, fmt.Errorf("invalid field '%s' (expected NAME:TYPE[:LEN[:DEC]])", item)
+		}
+		f := FieldInfo{Name: strings.ToUpper(parts[0]), Type: strings.ToUpper(parts[1])[0]}
+		if len(f.Name) > 10 {
+			return nil, fmt.Errorf("field name '%s' is longer than 10 characters", parts[0])
+		}
+
+		switch f.Type {
+		case 'D', 'T', 'Y', 'B':
+			f.Length = 8
+		case 'L':
+			f.Length = 1
+		case 'I':
+			f.Length = 4
+		case 'M':
+			f.Length = 10
+			if vfp {
+				f.Length = 4
+			}
+		case 'C', 'N', 'F':
+			f.Length = 10
+		default:
+			return nil, fmt.Errorf("field %s: unsupported type '%c'", f.Name, f.Type)
+		}
+		if !vfp && strings.IndexByte("IYBT", f.Type) >= 0 {
+			return nil, fmt.Errorf("field %s: type '%c' needs -version vfp", f.Name, f.Type)
+		}
+		if f.Type == 'Y' {
+			f.Dec = 4
+		}
+
+		if len(parts) > 2 && (f.Type == 'C' || f.Type == 'N' || f.Type == 'F') {
+			n, err := strconv.Atoi(parts[2])
+			if err != nil || n < 1 || n > 254 || (f.Type != 'C' && n > 20) {
+				return nil, fmt.Errorf("field %s: invalid length '%s'", f.Name, parts[2])
+			}
+			f.Length = n
+		}
+		if len(parts) > 3 && (f.Type == 'N' || f.Type == 'F') {
+			n, err := strconv.Atoi(parts[3])
+			if err != nil || n < 0 || n > f.Length-2 {
+				return nil, fmt.Errorf("field %s: invalid decimals '%s'", f.Name, parts[3])
+			}
+			f.Dec = n
+		}
+
+		f.Offset = offset
+		offset += f.Length
+		fields = append(fields, f)
+	}
+	if offset+1 > math.MaxUint16 {
+		return nil, fmt.Errorf("record length %d is too large", offset+1)
+	}
+	return fields, nil
+}
+
+// generator produces random record contents
+type generator struct {
+	rng      *rand.Rand
+	encoder  *encoding.Encoder
+	fields   []FieldInfo
+	version  byte
+	vfp      bool
+	corrupt  map[string]bool
+	memo     *os.File
+	memoBW   *bufio.Writer
+	memoSize int64 // block size
+	memoNext uint32
+}
+
+// createMemo creates the memo file that matches the table version
+func (g *generator) createMemo(dbfPath string) error {
+	ext := ".fpt"
+	if g.version == 0x83 || g.version == 0x8B {
+		ext = ".dbt"
+	}
+	path := strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath)) + ext
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create memo: %w", err)
+	}
+	g.memo = f
+	g.memoBW = bufio.NewWriter(f)
+
+	hdr := make([]byte, 512)
+	switch ext {
+	case ".fpt":
+		g.memoSize = 64
+		binary.BigEndian.PutUint16(hdr[6:8], uint16(g.memoSize))
+	default:
+		g.memoSize = 512
+		if g.version == 0x8B {
+			binary.LittleEndian.PutUint16(hdr[20:22], uint16(g.memoSize))
+		}
+	}
+	g.memoNext = uint32(512 / g.memoSize)
+	_, err = g.memoBW.Write(hdr)
+	return err
+}
+
+// addMemo appends one memo and returns its block number
+func (g *generator) addMemo(text []byte) (uint32, error) {
+	var block []byte
+	switch {
+	case g.version == 0x83:
+		block = append(append(block, text...), 0x1A, 0x1A)
+	case g.version == 0x8B:
+		block = binary.LittleEndian.AppendUint32([]byte{0xFF, 0xFF, 0x08, 0x00}, uint32(len(text)+8))
+		block = append(block, text...)
+	default:
+		block = binary.BigEndian.AppendUint32(block, 1) // text memo
+		block = binary.BigEndian.AppendUint32(block, uint32(len(text)))
+		block = append(block, text...)
+	}
+	blocks := (int64(len(block)) + g.memoSize - 1) / g.memoSize
+	block = append(block, make([]byte, blocks*g.memoSize-int64(len(block)))...)
+
+	n := g.memoNext
+	if _, err := g.memoBW.Write(block); err != nil {
+		return 0, err
+	}
+	g.memoNext += uint32(blocks)
+	return n, nil
+}
+
+func (g *generator) writeTable(path string, rows int, deleted float64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriterSize(f, 1024*1024)
+
+	recLen := 1
+	for _, fi := range g.fields {
+		recLen += fi.Length
+	}
+	headerLen := 32 + 32*len(g.fields) + 1
+	if g.vfp {
+		headerLen += 263 // backlink area
+	}
+
+	// --- Header ---
+	hdr := make([]byte, headerLen)
+	now := time.Now()
+	hdr[0] = g.version
+	hdr[1], hdr[2], hdr[3] = byte(now.Year()-1900), byte(now.Month()), byte(now.Day())
+	numRecs := uint32(rows)
+	switch {
+	case g.corrupt["count"]:
+		numRecs += 10
+	case g.corrupt["zerocount"]:
+		numRecs = 0
+	}
+	binary.LittleEndian.PutUint32(hdr[4:8], numRecs)
+	storedHeaderLen := headerLen
+	if g.corrupt["headerlen"] {
+		storedHeaderLen++
+	}
+	binary.LittleEndian.PutUint16(hdr[8:10], uint16(storedHeaderLen))
+	binary.LittleEndian.PutUint16(hdr[10:12], uint16(recLen))
+	if g.vfp && g.memo != nil {
+		hdr[28] = 0x02 // has memo
+	}
+	for i, fi := range g.fields {
+		d := hdr[32+32*i : 64+32*i]
+		copy(d[0:11], fi.Name)
+		d[11] = fi.Type
+		if g.vfp {
+			binary.LittleEndian.PutUint32(d[12:16], uint32(fi.Offset+1))
+		}
+		d[16] = byte(fi.Length)
+		d[17] = byte(fi.Dec)
+	}
+	hdr[32+32*len(g.fields)] = 0x0D
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	// --- Records ---
+	record := make([]byte, recLen)
+	badMemo := g.corrupt["memo"]
+	for i := 0; i < rows; i++ {
+		record[0] = ' '
+		if g.rng.Float64() < deleted {
+			record[0] = '*'
+		}
+		for _, fi := range g.fields {
+			raw := record[1+fi.Offset : 1+fi.Offset+fi.Length]
+			if err := g.fill(raw, fi, &badMemo); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	if !g.corrupt["noeof"] {
+		if err := w.WriteByte(0x1A); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if g.corrupt["truncate"] && rows > 0 {
+		if err := f.Truncate(int64(headerLen + (rows-1)*recLen + recLen/2 + 1)); err != nil {
+			return err
+		}
+	}
+
+	if g.memo != nil {
+		if err := g.memoBW.Flush(); err != nil {
+			return err
+		}
+		var next [4]byte
+		if g.version == 0x83 || g.version == 0x8B {
+			binary.LittleEndian.PutUint32(next[:], g.memoNext)
+		} else {
+			binary.BigEndian.PutUint32(next[:], g.memoNext)
+		}
+		if _, err := g.memo.WriteAt(next[:], 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fill writes a random value for fi into raw
+func (g *generator) fill(raw []byte, fi FieldInfo, badMemo *bool) error {
+	for i := range raw {
+		raw[i] = ' '
+	}
+	blank := g.rng.IntN(20) == 0
+	junk := g.corrupt["garbage"] && g.rng.IntN(50) == 0
+
+	switch fi.Type {
+	case 'C':
+		if g.corrupt["badchar"] && g.rng.IntN(50) == 0 {
+			copy(raw, []byte{0xFF, 0xFE, 0x80, 0x81})
+			return nil
+		}
+		if !blank {
+			copy(raw, g.text(fi.Length))
+		}
+	case 'N', 'F':
+		if junk {
+			copy(raw, strings.Repeat("*", fi.Length))
+		} else if !blank {
+			intDigits := fi.Length - fi.Dec - 2
+			if fi.Dec == 0 {
+				intDigits = fi.Length - 1
+			}
+			limit := math.Pow10(min(intDigits, 15))
+			v := (g.rng.Float64()*2 - 1) * limit
+			s := strconv.FormatFloat(v, 'f', fi.Dec, 64)
+			if len(s) > fi.Length {
+				s = "0"
+			}
+			copy(raw[fi.Length-len(s):], s)
+		}
+	case 'D':
+		if junk {
+			copy(raw, "2024AB01")
+		} else if !blank {
+			copy(raw, g.date().Format("20060102"))
+		}
+	case 'L':
+		raw[0] = "TF?"[g.rng.IntN(3)]
+	case 'I':
+		binary.LittleEndian.PutUint32(raw, uint32(int32(g.rng.Uint32())))
+	case 'Y':
+		binary.LittleEndian.PutUint64(raw, uint64(g.rng.Int64N(1e12)-5e11))
+	case 'B':
+		binary.LittleEndian.PutUint64(raw, math.Float64bits(g.rng.NormFloat64()*1000))
+	case 'T':
+		for i := range raw {
+			raw[i] = 0
+		}
+		if !blank {
+			t := g.date().Add(time.Duration(g.rng.IntN(86400)) * time.Second)
+			binary.LittleEndian.PutUint32(raw[:4], uint32(timeToJulianDay(t)))
+			binary.LittleEndian.PutUint32(raw[4:], uint32((t.Hour()*3600+t.Minute()*60+t.Second())*1000))
+		}
+	case 'M':
+		if len(raw) == 4 {
+			for i := range raw {
+				raw[i] = 0
+			}
+		}
+		if blank {
+			return nil
+		}
+		block, err := g.addMemo(g.text(20 + g.rng.IntN(200)))
+		if err != nil {
+			return err
+		}
+		if *badMemo {
+			block = g.memoNext + 1000
+			*badMemo = false
+		}
+		putMemoBlock(raw, block)
+	}
+	return nil
+}
+
+// text returns random words encoded in the table encoding, at most n bytes
+func (g *generator) text(n int) []byte {
+	var out []byte
+	for {
+		word := genWords[g.rng.IntN(len(genWords))]
+		enc, err := g.encoder.Bytes([]byte(word))
+		if err != nil {
+			continue
+		}
+		sep := 0
+		if len(out) > 0 {
+			sep = 1
+		}
+		if len(out)+sep+len(enc) > n {
+			if len(out) == 0 {
+				// Not even one word fits: fall back to an ASCII prefix
+				return []byte("x" + strings.Repeat("y", min(n, 10)-1))
+			}
+			return out
+		}
+		if sep == 1 {
+			out = append(out, ' ')
+		}
+		out = append(out, enc...)
+		if g.rng.IntN(3) == 0 {
+			return out
+		}
+	}
+}
+
+// date returns a random date between 1990 and 2030
+func (g *generator) date() time.Time {
+	start := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	return start.AddDate(0, 0, g.rng.IntN(40*365))
+}
+
+// timeToJulianDay is the inverse of the converters' julianDayToTime
+func timeToJulianDay(t time.Time) int {
+	y, m, d := t.Year(), int(t.Month()), t.Day()
+	a := (14 - m) / 12
+	y = y + 4800 - a
+	m = m + 12*a - 3
+	return d + (153*m+2)/5 + 365*y + y/4 - y/100 + y/400 - 32045
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tableFlagIndex is the header byte 28 flag of a table with a production
+// index: a .cdx (FoxPro) or .mdx (dBase IV) that is opened with the table
+const tableFlagIndex = 0x01
+
+// Index policies (-index)
+const (
+	indexKeep   = "keep"
+	indexClear  = "clear"
+	indexDelete = "delete"
+)
+
+// indexPolicy is the -index policy of the running command
+var indexPolicy = indexKeep
+
+// addIndexFlag registers -index on the flag set of a command that writes a
+// table. Records are never added to an index, so an output that keeps the
+// flag makes FoxPro look for an index that is missing or no longer matches.
+func addIndexFlag(fs *flag.FlagSet) {
+	fs.StringVar(&indexPolicy, "index", indexKeep, "Production index (.cdx/.mdx) of the input, which is not updated: keep (the header flag, with a warning), clear (the flag, so the output opens without an index), or delete (clear, and delete the stale index file next to the output)")
+}
+
+// checkIndexPolicy validates -index
+func checkIndexPolicy() error {
+	indexPolicy = strings.ToLower(indexPolicy)
+	switch indexPolicy {
+	case indexKeep, indexClear, indexDelete:
+		return nil
+	}
+	return fmt.Errorf("invalid index policy '%s' (keep, clear or delete)", indexPolicy)
+}
+
+// findIndexFile returns the .cdx/.mdx file next to a table, or ""
+func findIndexFile(dbfPath string) string {
+	base := strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath))
+	for _, ext := range []string{".cdx", ".CDX", ".mdx", ".MDX"} {
+		if st, err := os.Stat(base + ext); err == nil && !st.IsDir() {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// hasIndexFlag reports whether the table header flags a production index
+func hasIndexFlag(t *Table) bool {
+	return t.Raw[28]&tableFlagIndex != 0
+}
+
+// warnIndex reports a production index of t that output would not match
+func warnIndex(t *Table, output string) {
+	index := findIndexFile(t.Path)
+	if !hasIndexFlag(t) && index == "" {
+		return
+	}
+	name := "a production index"
+	if index != "" {
+		name = filepath.Base(index)
+	}
+	switch indexPolicy {
+	case indexKeep:
+		if hasIndexFlag(t) {
+			fmt.Printf("  Warning: %s has %s that is not updated; FoxPro may fail to open %s (see -index clear)\n", t.Path, name, output)
+		} else {
+			fmt.Printf("  Warning: %s has %s that is not updated and will not match %s\n", t.Path, name, output)
+		}
+	case indexClear, indexDelete:
+		fmt.Printf("  >> Index: flag cleared, %s no longer opened with %s\n", name, output)
+	}
+}
+
+// dropIndex deletes the stale index file next to an output table (-index
+// delete), once the table is written
+func dropIndex(output string) error {
+	if indexPolicy != indexDelete {
+		return nil
+	}
+	index := findIndexFile(output)
+	if index == "" {
+		return nil
+	}
+	if err := os.Remove(index); err != nil {
+		return fmt.Errorf("failed to delete stale index: %w", err)
+	}
+	fmt.Printf("  >> Index: deleted %s, rebuild it in FoxPro (INDEX ON ... TAG)\n", index)
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constants for program info
+const (
+	AppVersion = "1.7.0"
+	AppAuthor  = "dabiaoge"
+)
+
+// command is a dbfutil subcommand
+type command struct {
+	usage string // argument synopsis
+	help  string // one-line description
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"alter":  {"[options] <in.dbf> -o <out.dbf>", "Copy a table while adding, dropping, renaming or resizing fields", runAlter},
+		"cat":    {"[options] <a.dbf> <b.dbf> ... -o <out.dbf>", "Concatenate tables with identical structure", runCat},
+		"pack":   {"[options] <data.dbf>", "Remove deleted records (like FoxPro PACK), optionally compacting the memo file", runPack},
+		"gen":    {"[options] -o <out.dbf>", "Generate a synthetic test table (versions, types, encodings, corruption)", runGen},
+		"recode": {"[options] <in.dbf> -to <encoding> -o <out.dbf>", "Re-encode the text of a table (e.g. GBK to UTF-8), memo file included", runRecode},
+		"split":  {"[options] <big.dbf>", "Split a table into big_001.dbf, big_002.dbf, ...", runSplit},
+		"zap":    {"[options] <data.dbf>", "Remove all records (like FoxPro ZAP), keeping the structure and an empty memo file", runZap},
+	}
+}
+
+func usage() {
+	fmt.Printf("DBFUTIL DBF Table Utilities\n")
+	fmt.Printf("Version: %s\n", AppVersion)
+	fmt.Printf("Author : %s\n\n", AppAuthor)
+	fmt.Printf("Usage: %s <command> [options] <dbf_file> ...\n\n", os.Args[0])
+	fmt.Println("Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-8s %s\n", name, commands[name].help)
+	}
+	fmt.Printf("\nRun '%s <command> -h' for command options.\n", os.Args[0])
+	fmt.Println("\nExamples:")
+	fmt.Printf("  %s cat a.dbf b.dbf -o all.dbf\n", os.Args[0])
+	fmt.Printf("  %s split -rows 500000 big.dbf\n", os.Args[0])
+	fmt.Printf("  %s pack -memo data.dbf\n", os.Args[0])
+	fmt.Printf("  %s zap -o skeleton.dbf production.dbf\n", os.Args[0])
+	fmt.Printf("  %s alter -resize NAME:40 -drop OLDCODE -add NOTE:M in.dbf -o out.dbf\n", os.Args[0])
+	fmt.Printf("  %s recode -from GBK -to UTF-8 old.dbf -o new.dbf\n", os.Args[0])
+	fmt.Printf("  %s gen -version vfp -rows 100000 -e GBK -o test.dbf\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "-help" || os.Args[1] == "--help" {
+		usage()
+		os.Exit(0)
+	}
+
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: Unknown command '%s'\n\n", name)
+		usage()
+		os.Exit(1)
+	}
+
+	startTime := time.Now()
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed [%s]: %v\n", name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Done: %s (Time: %.3fs)\n", name, time.Since(startTime).Seconds())
+}
+
+// newFlagSet creates the flag set of a subcommand with the standard usage text
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Printf("Usage: %s %s %s\n\n", os.Args[0], name, commands[name].usage)
+		fmt.Printf("%s\n\n", commands[name].help)
+		fmt.Println("Options:")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses flags that may appear before, between or after the
+// positional arguments (e.g. "cat a.dbf b.dbf -o all.dbf")
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// parseSize parses a byte size such as "65536", "512K" or "1GB"
+func parseSize(s string) (int64, error) {
+	orig := s
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s'", orig)
+	}
+	return int64(n * float64(mult)), nil
+}
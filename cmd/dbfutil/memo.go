@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// memoCopier copies memos of a table into a new memo file of the same
+// format, packed one after another (memos no record refers to are left
+// behind); block numbers change, so the records are given the new ones
+type memoCopier struct {
+	src       *os.File
+	srcSize   int64
+	f         *os.File
+	w         *bufio.Writer
+	path      string
+	blockSize int64
+	fpt       bool // FoxPro: typed, length-prefixed blocks
+	dbase4    bool // dBase IV .dbt: length-prefixed blocks
+	next      uint32
+}
+
+// newMemoCopier opens the memo file of the input and creates the output
+// memo with a copy of its header; version is the DBF version byte, which
+// tells dBase III (0x83) and dBase IV .dbt layouts apart
+func newMemoCopier(srcPath, outPath string, version byte) (*memoCopier, error) {
+	blockSize, err := memoBlockSize(srcPath, version)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", srcPath, err)
+	}
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	st, err := src.Stat()
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	m := &memoCopier{src: src, srcSize: st.Size(), path: outPath, blockSize: blockSize}
+	if strings.EqualFold(filepath.Ext(srcPath), ".dbt") {
+		m.dbase4 = version != 0x83
+	} else {
+		m.fpt = true
+	}
+
+	// The header takes 512 bytes; data blocks start after it
+	m.next = uint32((512 + blockSize - 1) / blockSize)
+	hdr := make([]byte, int64(m.next)*blockSize)
+	if _, err := src.ReadAt(hdr, 0); err != nil && err != io.EOF {
+		src.Close()
+		return nil, fmt.Errorf("failed to read memo header: %w", err)
+	}
+
+	if m.f, err = os.Create(outPath); err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to create memo: %w", err)
+	}
+	m.w = bufio.NewWriterSize(m.f, 1024*1024)
+	if _, err := m.w.Write(hdr); err != nil {
+		m.close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// read returns the block type (FoxPro; 1 for text) and content of the
+// memo starting at block
+func (m *memoCopier) read(block uint32) (uint32, []byte, error) {
+	pos := int64(block) * m.blockSize
+	if m.fpt || m.dbase4 {
+		var hdr [8]byte
+		if _, err := m.src.ReadAt(hdr[:], pos); err != nil {
+			return 0, nil, fmt.Errorf("memo block %d: %w", block, err)
+		}
+		typ, length := binary.BigEndian.Uint32(hdr[0:4]), binary.BigEndian.Uint32(hdr[4:8])
+		if m.dbase4 {
+			// FF FF 08 00, then length including these 8 bytes (little-endian)
+			typ, length = 1, binary.LittleEndian.Uint32(hdr[4:8])
+			if length < 8 {
+				return typ, nil, nil
+			}
+			length -= 8
+		}
+		if pos+8+int64(length) > m.srcSize {
+			return 0, nil, fmt.Errorf("memo block %d: length %d exceeds file size", block, length)
+		}
+		data := make([]byte, length)
+		if _, err := m.src.ReadAt(data, pos+8); err != nil {
+			return 0, nil, fmt.Errorf("memo block %d: %w", block, err)
+		}
+		return typ, data, nil
+	}
+
+	// dBase III: text runs until the 0x1A terminator
+	var data []byte
+	buf := make([]byte, m.blockSize)
+	for {
+		n, err := m.src.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], 0x1A); i >= 0 {
+			return 1, append(data, buf[:i]...), nil
+		}
+		data = append(data, buf[:n]...)
+		if err != nil {
+			if len(data) == 0 {
+				return 0, nil, fmt.Errorf("memo block %d: %w", block, err)
+			}
+			return 1, data, nil
+		}
+		pos += int64(n)
+	}
+}
+
+// copy copies the memo at block into the output memo and returns its new
+// block number (0 stays 0: no memo). With rc, text memos are recoded.
+func (m *memoCopier) copy(block uint32, rc *recoder) (uint32, error) {
+	if block == 0 {
+		return 0, nil
+	}
+	typ, data, err := m.read(block)
+	if err != nil {
+		return 0, err
+	}
+	if rc != nil && typ == 1 {
+		data = rc.recode(data, -1)
+	}
+
+	var buf []byte
+	switch {
+	case m.fpt:
+		buf = binary.BigEndian.AppendUint32(buf, typ)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, data...)
+	case m.dbase4:
+		buf = binary.LittleEndian.AppendUint32([]byte{0xFF, 0xFF, 0x08, 0x00}, uint32(len(data)+8))
+		buf = append(buf, data...)
+	default:
+		buf = append(append(buf, data...), 0x1A, 0x1A)
+	}
+	blocks := (int64(len(buf)) + m.blockSize - 1) / m.blockSize
+	buf = append(buf, make([]byte, blocks*m.blockSize-int64(len(buf)))...)
+
+	n := m.next
+	if _, err := m.w.Write(buf); err != nil {
+		return 0, err
+	}
+	m.next += uint32(blocks)
+	return n, nil
+}
+
+// finish flushes the output memo and sets its next free block
+func (m *memoCopier) finish() error {
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+	return setMemoNextBlock(m.f, m.next)
+}
+
+func (m *memoCopier) close() {
+	m.src.Close()
+	m.f.Close()
+}
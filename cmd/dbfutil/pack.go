@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+func runPack(args []string) error {
+	fs := newFlagSet("pack")
+	out := fs.String("o", "", "Output DBF file (default: pack the table in place)")
+	compact := fs.Bool("memo", false, "Also compact the memo file, keeping only the memos of the remaining records")
+	addIndexFlag(fs)
+	inputs := parseArgs(fs, args)
+	if err := checkIndexPolicy(); err != nil {
+		return err
+	}
+
+	if len(inputs) != 1 {
+		fs.Usage()
+		return fmt.Errorf("need one input table")
+	}
+
+	t, err := openTable(inputs[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputs[0], err)
+	}
+	defer t.Close()
+
+	memoPath := ""
+	memoCols := memoFields(t.Fields)
+	if len(memoCols) > 0 {
+		if memoPath = findMemoFile(t.Path); memoPath == "" {
+			return fmt.Errorf("%s: memo file not found", t.Path)
+		}
+	}
+
+	target := *out
+	if target == "" {
+		target = t.Path
+	}
+	warnIndex(t, target)
+	dst, err := newOutputTable(t.Path, target)
+	if err != nil {
+		return err
+	}
+	defer dst.discard()
+
+	// --- Compact Memo File ---
+	var memo *memoCopier
+	if memoPath != "" && *compact {
+		memo, err = newMemoCopier(memoPath, memoPathFor(dst.tmp, memoPath), t.Header.Version)
+		if err != nil {
+			return err
+		}
+		defer memo.close()
+		dst.memo = memoPath
+	}
+
+	// --- Write Remaining Records ---
+	w := bufio.NewWriterSize(dst.f, 4*1024*1024)
+	if _, err := w.Write(newHeader(t, t.Header.NumRecs)); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(t.records(), 1024*1024)
+	record := make([]byte, t.Header.RecLen)
+	var kept uint32
+	for n := uint32(0); n < t.Header.NumRecs; n++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return fmt.Errorf("%s: error reading record %d: %w", t.Path, n, err)
+		}
+		if record[0] == '*' {
+			continue
+		}
+		if memo != nil {
+			for _, mf := range memoCols {
+				raw := record[mf.Offset : mf.Offset+mf.Length]
+				block, err := memo.copy(getMemoBlock(raw), nil)
+				if err != nil {
+					return fmt.Errorf("%s: record %d, field %s: %w", t.Path, n+1, mf.Name, err)
+				}
+				putMemoBlock(raw, block)
+			}
+		}
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+		kept++
+	}
+
+	// Write EOF marker
+	if err := w.WriteByte(0x1A); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := patchRecordCount(dst.f, kept); err != nil {
+		return err
+	}
+
+	switch {
+	case memo != nil:
+		if err := memo.finish(); err != nil {
+			return fmt.Errorf("failed to write memo: %w", err)
+		}
+		memo.close()
+	case memoPath != "" && target != t.Path:
+		// Memo pointers are unchanged, so the memo file goes along as is
+		dst.memo = memoPath
+		if err := copyFile(memoPath, memoPathFor(dst.tmp, memoPath)); err != nil {
+			return fmt.Errorf("failed to copy memo: %w", err)
+		}
+	}
+
+	t.Close()
+	if err := dst.commit(); err != nil {
+		return err
+	}
+	fmt.Printf("  >> %s: %d records kept, %d deleted records removed\n", target, kept, t.Header.NumRecs-kept)
+	if memo != nil {
+		fmt.Printf("  >> Memo: %s (compacted)\n", memoPathFor(target, memoPath))
+	}
+	return dropIndex(target)
+}
+
+// outputTable is a table being written to a temporary file next to its
+// target, which replaces the target (possibly the input table itself) only
+// once complete
+type outputTable struct {
+	f      *os.File
+	tmp    string // temporary table path
+	target string
+	memo   string // source memo path, if a memo file was written next to tmp
+}
+
+func newOutputTable(input, target string) (*outputTable, error) {
+	tmp := filepath.Join(filepath.Dir(target), "~"+filepath.Base(target))
+	if tmp == input {
+		return nil, fmt.Errorf("%s: cannot write the temporary table", tmp)
+	}
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DBF: %w", err)
+	}
+	return &outputTable{f: f, tmp: tmp, target: target}, nil
+}
+
+// commit moves the finished table (and memo file) over the target
+func (o *outputTable) commit() error {
+	if err := o.f.Close(); err != nil {
+		return err
+	}
+	if o.memo != "" {
+		if err := os.Rename(memoPathFor(o.tmp, o.memo), memoPathFor(o.target, o.memo)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(o.tmp, o.target); err != nil {
+		return err
+	}
+	o.f = nil
+	return nil
+}
+
+// discard removes the temporary files unless commit succeeded
+func (o *outputTable) discard() {
+	if o.f == nil {
+		return
+	}
+	o.f.Close()
+	os.Remove(o.tmp)
+	if o.memo != "" {
+		os.Remove(memoPathFor(o.tmp, o.memo))
+	}
+}
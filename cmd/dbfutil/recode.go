@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// recodeEncoding is a text encoding recode can read and write, with the
+// language driver ID (header byte 29) that declares it, 0 if there is none
+type recodeEncoding struct {
+	enc  encoding.Encoding
+	ldid byte
+}
+
+var recodeEncodings = map[string]recodeEncoding{
+	"utf-8":     {unicode.UTF8, 0},
+	"gbk":       {simplifiedchinese.GBK, 0x7A},
+	"gb18030":   {simplifiedchinese.GB18030, 0x7A},
+	"big5":      {traditionalchinese.Big5, 0x78},
+	"shift_jis": {japanese.ShiftJIS, 0x7B},
+	"cp437":     {charmap.CodePage437, 0x01},
+	"cp850":     {charmap.CodePage850, 0x02},
+	"cp866":     {charmap.CodePage866, 0x65},
+	"cp1250":    {charmap.Windows1250, 0xC8},
+	"cp1251":    {charmap.Windows1251, 0xC9},
+	"cp1252":    {charmap.Windows1252, 0x03},
+}
+
+// recodeAliases are other names of the recode encodings
+var recodeAliases = map[string]string{
+	"utf8": "utf-8", "gb2312": "gbk", "cp936": "gbk", "cp950": "big5",
+	"cp932": "shift_jis", "sjis": "shift_jis", "windows-1250": "cp1250",
+	"windows-1251": "cp1251", "windows-1252": "cp1252", "latin1": "cp1252",
+}
+
+func lookupRecodeEncoding(name string) (recodeEncoding, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := recodeAliases[name]; ok {
+		name = alias
+	}
+	e, ok := recodeEncodings[name]
+	return e, ok
+}
+
+// declaredEncoding returns the encoding named by the code page mark of a
+// table header, if recode knows it
+func declaredEncoding(h DBFHeader) (string, bool) {
+	ldid := h.Reserved[29-12]
+	if ldid == 0 {
+		return "", false
+	}
+	names := make([]string, 0, len(recodeEncodings))
+	for name := range recodeEncodings {
+		names = append(names, name)
+	}
+	sort.Strings(names) // gbk before gb18030 for 0x7A
+	for _, name := range names {
+		if recodeEncodings[name].ldid == ldid {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func runRecode(args []string) error {
+	fs := newFlagSet("recode")
+	out := fs.String("o", "", "Output DBF file (required)")
+	from := fs.String("from", "", "Encoding of the input table (default: its code page mark)")
+	to := fs.String("to", "", "Encoding of the output table (required)")
+	widen := fs.Bool("widen", false, "Widen character fields whose recoded values no longer fit, instead of cutting the values")
+	addIndexFlag(fs)
+	inputs := parseArgs(fs, args)
+	if err := checkIndexPolicy(); err != nil {
+		return err
+	}
+
+	if *out == "" || *to == "" || len(inputs) != 1 {
+		fs.Usage()
+		return fmt.Errorf("need one input table, -to and -o")
+	}
+	if inputs[0] == *out {
+		return fmt.Errorf("output %s is also the input", *out)
+	}
+
+	t, err := openTable(inputs[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputs[0], err)
+	}
+	defer t.Close()
+	warnIndex(t, *out)
+
+	if *from == "" {
+		name, ok := declaredEncoding(t.Header)
+		if !ok {
+			return fmt.Errorf("%s: the table declares no known code page, use -from", t.Path)
+		}
+		*from = name
+	}
+	src, ok := lookupRecodeEncoding(*from)
+	if !ok {
+		return fmt.Errorf("unsupported encoding '%s' (supported: %s)", *from, strings.Join(sortedKeys(recodeEncodings), ", "))
+	}
+	dst, ok := lookupRecodeEncoding(*to)
+	if !ok {
+		return fmt.Errorf("unsupported encoding '%s' (supported: %s)", *to, strings.Join(sortedKeys(recodeEncodings), ", "))
+	}
+
+	rc := &recoder{decoder: src.enc.NewDecoder(), encoder: dst.enc.NewEncoder()}
+	fields := append([]FieldInfo(nil), t.Fields...)
+	for _, f := range fields {
+		if f.Type == 'V' {
+			fmt.Printf("  Warning: varchar field %s is copied unchanged\n", f.Name)
+		}
+	}
+
+	if *widen {
+		if err := rc.widenFields(t, fields); err != nil {
+			return err
+		}
+	}
+
+	// --- Recode Memo File ---
+	var memo *memoCopier
+	if len(memoFields(t.Fields)) > 0 {
+		memoPath := findMemoFile(t.Path)
+		if memoPath == "" {
+			return fmt.Errorf("%s: memo file not found", t.Path)
+		}
+		memo, err = newMemoCopier(memoPath, memoPathFor(*out, memoPath), t.Header.Version)
+		if err != nil {
+			return err
+		}
+		defer memo.close()
+	}
+
+	// --- Write Recoded Table ---
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create DBF: %w", err)
+	}
+	defer f.Close()
+
+	header, recLen := recodeHeader(t, fields, rc, dst.ldid)
+	w := bufio.NewWriterSize(f, 4*1024*1024)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(t.records(), 1024*1024)
+	record := make([]byte, t.Header.RecLen)
+	outRec := make([]byte, recLen)
+	for n := uint32(0); n < t.Header.NumRecs; n++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return fmt.Errorf("%s: error reading record %d: %w", t.Path, n, err)
+		}
+		outRec[0] = record[0] // deletion flag
+		for i, sf := range t.Fields {
+			df := fields[i]
+			raw := record[sf.Offset : sf.Offset+sf.Length]
+			slot := outRec[df.Offset : df.Offset+df.Length]
+			switch {
+			case sf.Type == 'C' && sf.Flags&0x04 == 0:
+				rc.field(slot, raw)
+			case memo != nil && (sf.Type == 'M' || sf.Type == 'G' || sf.Type == 'P'):
+				var text *recoder
+				if sf.Type == 'M' && sf.Flags&0x04 == 0 {
+					text = rc
+				}
+				block, err := memo.copy(getMemoBlock(raw), text)
+				if err != nil {
+					return fmt.Errorf("%s: record %d, field %s: %w", t.Path, n+1, sf.Name, err)
+				}
+				putMemoBlock(slot, block)
+			default:
+				copy(slot, raw)
+			}
+		}
+		if _, err := w.Write(outRec); err != nil {
+			return err
+		}
+	}
+
+	// Write EOF marker
+	if err := w.WriteByte(0x1A); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if memo != nil {
+		if err := memo.finish(); err != nil {
+			return fmt.Errorf("failed to write memo: %w", err)
+		}
+	}
+
+	fmt.Printf("  >> Output: %s (%d records, %s -> %s)\n", *out, t.Header.NumRecs, strings.ToUpper(*from), strings.ToUpper(*to))
+	if memo != nil {
+		fmt.Printf("  >> Memo: %s\n", memo.path)
+	}
+	if rc.cut > 0 {
+		fmt.Printf("  Warning: %d values were cut to their field length (see -widen)\n", rc.cut)
+	}
+	if rc.unmappable > 0 {
+		fmt.Printf("  Warning: %d characters not representable in %s were replaced with '?'\n", rc.unmappable, strings.ToUpper(*to))
+	}
+	return dropIndex(*out)
+}
+
+// recoder converts text from the input to the output encoding, counting
+// the values it had to cut and the characters it could not represent
+type recoder struct {
+	decoder    *encoding.Decoder
+	encoder    *encoding.Encoder
+	buf        []byte
+	cut        int
+	unmappable int
+}
+
+// recode returns src in the output encoding, cut to at most limit bytes
+// without splitting a character (limit < 0: no limit). The result is only
+// valid until the next call.
+func (rc *recoder) recode(src []byte, limit int) []byte {
+	ascii := true
+	for _, c := range src {
+		if c >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		// ASCII is identical in every supported encoding
+		if limit >= 0 && len(src) > limit {
+			rc.cut++
+			return src[:limit]
+		}
+		return src
+	}
+
+	text, err := rc.decoder.Bytes(src)
+	if err != nil {
+		text = src
+	}
+	dst := rc.buf[:0]
+	var enc [16]byte
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		rc.encoder.Reset()
+		n, _, err := rc.encoder.Transform(enc[:], text[:size], true)
+		if err != nil || r == utf8.RuneError && size == 1 {
+			enc[0], n = '?', 1
+			rc.unmappable++
+		}
+		if limit >= 0 && len(dst)+n > limit {
+			rc.cut++
+			break
+		}
+		dst = append(dst, enc[:n]...)
+		text = text[size:]
+	}
+	rc.buf = dst
+	return dst
+}
+
+// field recodes a character field into slot, padded with spaces
+func (rc *recoder) field(slot, raw []byte) {
+	value := rc.recode(bytes.TrimRight(raw, " \x00"), len(slot))
+	copy(slot, value)
+	for i := len(value); i < len(slot); i++ {
+		slot[i] = ' '
+	}
+}
+
+// widenFields reads the whole table once and widens the character fields
+// in fields whose recoded values would not fit, up to the 254-byte limit
+func (rc *recoder) widenFields(t *Table, fields []FieldInfo) error {
+	need := make([]int, len(t.Fields))
+	r := bufio.NewReaderSize(t.records(), 1024*1024)
+	record := make([]byte, t.Header.RecLen)
+	for n := uint32(0); n < t.Header.NumRecs; n++ {
+		if _, err := io.ReadFull(r, record); err != nil {
+			return fmt.Errorf("%s: error reading record %d: %w", t.Path, n, err)
+		}
+		for i, f := range t.Fields {
+			if f.Type == 'C' && f.Flags&0x04 == 0 {
+				raw := bytes.TrimRight(record[f.Offset:f.Offset+f.Length], " \x00")
+				need[i] = max(need[i], len(rc.recode(raw, -1)))
+			}
+		}
+	}
+	rc.unmappable = 0 // counted again when the records are written
+
+	offset := 1
+	for i := range fields {
+		if need[i] > fields[i].Length && fields[i].Length < 254 {
+			fmt.Printf("  >> Field %s widened from %d to %d\n", fields[i].Name, fields[i].Length, min(need[i], 254))
+			fields[i].Length = min(need[i], 254)
+		}
+		fields[i].Offset = offset
+		offset += fields[i].Length
+	}
+	return nil
+}
+
+// recodeHeader returns the header area of the output table: t's header
+// with the field names recoded, the field sizes and offsets of fields, and
+// the code page mark of the output encoding
+func recodeHeader(t *Table, fields []FieldInfo, rc *recoder, ldid byte) ([]byte, int) {
+	raw := newHeader(t, t.Header.NumRecs)
+	raw[29] = ldid
+	vfp := t.Header.Version == 0x30 || t.Header.Version == 0x31 || t.Header.Version == 0x32
+
+	recLen := 1
+	for i, f := range fields {
+		desc := raw[32+32*i : 64+32*i]
+		name := bytes.Clone(rc.recode(bytes.TrimRight(desc[0:11], "\x00"), 10))
+		clear(desc[0:11])
+		copy(desc[0:11], name)
+		if f.Type == 'C' {
+			desc[16], desc[17] = byte(f.Length), byte(f.Length>>8)
+		}
+		if vfp {
+			binary.LittleEndian.PutUint32(desc[12:16], uint32(f.Offset))
+		}
+		recLen += f.Length
+	}
+	rc.cut = 0 // long names are not values
+	binary.LittleEndian.PutUint16(raw[10:12], uint16(recLen))
+	return raw, recLen
+}
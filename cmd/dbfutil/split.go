@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runSplit(args []string) error {
+	fs := newFlagSet("split")
+	rows := fs.Int("rows", 0, "Maximum records per output table")
+	size := fs.String("size", "", "Maximum size per output table (e.g. 1GB); alternative to -rows")
+	addIndexFlag(fs)
+	inputs := parseArgs(fs, args)
+	if err := checkIndexPolicy(); err != nil {
+		return err
+	}
+
+	if len(inputs) != 1 || (*rows <= 0 && *size == "") {
+		fs.Usage()
+		return fmt.Errorf("need one input table and -rows or -size")
+	}
+
+	t, err := openTable(inputs[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputs[0], err)
+	}
+	defer t.Close()
+	warnIndex(t, "the parts")
+
+	perPart := uint32(*rows)
+	if *size != "" {
+		n, err := parseSize(*size)
+		if err != nil {
+			return err
+		}
+		bySize := (n - int64(t.Header.HeaderLen) - 1) / int64(t.Header.RecLen)
+		if bySize < 1 {
+			return fmt.Errorf("size %s is smaller than the header plus one record", *size)
+		}
+		if perPart == 0 || uint32(bySize) < perPart {
+			perPart = uint32(bySize)
+		}
+	}
+
+	parts := (t.Header.NumRecs + perPart - 1) / perPart
+	if parts == 0 {
+		parts = 1
+	}
+	fmt.Printf("  >> %s: %d records -> %d parts of up to %d\n", t.Path, t.Header.NumRecs, parts, perPart)
+
+	memoPath := ""
+	if len(memoFields(t.Fields)) > 0 {
+		if memoPath = findMemoFile(t.Path); memoPath == "" {
+			return fmt.Errorf("%s: memo file not found", t.Path)
+		}
+	}
+
+	width := len(fmt.Sprint(parts))
+	if width < 3 {
+		width = 3
+	}
+	ext := filepath.Ext(t.Path)
+	base := strings.TrimSuffix(t.Path, ext)
+
+	r := bufio.NewReaderSize(t.records(), 1024*1024)
+	for part := uint32(0); part < parts; part++ {
+		n := perPart
+		if remaining := t.Header.NumRecs - part*perPart; remaining < n {
+			n = remaining
+		}
+
+		out := fmt.Sprintf("%s_%0*d%s", base, width, part+1, ext)
+		if err := writePart(t, r, out, n, memoPath); err != nil {
+			return fmt.Errorf("%s: %w", out, err)
+		}
+		fmt.Printf("  >> %s: %d records\n", out, n)
+		if err := dropIndex(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePart writes a table with t's structure and the next n records of r.
+// With memoPath, the part gets its own memo file holding only the memos
+// its records refer to, and the records are given their new block numbers.
+func writePart(t *Table, r io.Reader, out string, n uint32, memoPath string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create DBF: %w", err)
+	}
+	defer f.Close()
+
+	var memo *memoCopier
+	if memoPath != "" {
+		memo, err = newMemoCopier(memoPath, memoPathFor(out, memoPath), t.Header.Version)
+		if err != nil {
+			return err
+		}
+		defer memo.close()
+	}
+
+	w := bufio.NewWriterSize(f, 4*1024*1024)
+	if _, err := w.Write(newHeader(t, n)); err != nil {
+		return err
+	}
+	if memo == nil {
+		if _, err := io.CopyN(w, r, int64(n)*int64(t.Header.RecLen)); err != nil {
+			return fmt.Errorf("error reading records: %w", err)
+		}
+	} else {
+		memoCols := memoFields(t.Fields)
+		record := make([]byte, t.Header.RecLen)
+		for i := uint32(0); i < n; i++ {
+			if _, err := io.ReadFull(r, record); err != nil {
+				return fmt.Errorf("error reading records: %w", err)
+			}
+			for _, mf := range memoCols {
+				raw := record[mf.Offset : mf.Offset+mf.Length]
+				block, err := memo.copy(getMemoBlock(raw), nil)
+				if err != nil {
+					return fmt.Errorf("record %d, field %s: %w", i+1, mf.Name, err)
+				}
+				putMemoBlock(raw, block)
+			}
+			if _, err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		if err := memo.finish(); err != nil {
+			return fmt.Errorf("failed to write memo: %w", err)
+		}
+	}
+
+	// Write EOF marker
+	if err := w.WriteByte(0x1A); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DBFHeader represents the file header structure (32 bytes)
+type DBFHeader struct {
+	Version   byte     // 0-0
+	Year      byte     // 1-1 (Year - 1900)
+	Month     byte     // 2-2
+	Day       byte     // 3-3
+	NumRecs   uint32   // 4-7
+	HeaderLen uint16   // 8-9 (Position of first record)
+	RecLen    uint16   // 10-11
+	Reserved  [20]byte // 12-31
+}
+
+// FieldInfo holds internal metadata for a column
+type FieldInfo struct {
+	Name   string
+	Type   byte
+	Length int
+	Dec    int
+	Flags  byte // VFP field flags (0x04: binary, no code page translation)
+	Offset int  // position inside the record (after the deletion flag)
+}
+
+// VFP field flags (descriptor byte 18)
+const (
+	fieldFlagSystem   = 0x01
+	fieldFlagNullable = 0x02
+	fieldFlagBinary   = 0x04
+)
+
+// Table is an open DBF file with its parsed structure
+type Table struct {
+	Path   string
+	Header DBFHeader
+	Fields []FieldInfo
+	Raw    []byte // complete header area (HeaderLen bytes), copied verbatim to outputs
+	f      *os.File
+}
+
+func openTable(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Table{Path: path, f: f}
+	if err := t.readStructure(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Table) Close() error {
+	return t.f.Close()
+}
+
+// readStructure reads the header area and field descriptors.
+// Fields are read until the 0x0D terminator, so VFP backlink areas don't
+// turn into ghost columns.
+func (t *Table) readStructure() error {
+	if err := binary.Read(t.f, binary.LittleEndian, &t.Header); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if t.Header.HeaderLen < 33 || t.Header.RecLen < 1 {
+		return fmt.Errorf("invalid header length")
+	}
+
+	t.Raw = make([]byte, t.Header.HeaderLen)
+	if _, err := t.f.ReadAt(t.Raw, 0); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	offset := 1
+	for pos := 32; pos+32 <= len(t.Raw) && t.Raw[pos] != 0x0D; pos += 32 {
+		desc := t.Raw[pos : pos+32]
+		field := FieldInfo{
+			Name:   string(bytes.TrimRight(desc[0:11], "\x00")),
+			Type:   desc[11],
+			Length: int(desc[16]),
+			Dec:    int(desc[17]),
+			Flags:  desc[18],
+			Offset: offset,
+		}
+		if field.Type == 'C' && field.Dec > 0 {
+			// Clipper long character field: the length continues in Dec
+			field.Length += field.Dec << 8
+			field.Dec = 0
+		}
+		t.Fields = append(t.Fields, field)
+		offset += field.Length
+	}
+
+	// Every field must lie inside the record, or slicing it would fail
+	if offset > int(t.Header.RecLen) {
+		return fmt.Errorf("corrupt header: the fields take %d bytes per record, the record length is %d", offset, t.Header.RecLen)
+	}
+	return nil
+}
+
+// descriptorEnd returns the offset just past the last field descriptor
+func (t *Table) descriptorEnd() int {
+	return 32 + 32*len(t.Fields)
+}
+
+// records returns a reader over the data area (NumRecs * RecLen bytes)
+func (t *Table) records() io.Reader {
+	n := int64(t.Header.NumRecs) * int64(t.Header.RecLen)
+	return io.NewSectionReader(t.f, int64(t.Header.HeaderLen), n)
+}
+
+// sameStructure reports why two tables can't share records, or nil
+func sameStructure(a, b *Table) error {
+	if a.Header.RecLen != b.Header.RecLen {
+		return fmt.Errorf("record length %d differs from %d", b.Header.RecLen, a.Header.RecLen)
+	}
+	if len(a.Fields) != len(b.Fields) {
+		return fmt.Errorf("field count %d differs from %d", len(b.Fields), len(a.Fields))
+	}
+	for i := range a.Fields {
+		fa, fb := a.Fields[i], b.Fields[i]
+		if !strings.EqualFold(fa.Name, fb.Name) || fa.Type != fb.Type || fa.Length != fb.Length || fa.Dec != fb.Dec {
+			return fmt.Errorf("field %d is %s %c(%d,%d), expected %s %c(%d,%d)",
+				i+1, fb.Name, fb.Type, fb.Length, fb.Dec, fa.Name, fa.Type, fa.Length, fa.Dec)
+		}
+	}
+	return nil
+}
+
+// newHeader returns a copy of the header area of t with the record count
+// and last-update date replaced, and the production index flag cleared
+// unless -index keep
+func newHeader(t *Table, numRecs uint32) []byte {
+	raw := append([]byte(nil), t.Raw...)
+	now := time.Now()
+	raw[1] = byte(now.Year() - 1900)
+	raw[2] = byte(now.Month())
+	raw[3] = byte(now.Day())
+	binary.LittleEndian.PutUint32(raw[4:8], numRecs)
+	if indexPolicy != indexKeep {
+		raw[28] &^= tableFlagIndex
+	}
+	return raw
+}
+
+// patchRecordCount rewrites NumRecs (bytes 4-7) of an already written header
+func patchRecordCount(f *os.File, numRecs uint32) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], numRecs)
+	if _, err := f.WriteAt(buf[:], 4); err != nil {
+		return fmt.Errorf("failed to update record count: %w", err)
+	}
+	return nil
+}
+
+// memoFields returns the fields whose data lives in the memo file
+func memoFields(fields []FieldInfo) []FieldInfo {
+	var out []FieldInfo
+	for _, f := range fields {
+		switch f.Type {
+		case 'M', 'G', 'P':
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// findMemoFile returns the .fpt/.dbt file paired with a table, or ""
+func findMemoFile(dbfPath string) string {
+	base := strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath))
+	for _, ext := range []string{".fpt", ".FPT", ".dbt", ".DBT"} {
+		if st, err := os.Stat(base + ext); err == nil && !st.IsDir() {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// memoPathFor returns the memo path for an output table, keeping the memo
+// extension (.fpt/.dbt) of the source
+func memoPathFor(dbfPath, srcMemo string) string {
+	ext := strings.ToLower(filepath.Ext(srcMemo))
+	if filepath.Ext(dbfPath) == strings.ToUpper(filepath.Ext(dbfPath)) {
+		ext = strings.ToUpper(ext)
+	}
+	return strings.TrimSuffix(dbfPath, filepath.Ext(dbfPath)) + ext
+}
+
+// memoBlockSize reads the block size from a memo file header
+func memoBlockSize(path string, version byte) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var hdr [32]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		return 0, fmt.Errorf("failed to read memo header: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".dbt") {
+		// dBase IV stores the block size at 20-21; dBase III is always 512
+		if bs := binary.LittleEndian.Uint16(hdr[20:22]); version != 0x83 && bs != 0 {
+			return int64(bs), nil
+		}
+		return 512, nil
+	}
+	// FoxPro stores the block size big-endian at 6-7
+	if bs := binary.BigEndian.Uint16(hdr[6:8]); bs != 0 {
+		return int64(bs), nil
+	}
+	return 512, nil
+}
+
+// setMemoNextBlock updates the "next free block" pointer of a memo file
+func setMemoNextBlock(f *os.File, next uint32) error {
+	var buf [4]byte
+	if strings.EqualFold(filepath.Ext(f.Name()), ".dbt") {
+		binary.LittleEndian.PutUint32(buf[:], next)
+	} else {
+		binary.BigEndian.PutUint32(buf[:], next)
+	}
+	_, err := f.WriteAt(buf[:], 0)
+	return err
+}
+
+// getMemoBlock reads the block number stored in a memo field: VFP uses a
+// 4-byte little-endian integer, older formats 10 ASCII digits
+func getMemoBlock(raw []byte) uint32 {
+	if len(raw) == 4 {
+		return binary.LittleEndian.Uint32(raw)
+	}
+	n, err := strconv.ParseUint(string(bytes.TrimSpace(raw)), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(n)
+}
+
+// putMemoBlock stores a block number in a memo field in its native format
+func putMemoBlock(raw []byte, block uint32) {
+	if len(raw) == 4 {
+		binary.LittleEndian.PutUint32(raw, block)
+		return
+	}
+	for i := range raw {
+		raw[i] = ' '
+	}
+	if block == 0 {
+		return
+	}
+	s := strconv.FormatUint(uint64(block), 10)
+	if len(s) <= len(raw) {
+		copy(raw[len(raw)-len(s):], s)
+	}
+}
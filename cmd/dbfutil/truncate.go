@@ -0,0 +1,69 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// truncateEncoded cuts an encoded value to at most n bytes without splitting
+// a character of enc, one of the recode encodings
+func truncateEncoded(b []byte, n int, enc encoding.Encoding) []byte {
+	if len(b) <= n {
+		return b
+	}
+	if enc == unicode.UTF8 {
+		for n > 0 && !utf8.RuneStart(b[n]) {
+			n--
+		}
+		return b[:n]
+	}
+
+	// size returns the length of the character starting at b[i]
+	var size func(i int) int
+	switch enc {
+	case simplifiedchinese.GBK, simplifiedchinese.GB18030:
+		// ASCII is one byte, other characters two bytes, or four when the
+		// second byte is a digit
+		size = func(i int) int {
+			if b[i] < 0x80 {
+				return 1
+			}
+			if i+1 < len(b) && b[i+1] >= '0' && b[i+1] <= '9' {
+				return 4
+			}
+			return 2
+		}
+	case traditionalchinese.Big5:
+		size = func(i int) int {
+			if b[i] >= 0x81 && b[i] <= 0xFE {
+				return 2
+			}
+			return 1
+		}
+	case japanese.ShiftJIS:
+		// 0xA1-0xDF are single-byte katakana
+		size = func(i int) int {
+			if b[i] >= 0x81 && b[i] <= 0x9F || b[i] >= 0xE0 && b[i] <= 0xFC {
+				return 2
+			}
+			return 1
+		}
+	default:
+		return b[:n] // single-byte code pages
+	}
+
+	i := 0
+	for i < n {
+		s := size(i)
+		if i+s > n {
+			break
+		}
+		i += s
+	}
+	return b[:i]
+}
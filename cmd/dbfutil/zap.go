@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+)
+
+func runZap(args []string) error {
+	fs := newFlagSet("zap")
+	out := fs.String("o", "", "Output DBF file (default: empty the table in place)")
+	addIndexFlag(fs)
+	inputs := parseArgs(fs, args)
+	if err := checkIndexPolicy(); err != nil {
+		return err
+	}
+
+	if len(inputs) != 1 {
+		fs.Usage()
+		return fmt.Errorf("need one input table")
+	}
+
+	t, err := openTable(inputs[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputs[0], err)
+	}
+	defer t.Close()
+
+	target := *out
+	if target == "" {
+		target = t.Path
+	}
+	warnIndex(t, target)
+	dst, err := newOutputTable(t.Path, target)
+	if err != nil {
+		return err
+	}
+	defer dst.discard()
+
+	// The header area is kept whole: structure, code page and VFP backlink
+	if _, err := dst.f.Write(newHeader(t, 0)); err != nil {
+		return err
+	}
+	// Write EOF marker
+	if _, err := dst.f.Write([]byte{0x1A}); err != nil {
+		return err
+	}
+
+	// An empty memo file: the original header with no blocks after it
+	memoPath := ""
+	if len(memoFields(t.Fields)) > 0 {
+		if memoPath = findMemoFile(t.Path); memoPath == "" {
+			return fmt.Errorf("%s: memo file not found", t.Path)
+		}
+		memo, err := newMemoCopier(memoPath, memoPathFor(dst.tmp, memoPath), t.Header.Version)
+		if err != nil {
+			return err
+		}
+		dst.memo = memoPath
+		err = memo.finish()
+		memo.close()
+		if err != nil {
+			return fmt.Errorf("failed to write memo: %w", err)
+		}
+	}
+
+	t.Close()
+	if err := dst.commit(); err != nil {
+		return err
+	}
+	fmt.Printf("  >> %s: %d records removed, structure kept\n", target, t.Header.NumRecs)
+	if memoPath != "" {
+		fmt.Printf("  >> Memo: %s (emptied)\n", memoPathFor(target, memoPath))
+	}
+	return dropIndex(target)
+}
@@ -0,0 +1,165 @@
+package dbf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Batch holds a run of consecutive raw records, as Reader.Batches reads
+// them. Batches are recycled once released, so the read stage doesn't
+// allocate once a pipeline has warmed up.
+type Batch struct {
+	Seq   int    // position of the batch in the stream
+	First uint32 // index of the first record in the batch (0-based)
+	Count int    // number of complete records in Data
+	Data  []byte
+	Err   error // read error that ended the stream after this batch
+
+	recLen int
+	refs   atomic.Int32
+}
+
+var batchPool sync.Pool
+
+func getBatch(size, recLen int) *Batch {
+	b, ok := batchPool.Get().(*Batch)
+	if ok && cap(b.Data) >= size {
+		b.Data = b.Data[:size]
+	} else {
+		b = &Batch{Data: make([]byte, size)}
+	}
+	b.recLen = recLen
+	b.refs.Store(1)
+	return b
+}
+
+// Record returns the i-th raw record of the batch, starting with its
+// deletion flag
+func (b *Batch) Record(i int) []byte {
+	return b.Data[i*b.recLen : (i+1)*b.recLen]
+}
+
+// Retain adds n references to the batch, for handing it to n more
+// consumers; each of them releases it
+func (b *Batch) Retain(n int) {
+	b.refs.Add(int32(n))
+}
+
+// Release hands the batch back for reuse. A retained batch is only recycled
+// once every consumer has released it; it must not be used after.
+func (b *Batch) Release() {
+	if b.refs.Add(-1) > 0 {
+		return
+	}
+	b.Count = 0
+	b.Err = nil
+	batchPool.Put(b)
+}
+
+// batchRecords returns how many records are read per batch (about 256 KB)
+func batchRecords(recLen int) int {
+	return max(256*1024/recLen, 1)
+}
+
+// Batches reads the remaining records in batches on a goroutine and sends
+// them on the returned channel, which holds at most depth batches, so
+// reading overlaps with processing the records. Deleted records are
+// included (see Batch.Record) and Decrypt is applied. The channel is closed
+// when reading ends; a read failure is reported in Err of the last batch.
+// ctx is checked between batches: once it is done the channel is closed
+// without further batches, and the consumer sees ctx.Err() itself.
+// Every batch must be released.
+func (r *Reader) Batches(ctx context.Context, depth int) <-chan *Batch {
+	out := make(chan *Batch, depth)
+	go func() {
+		defer close(out)
+		if err := r.start(); err != nil {
+			b := getBatch(0, 1)
+			b.Err = err
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				b.Release()
+			}
+			return
+		}
+
+		recLen := int(r.header.RecLen)
+		perBatch := batchRecords(recLen)
+		for seq := 0; r.read < r.header.NumRecs; seq++ {
+			if ctx.Err() != nil {
+				return
+			}
+			n := min(uint32(perBatch), r.header.NumRecs-r.read)
+			b := getBatch(int(n)*recLen, recLen)
+			b.Seq, b.First = seq, r.read
+			err := r.readBatch(b)
+
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				b.Release()
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// readBatch fills b with the next records. A clean end of the data
+// (before NumRecs says, or at a 0x1A end-of-file marker with Lenient)
+// ends the records with io.EOF; other errors are also set in b.Err.
+func (r *Reader) readBatch(b *Batch) error {
+	got, err := io.ReadFull(r.r, b.Data)
+	b.Count = got / b.recLen
+	if r.Lenient {
+		err = lenientEnd(b, err)
+	}
+	if r.Decrypt != nil {
+		for i := 0; i < b.Count; i++ {
+			r.Decrypt(b.First+uint32(i), b.Record(i))
+		}
+	}
+	r.read += uint32(b.Count)
+	if err == nil {
+		return nil
+	}
+	r.read = r.header.NumRecs
+
+	// A clean EOF on a record boundary just means fewer records than
+	// NumRecs claims; a partial record is an error
+	if errors.Is(err, io.ErrUnexpectedEOF) && got%b.recLen == 0 {
+		err = io.EOF
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		b.Err = fmt.Errorf("error reading record %d: %w (the file ends inside it)", b.First+uint32(b.Count), err)
+	} else if !errors.Is(err, io.EOF) {
+		b.Err = fmt.Errorf("error reading record %d: %w", b.First+uint32(b.Count), err)
+	}
+	return err
+}
+
+// lenientEnd ends the records of a table whose header claims more than the
+// stream holds where the data actually stops: at the 0x1A end-of-file
+// marker in place of a record's deletion flag, or at a partial record cut
+// off by the end of the stream. Both drop the batch to the records before
+// them and end the records cleanly instead of failing.
+func lenientEnd(b *Batch, err error) error {
+	for i := 0; i < b.Count; i++ {
+		if b.Record(i)[0] == 0x1A {
+			b.Count = i
+			return io.EOF
+		}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
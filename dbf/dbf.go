@@ -0,0 +1,293 @@
+// Package dbf reads dBase, FoxPro and Visual FoxPro tables and converts them
+// to CSV the way dbf2csv does with its default options, for programs that
+// want the conversion without running the command.
+//
+// Tables are opened from an io/fs.FS, so they can come from the operating
+// system (os.DirFS), an embed.FS, a zip archive (archive/zip.Reader) or a
+// testing/fstest.MapFS alike. Reader and Writer work on plain streams
+// instead, for tables in memory, on a network connection or in a pipe.
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Header is the 32-byte table header
+type Header struct {
+	Version   byte     // 0-0
+	Year      byte     // 1-1 (Year - 1900)
+	Month     byte     // 2-2
+	Day       byte     // 3-3
+	NumRecs   uint32   // 4-7
+	HeaderLen uint16   // 8-9 (Position of first record)
+	RecLen    uint16   // 10-11
+	Reserved  [20]byte // 12-31
+}
+
+// Level7 reports whether h is a dBase 7 table (0x04, or 0x8C with memo)
+func (h Header) Level7() bool {
+	return h.Version&0x07 == 0x04
+}
+
+// CodePage returns the code page declared by the language driver ID in
+// header byte 29, or 0 if the table does not declare one
+func (h Header) CodePage() int {
+	return ldidCodePages[h.Reserved[29-12]]
+}
+
+// Field describes one column of a table
+type Field struct {
+	Name   string
+	Type   byte // C, N, F, D, L, M, I, B, Y, T, V, ...
+	Length int
+	Dec    int
+	Offset int  // position inside the record (the deletion flag is 0)
+	Flags  byte // VFP field flags (descriptor byte 18)
+	Level7 bool // dBase 7 table: I, +, O and @ use the level 7 binary layout
+
+	NullAt   int // record position of the _NullFlags byte with the null bit, 0 if not nullable
+	NullMask byte
+	VarAt    int // same for the varlength bit of V and Q fields, 0 if there is none
+	VarMask  byte
+
+	AutoNext uint32 // next value of an autoincrement field, from its descriptor
+	AutoStep byte
+}
+
+// VFP field flags (descriptor byte 18)
+const (
+	fieldFlagSystem   = 0x01
+	fieldFlagNullable = 0x02
+	fieldFlagBinary   = 0x04 // binary memo, not translated between code pages
+	fieldFlagAutoInc  = 0x08 // autoincrement Integer
+)
+
+// Schema is the structure of a table: its header and fields, without the
+// hidden _NullFlags field of Visual FoxPro tables
+type Schema struct {
+	Header  Header
+	Fields  []Field
+	Clipper bool // character field lengths continue in Dec (Clipper)
+}
+
+// CodePage returns the code page the table declares, or 0 (see
+// Header.CodePage)
+func (s Schema) CodePage() int {
+	return s.Header.CodePage()
+}
+
+// Size returns the size of the table the header describes: the header
+// area and the records, without the end-of-file marker
+func (s Schema) Size() int64 {
+	return int64(s.Header.HeaderLen) + int64(s.Header.NumRecs)*int64(s.Header.RecLen)
+}
+
+// ReadStructure reads the header and field descriptors of a table from r
+// and leaves r just past the 0x0D field terminator; the records start at
+// Header.HeaderLen. Fields are read until the terminator, so VFP backlink
+// areas don't turn into ghost columns. Of opts, Encoding (for the field
+// names) and Clipper are used. On error the Schema holds what was read.
+func ReadStructure(r io.Reader, opts *Options) (Schema, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	var s Schema
+	h := &s.Header
+	if err := binary.Read(r, binary.LittleEndian, h); err != nil {
+		return s, fmt.Errorf("failed to read header: %w", err)
+	}
+	if h.HeaderLen < 32 {
+		return s, fmt.Errorf("invalid header length")
+	}
+	if h.RecLen < 1 {
+		return s, fmt.Errorf("corrupt header: record length %d", h.RecLen)
+	}
+
+	// dBase 7 tables have a language driver name after the header and
+	// 48-byte field descriptors with 32-character names
+	level7 := h.Level7()
+	descLen, nameLen := 32, 11
+	if level7 {
+		var driver [36]byte
+		if _, err := io.ReadFull(r, driver[:]); err != nil {
+			return s, fmt.Errorf("failed to read header: %w", err)
+		}
+		descLen, nameLen = 48, 32
+	}
+
+	var fields []Field
+	decoder := encodingOf(opts.Encoding).NewDecoder()
+	desc := make([]byte, descLen)
+	offset := 1
+	for {
+		if _, err := io.ReadFull(r, desc[:1]); err != nil {
+			return s, fmt.Errorf("error reading field marker: %w", err)
+		}
+		if desc[0] == 0x0D {
+			break
+		}
+		if _, err := io.ReadFull(r, desc[1:]); err != nil {
+			return s, fmt.Errorf("error reading field definition: %w", err)
+		}
+		if len(fields) == 4096 {
+			return s, fmt.Errorf("too many fields")
+		}
+
+		// Field names are usually ASCII, but decoding helps with some encodings
+		name, _, _ := transform.Bytes(decoder, bytes.TrimRight(desc[:nameLen], "\x00"))
+		f := Field{Name: string(name), Type: desc[11], Length: int(desc[16]), Dec: int(desc[17]), Offset: offset}
+		if level7 {
+			f.Type, f.Length, f.Dec, f.Level7 = desc[32], int(desc[33]), int(desc[34]), true
+			if f.Type == '+' {
+				f.AutoNext, f.AutoStep = binary.LittleEndian.Uint32(desc[40:44]), 1
+			}
+		} else {
+			f.Flags = desc[18]
+			if f.Flags&fieldFlagAutoInc != 0 {
+				// VFP keeps the next value at bytes 19-22 and the step at 23
+				f.AutoNext, f.AutoStep = binary.LittleEndian.Uint32(desc[19:23]), desc[23]
+			}
+		}
+		offset += f.Length
+		fields = append(fields, f)
+	}
+
+	if opts.Clipper || !fitsRecord(*h, fields) {
+		fields, s.Clipper = clipperLengths(*h, fields, opts.Clipper)
+	}
+	// Every field must lie inside the record, or slicing it would fail
+	if n := recordLength(fields); n > int(h.RecLen) {
+		return s, fmt.Errorf("corrupt header: the fields take %d bytes per record, the record length is %d", n, h.RecLen)
+	}
+	s.Fields = resolveNullFlags(fields)
+	return s, nil
+}
+
+// readStructure reads the structure of a table and skips the rest of the
+// header area (VFP backlink, padding), leaving r at the first record
+func readStructure(r *countingReader, opts *Options) (Schema, error) {
+	s, err := ReadStructure(r, opts)
+	if err != nil {
+		return s, err
+	}
+	if skip := int64(s.Header.HeaderLen) - r.n; skip > 0 {
+		if _, err := io.CopyN(io.Discard, r, skip); err != nil {
+			return s, fmt.Errorf("failed to read header: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// encodingOf returns enc, or UTF-8 when it is nil
+func encodingOf(enc encoding.Encoding) encoding.Encoding {
+	if enc == nil {
+		return unicode.UTF8
+	}
+	return enc
+}
+
+// fitsRecord reports whether the field lengths add up to the record length
+func fitsRecord(h Header, fields []Field) bool {
+	return recordLength(fields) == int(h.RecLen)
+}
+
+// recordLength returns the record length the fields add up to, with the
+// deletion flag
+func recordLength(fields []Field) int {
+	n := 1
+	for _, f := range fields {
+		n += f.Length
+	}
+	return n
+}
+
+// clipperLengths applies Clipper's long character fields, whose length is
+// Len + 256*Dec. Unless forced this is only done if it makes the fields
+// add up to the record length when they did not before; the second result
+// reports whether it was done.
+func clipperLengths(h Header, fields []Field, force bool) ([]Field, bool) {
+	long := make([]Field, len(fields))
+	copy(long, fields)
+	offset := 1
+	for i := range long {
+		if long[i].Type == 'C' && long[i].Dec > 0 {
+			long[i].Length += long[i].Dec << 8
+			long[i].Dec = 0
+		}
+		long[i].Offset = offset
+		offset += long[i].Length
+	}
+	if !force && !fitsRecord(h, long) {
+		return fields, false
+	}
+	return long, true
+}
+
+// resolveNullFlags locates the null bit of every nullable field, and the
+// varlength bit of every V and Q field, in the hidden _NullFlags field of a
+// Visual FoxPro table and drops _NullFlags from the returned fields. Bits
+// are assigned in field order, starting with the lowest bit of the first
+// byte; a nullable V or Q field has its varlength bit first.
+func resolveNullFlags(fields []Field) []Field {
+	nf := -1
+	for i, f := range fields {
+		if f.Type == '0' || f.Flags&fieldFlagSystem != 0 && strings.EqualFold(f.Name, "_NullFlags") {
+			nf = i
+			break
+		}
+	}
+	if nf < 0 {
+		return fields
+	}
+	flags := fields[nf]
+	fields = append(fields[:nf:nf], fields[nf+1:]...)
+
+	bit := 0
+	next := func() (int, byte) {
+		at, mask := 0, byte(0)
+		if bit/8 < flags.Length {
+			at, mask = flags.Offset+bit/8, 1<<(bit%8)
+		}
+		bit++
+		return at, mask
+	}
+	for i := range fields {
+		if fields[i].Type == 'V' || fields[i].Type == 'Q' {
+			fields[i].VarAt, fields[i].VarMask = next()
+		}
+		if fields[i].Flags&fieldFlagNullable != 0 {
+			fields[i].NullAt, fields[i].NullMask = next()
+		}
+	}
+	return fields
+}
+
+// hasMemoFields reports whether any field keeps its data in the memo file
+func hasMemoFields(fields []Field) bool {
+	for _, f := range fields {
+		if f.Type == 'M' || f.Type == 'G' || f.Type == 'W' || f.Type == 'P' {
+			return true
+		}
+	}
+	return false
+}
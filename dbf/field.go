@@ -0,0 +1,76 @@
+package dbf
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Null reports whether the field is null in record (a VFP null, flagged in
+// the _NullFlags field)
+func (f Field) Null(record []byte) bool {
+	return f.NullAt > 0 && record[f.NullAt]&f.NullMask != 0
+}
+
+// Data returns the bytes of the field in record. V and Q fields are cut
+// to their actual length: when the varlength bit is set the value is
+// shorter than the field and its length is in the last byte.
+func (f Field) Data(record []byte) []byte {
+	raw := record[f.Offset : f.Offset+f.Length]
+	if f.VarAt == 0 || record[f.VarAt]&f.VarMask == 0 || len(raw) == 0 {
+		return raw
+	}
+	if n := int(raw[len(raw)-1]); n < len(raw) {
+		return raw[:n]
+	}
+	return raw[:len(raw)-1]
+}
+
+// Int decodes an I (Integer) or + (Autoincrement) value
+func (f Field) Int(raw []byte) (int64, bool) {
+	if len(raw) != 4 || f.Type != 'I' && f.Type != '+' {
+		return 0, false
+	}
+	if f.Level7 || f.Type == '+' {
+		return int64(level7Int(raw)), true
+	}
+	return int64(int32(binary.LittleEndian.Uint32(raw))), true
+}
+
+// Float decodes a B (VFP Double) or O (dBase 7 Double) value
+func (f Field) Float(raw []byte) (float64, bool) {
+	switch {
+	case len(raw) != 8:
+		return 0, false
+	case f.Type == 'B':
+		return math.Float64frombits(binary.LittleEndian.Uint64(raw)), true
+	case f.Type == 'O':
+		return level7Double(raw), true
+	}
+	return 0, false
+}
+
+// Currency decodes a Y (Currency) value: an integer count of 1/10000 units
+func (f Field) Currency(raw []byte) (int64, bool) {
+	if len(raw) != 8 || f.Type != 'Y' {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(raw)), true
+}
+
+// Time decodes a T (VFP DateTime) or @ (dBase 7 Timestamp) value as UTC,
+// to the second. An all-zero value is empty and reports false.
+func (f Field) Time(raw []byte) (time.Time, bool) {
+	if len(raw) != 8 || isZero(raw) {
+		return time.Time{}, false
+	}
+	switch f.Type {
+	case 'T':
+		return julianDayToTime(int(binary.LittleEndian.Uint32(raw[:4])), int(binary.LittleEndian.Uint32(raw[4:]))), true
+	case '@':
+		ms := level7Double(raw)
+		day := math.Floor(ms / 86400000)
+		return julianDayToTime(int(day), int(ms-day*86400000)), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,143 @@
+package dbf
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"golang.org/x/text/encoding"
+)
+
+// Options adjust a conversion. The zero value (or a nil *Options) reads
+// UTF-8 text and writes comma-separated CSV with every record.
+type Options struct {
+	Encoding    encoding.Encoding // text encoding of the table, e.g. simplifiedchinese.GBK
+	Comma       rune              // CSV field delimiter (default ',')
+	SkipDeleted bool              // leave out records marked as deleted
+	Clipper     bool              // always read character fields with Dec > 0 as Clipper long fields
+	OnSchema    func(Schema)      // called with the structure of the table before the first record
+}
+
+// memoExts maps a table extension to the extension of its memo file,
+// covering the FoxPro forms, reports etc. that are DBF+FPT pairs too
+var memoExts = map[string][]string{
+	".dbf": {".fpt", ".dbt"},
+	".scx": {".sct"},
+	".vcx": {".vct"},
+	".frx": {".frt"},
+	".lbx": {".lbt"},
+	".mnx": {".mnt"},
+	".pjx": {".pjt"},
+	".dbc": {".dct"},
+}
+
+// ConvertFS writes the table name in fsys to w as UTF-8 CSV: a header row
+// with the field names, then one row per record. Memo fields are read from
+// the .fpt or .dbt file next to the table, when there is one.
+func ConvertFS(fsys fs.FS, name string, w io.Writer, opts *Options) error {
+	return ConvertFSContext(context.Background(), fsys, name, w, opts)
+}
+
+// ConvertFSContext is ConvertFS, but it stops between records once ctx is
+// done and returns the error of ctx, wrapped
+func ConvertFSContext(ctx context.Context, fsys fs.FS, name string, w io.Writer, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := NewReader(f)
+	r.Encoding, r.SkipDeleted, r.Clipper = opts.Encoding, opts.SkipDeleted, opts.Clipper
+	r.OnSchema = opts.OnSchema
+	memo, err := setMemoFS(r, fsys, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if memo != nil {
+		defer memo.Close()
+	}
+	if err := writeCSV(ctx, r, w, opts.Comma); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// writeCSV writes the records of r as CSV
+func writeCSV(ctx context.Context, r *Reader, w io.Writer, comma rune) error {
+	fields, err := r.Fields()
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if comma != 0 {
+		cw.Comma = comma
+	}
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Name
+	}
+	if err := cw.Write(names); err != nil {
+		return err
+	}
+	for {
+		row, err := r.ReadContext(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// setMemoFS gives r the memo file paired with table in fsys, if there is
+// one, and returns it for the caller to close. Files that support random
+// access (os and embed files) are read in place, others (e.g. in a zip
+// archive) are read into memory.
+func setMemoFS(r *Reader, fsys fs.FS, table string) (io.Closer, error) {
+	ext := path.Ext(table)
+	base := strings.TrimSuffix(table, ext)
+	for _, memoExt := range memoExts[strings.ToLower(ext)] {
+		candidates := []string{base + memoExt, base + strings.ToUpper(memoExt)}
+		if ext == strings.ToUpper(ext) {
+			candidates[0], candidates[1] = candidates[1], candidates[0]
+		}
+		for _, name := range candidates {
+			st, err := fs.Stat(fsys, name)
+			if err != nil || st.IsDir() {
+				continue
+			}
+			dbt := strings.EqualFold(memoExt, ".dbt")
+			f, err := fsys.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			if ra, ok := f.(io.ReaderAt); ok {
+				r.SetMemo(ra, st.Size(), dbt)
+				return f, nil
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+			r.SetMemo(bytes.NewReader(data), int64(len(data)), dbt)
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,133 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Memo provides random access to the blocks of a .fpt/.dbt memo file
+type Memo struct {
+	r         io.ReaderAt
+	size      int64
+	blockSize int64
+	fpt       bool // FoxPro layout (typed, length-prefixed blocks)
+	dbase4    bool // dBase IV .dbt layout (length-prefixed blocks)
+}
+
+// NewMemo reads the memo header of the memo file in r, which is size bytes
+// long; fpt tells .fpt from .dbt files and version is the DBF version byte,
+// which tells dBase III (0x83) and dBase IV (0x8B) .dbt layouts apart
+func NewMemo(r io.ReaderAt, size int64, fpt bool, version byte) (*Memo, error) {
+	var hdr [32]byte
+	if n, _ := r.ReadAt(hdr[:], 0); n < len(hdr) {
+		return nil, fmt.Errorf("failed to read memo header: file too short")
+	}
+
+	m := &Memo{r: r, size: size, blockSize: 512, fpt: fpt}
+	if fpt {
+		// FoxPro stores the block size big-endian at 6-7
+		if bs := binary.BigEndian.Uint16(hdr[6:8]); bs != 0 {
+			m.blockSize = int64(bs)
+		}
+	} else if version != 0x83 {
+		// dBase IV stores the block size at 20-21; dBase III is always 512
+		m.dbase4 = true
+		if bs := binary.LittleEndian.Uint16(hdr[20:22]); bs != 0 {
+			m.blockSize = int64(bs)
+		}
+	}
+	return m, nil
+}
+
+// BlockSize returns the size of the memo blocks in bytes
+func (m *Memo) BlockSize() int64 {
+	return m.blockSize
+}
+
+// Size returns the size of the memo file in bytes
+func (m *Memo) Size() int64 {
+	return m.size
+}
+
+// Layout names the block layout of the memo file
+func (m *Memo) Layout() string {
+	switch {
+	case m.fpt:
+		return "FoxPro FPT"
+	case m.dbase4:
+		return "dBase IV DBT"
+	}
+	return "dBase III DBT"
+}
+
+// Read returns the raw content of the memo starting at block; block 0
+// is an empty memo
+func (m *Memo) Read(block uint32) ([]byte, error) {
+	if block == 0 {
+		return nil, nil
+	}
+	pos := int64(block) * m.blockSize
+
+	if m.fpt || m.dbase4 {
+		var hdr [8]byte
+		if _, err := m.r.ReadAt(hdr[:], pos); err != nil {
+			return nil, fmt.Errorf("memo block %d: %w", block, err)
+		}
+
+		var length uint32
+		if m.fpt {
+			// Bytes 0-3: block type, 4-7: data length (big-endian)
+			length = binary.BigEndian.Uint32(hdr[4:8])
+		} else {
+			// FF FF 08 00, then length including these 8 bytes (little-endian)
+			length = binary.LittleEndian.Uint32(hdr[4:8])
+			if length < 8 {
+				return nil, nil
+			}
+			length -= 8
+		}
+
+		if pos+8+int64(length) > m.size {
+			return nil, fmt.Errorf("memo block %d: length %d exceeds file size", block, length)
+		}
+		data := make([]byte, length)
+		if _, err := m.r.ReadAt(data, pos+8); err != nil {
+			return nil, fmt.Errorf("memo block %d: %w", block, err)
+		}
+		return data, nil
+	}
+
+	// dBase III: text runs until the 0x1A terminator
+	var out []byte
+	buf := make([]byte, m.blockSize)
+	for {
+		n, err := m.r.ReadAt(buf, pos)
+		if n == 0 {
+			if err != nil && len(out) == 0 {
+				return nil, fmt.Errorf("memo block %d: %w", block, err)
+			}
+			return out, nil
+		}
+		if i := bytes.IndexByte(buf[:n], 0x1A); i >= 0 {
+			return append(out, buf[:i]...), nil
+		}
+		out = append(out, buf[:n]...)
+		pos += int64(n)
+	}
+}
+
+// MemoBlock extracts the block number from a memo field: VFP stores a
+// 4-byte little-endian integer, older formats 10 ASCII digits
+func MemoBlock(raw []byte) uint32 {
+	if len(raw) == 4 {
+		return binary.LittleEndian.Uint32(raw)
+	}
+	n, err := strconv.ParseUint(string(bytes.TrimSpace(raw)), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(n)
+}
@@ -0,0 +1,183 @@
+package dbf
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/text/encoding"
+)
+
+// Reader reads the records of a table from a stream. It never seeks, so
+// the table can come from a buffer, a network connection or a pipe; only
+// memo files need random access (see SetMemo).
+type Reader struct {
+	// Encoding is the text encoding of the table (default UTF-8). Set it
+	// before the first call to Header, Fields or Read.
+	Encoding encoding.Encoding
+	// SkipDeleted makes Read leave out records marked as deleted
+	SkipDeleted bool
+	// Clipper makes character fields with Dec > 0 always read as Clipper
+	// long fields; without it they do when that makes the fields fit
+	Clipper bool
+	// Lenient makes Batches end the records where the data actually stops
+	// when the header claims more records than the stream holds: at a 0x1A
+	// end-of-file marker, or at a partial last record
+	Lenient bool
+	// Decrypt, if set, decrypts each record in place as it is read; recno
+	// is its 0-based index
+	Decrypt func(recno uint32, record []byte)
+	// OnSchema, if set, is called with the structure of the table once it
+	// is known, before the first record is read
+	OnSchema func(Schema)
+
+	r       *bufio.Reader
+	decoder *encoding.Decoder
+	header  Header
+	fields  []Field
+	clipper bool
+	err     error // sticky error from reading the header
+	started bool
+	preset  bool // the structure was given to NewRecordReader
+
+	memoR    io.ReaderAt
+	memoSize int64
+	memoDBT  bool
+	memo     *Memo
+
+	record  []byte
+	read    uint32 // records read so far
+	deleted bool
+	buf     []byte
+	bounds  []int
+	row     []string
+}
+
+// NewReader returns a Reader for the table in r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// NewRecordReader returns a Reader for the records of a table whose
+// structure was read with ReadStructure: r must be positioned at the first
+// record (Header.HeaderLen), and Header.NumRecs records are read from it
+func NewRecordReader(r io.Reader, s Schema) *Reader {
+	return &Reader{r: bufio.NewReader(r), header: s.Header, fields: s.Fields, clipper: s.Clipper, preset: true}
+}
+
+// SetMemo supplies the memo file of the table, read with random access;
+// dbt tells a dBase .dbt file from a FoxPro .fpt file. Without a memo file
+// memo fields read as "[MEMO/OLE]". Call it before the first Read.
+func (r *Reader) SetMemo(m io.ReaderAt, size int64, dbt bool) {
+	r.memoR, r.memoSize, r.memoDBT = m, size, dbt
+}
+
+// start reads the header on first use
+func (r *Reader) start() error {
+	if r.started {
+		return r.err
+	}
+	r.started = true
+	r.decoder = encodingOf(r.Encoding).NewDecoder()
+	if !r.preset {
+		s, err := readStructure(&countingReader{r: r.r}, &Options{Encoding: r.Encoding, Clipper: r.Clipper})
+		r.header, r.fields, r.clipper, r.err = s.Header, s.Fields, s.Clipper, err
+		if r.err != nil {
+			return r.err
+		}
+	}
+	if r.OnSchema != nil {
+		r.OnSchema(Schema{Header: r.header, Fields: r.fields, Clipper: r.clipper})
+	}
+	if r.memoR != nil && hasMemoFields(r.fields) {
+		if r.memo, r.err = NewMemo(r.memoR, r.memoSize, !r.memoDBT, r.header.Version); r.err != nil {
+			return r.err
+		}
+	}
+	r.record = make([]byte, r.header.RecLen)
+	r.bounds = make([]int, len(r.fields)+1)
+	r.row = make([]string, len(r.fields))
+	return nil
+}
+
+// Header returns the table header
+func (r *Reader) Header() (Header, error) {
+	err := r.start()
+	return r.header, err
+}
+
+// Schema returns the structure of the table
+func (r *Reader) Schema() (Schema, error) {
+	err := r.start()
+	return Schema{Header: r.header, Fields: r.fields, Clipper: r.clipper}, err
+}
+
+// Fields returns the fields of the table, without the hidden _NullFlags
+// field of Visual FoxPro tables
+func (r *Reader) Fields() ([]Field, error) {
+	err := r.start()
+	return r.fields, err
+}
+
+// Read returns the values of the next record, formatted as ConvertFS
+// writes them, or io.EOF after the last record. A truncated table ends at
+// its last complete record. The returned slice is reused by the next call.
+func (r *Reader) Read() ([]string, error) {
+	if err := r.start(); err != nil {
+		return nil, err
+	}
+	for {
+		if r.read >= r.header.NumRecs {
+			return nil, io.EOF
+		}
+		if _, err := io.ReadFull(r.r, r.record); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				r.read = r.header.NumRecs
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("record %d: %w", r.read+1, err)
+		}
+		r.read++
+		if r.record[0] == 0x1A {
+			// End-of-file marker
+			r.read = r.header.NumRecs
+			return nil, io.EOF
+		}
+		if r.Decrypt != nil {
+			r.Decrypt(r.read-1, r.record)
+		}
+		r.deleted = r.record[0] == '*'
+		if !r.deleted || !r.SkipDeleted {
+			break
+		}
+	}
+
+	r.buf = r.buf[:0]
+	for i, field := range r.fields {
+		r.bounds[i] = len(r.buf)
+		r.buf = appendValue(r.buf, r.record, field, r.decoder, r.memo)
+	}
+	r.bounds[len(r.fields)] = len(r.buf)
+	line := string(r.buf)
+	for i := range r.row {
+		r.row[i] = line[r.bounds[i]:r.bounds[i+1]]
+	}
+	return r.row, nil
+}
+
+// ReadContext is Read, but it fails with the error of ctx, wrapped, once
+// ctx is done
+func (r *Reader) ReadContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("stopped after %d records: %w", r.read, err)
+	}
+	return r.Read()
+}
+
+// Deleted reports whether the record last returned by Read is marked as
+// deleted
+func (r *Reader) Deleted() bool {
+	return r.deleted
+}
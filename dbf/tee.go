@@ -0,0 +1,45 @@
+package dbf
+
+import "context"
+
+// Tee reads the records like Batches and copies every batch to n channels,
+// so one pass over the table can feed several independent consumers. Each
+// channel holds at most depth batches, so the slowest consumer paces the
+// reader instead of batches piling up in memory. Batches are shared, not
+// copied: consumers must treat them as read-only and release them; a batch
+// is recycled after the last release.
+func (r *Reader) Tee(ctx context.Context, n, depth int) []<-chan *Batch {
+	in := r.Batches(ctx, depth)
+	outs := make([]chan *Batch, n)
+	result := make([]<-chan *Batch, n)
+	for i := range outs {
+		outs[i] = make(chan *Batch, depth)
+		result[i] = outs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		for b := range in {
+			b.Retain(n - 1)
+			for i, out := range outs {
+				select {
+				case out <- b:
+				case <-ctx.Done():
+					// Drop the references of the consumers not reached
+					for range outs[i:] {
+						b.Release()
+					}
+					for b := range in {
+						b.Release()
+					}
+					return
+				}
+			}
+		}
+	}()
+	return result
+}
@@ -0,0 +1,179 @@
+package dbf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// appendValue appends the text form of a field of record to dst, as
+// dbf2csv writes it by default: dates as 2006-01-02, datetimes as
+// 2006-01-02 15:04:05 (UTC), logicals as TRUE/FALSE, currency with 4
+// decimals, binary data in hex and text with surrounding spaces trimmed.
+// Nulls and empty values append nothing.
+func appendValue(dst, record []byte, f Field, decoder *encoding.Decoder, memo *Memo) []byte {
+	if f.Offset+f.Length > len(record) || f.Null(record) {
+		return dst
+	}
+	raw := f.Data(record)
+
+	switch f.Type {
+	case 'V': // Varchar - VFP
+		start := len(dst)
+		dst = appendDecoded(dst, raw, decoder)
+		return dst[:start+len(bytes.TrimRight(dst[start:], "\x00"))]
+
+	case 'Q': // Varbinary - VFP
+		return hex.AppendEncode(dst, raw)
+
+	case 'M', 'G', 'W', 'P': // Memo / General (OLE) / Blob / Picture
+		if memo == nil || f.Type == 'G' {
+			return append(dst, "[MEMO/OLE]"...)
+		}
+		data, err := memo.Read(MemoBlock(raw))
+		if err != nil {
+			return dst
+		}
+		if f.Type != 'M' || f.Flags&fieldFlagBinary != 0 {
+			return hex.AppendEncode(dst, data)
+		}
+		start := len(dst)
+		dst = appendDecoded(dst, data, decoder)
+		return dst[:start+len(bytes.TrimRight(dst[start:], "\x00\x1a"))]
+
+	case 'N', 'F':
+		return append(dst, bytes.TrimSpace(raw)...)
+
+	case 'L':
+		if len(raw) == 1 {
+			switch raw[0] {
+			case 'Y', 'y', 'T', 't':
+				return append(dst, "TRUE"...)
+			case 'N', 'n', 'F', 'f':
+				return append(dst, "FALSE"...)
+			}
+		}
+		return dst
+
+	case 'D': // Date (ASCII YYYYMMDD)
+		if len(raw) == 8 && len(bytes.TrimSpace(raw)) == 8 {
+			dst = append(dst, raw[0:4]...)
+			dst = append(dst, '-')
+			dst = append(dst, raw[4:6]...)
+			dst = append(dst, '-')
+			return append(dst, raw[6:8]...)
+		}
+		return append(dst, bytes.TrimSpace(raw)...)
+
+	case 'I', '+': // Integer - VFP, Autoincrement - dBase 7
+		if v, ok := f.Int(raw); ok {
+			return strconv.AppendInt(dst, v, 10)
+		}
+		return dst
+
+	case 'B', 'O': // Double - VFP, dBase 7
+		if v, ok := f.Float(raw); ok {
+			return strconv.AppendFloat(dst, v, 'g', -1, 64)
+		}
+		return dst
+
+	case 'Y': // Currency (8 bytes, int64 scaled by 10000) - VFP
+		if v, ok := f.Currency(raw); ok {
+			return appendCurrency(dst, v)
+		}
+		return dst
+
+	case 'T', '@': // DateTime - VFP, Timestamp - dBase 7
+		if t, ok := f.Time(raw); ok {
+			return t.AppendFormat(dst, "2006-01-02 15:04:05")
+		}
+		return dst
+	}
+
+	// Character (C) and others: decode first, then trim, since a trailing
+	// byte of a multi-byte character may be 0x20
+	start := len(dst)
+	dst = appendDecoded(dst, raw, decoder)
+	n := copy(dst[start:], bytes.TrimSpace(bytes.TrimRight(dst[start:], "\x00")))
+	return dst[:start+n]
+}
+
+// appendDecoded decodes raw into dst; on failure the raw bytes are kept
+func appendDecoded(dst, raw []byte, decoder *encoding.Decoder) []byte {
+	ascii := true
+	for _, c := range raw {
+		if c >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return append(dst, raw...)
+	}
+	decoded, _, err := transform.Bytes(decoder, raw)
+	if err != nil {
+		return append(dst, raw...)
+	}
+	return append(dst, decoded...)
+}
+
+// appendCurrency formats a Y value (an integer count of 1/10000 units)
+// exactly, without going through float64
+func appendCurrency(dst []byte, val int64) []byte {
+	u := uint64(val)
+	if val < 0 {
+		dst = append(dst, '-')
+		u = -u
+	}
+	dst = strconv.AppendUint(dst, u/10000, 10)
+	frac := u % 10000
+	return append(dst, '.', byte('0'+frac/1000), byte('0'+frac/100%10), byte('0'+frac/10%10), byte('0'+frac%10))
+}
+
+// level7Int decodes a dBase 7 long: big-endian with the sign bit flipped
+func level7Int(raw []byte) int32 {
+	return int32(binary.BigEndian.Uint32(raw) ^ 0x80000000)
+}
+
+// level7Double decodes a dBase 7 double: big-endian, positive values with
+// the sign bit flipped, negative values with all bits inverted
+func level7Double(raw []byte) float64 {
+	bits := binary.BigEndian.Uint64(raw)
+	if bits&(1<<63) != 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+func isZero(raw []byte) bool {
+	for _, c := range raw {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// julianDayToTime converts a Julian Day and milliseconds to a UTC time
+// (Fliegel and Van Flandern, 1968)
+func julianDayToTime(jd int, millis int) time.Time {
+	l := jd + 68569
+	n := (4 * l) / 146097
+	l = l - (146097*n+3)/4
+	i := (4000 * (l + 1)) / 1461001
+	l = l - (1461*i)/4 + 31
+	j := (80 * l) / 2447
+	d := l - (2447*j)/80
+	l = j / 11
+	m := j + 2 - 12*l
+	y := 100*(n-49) + i + l
+	return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC).Add(time.Duration(millis/1000) * time.Second)
+}
@@ -0,0 +1,372 @@
+package dbf
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// fieldLens are the fixed lengths of the field types Writer supports; 0
+// means the schema sets the length
+var fieldLens = map[byte]int{
+	'C': 0, 'N': 0, 'F': 0, 'D': 8, 'L': 1,
+	'I': 4, 'B': 8, 'Y': 8, 'T': 8, // Visual FoxPro
+}
+
+// vfpBacklinkSize is the size of the database container path after the
+// field descriptors of a Visual FoxPro table
+const vfpBacklinkSize = 263
+
+// Writer writes a table to a stream. The header comes first and holds the
+// record count: Close fills it in when the destination can seek back (an
+// *os.File, for instance); for network connections and pipes set Count
+// before the first Write instead.
+//
+// The schema may use the types C, N, F, D, L and, making the table a
+// Visual FoxPro table, I, B, Y and T. Values are given as strings in the
+// form Reader returns them.
+type Writer struct {
+	// Encoding is the text encoding of the table (default UTF-8)
+	Encoding encoding.Encoding
+	// Count is the number of records that will be written, for streams
+	// that Close cannot seek back in
+	Count uint32
+
+	w       io.Writer
+	bw      *bufio.Writer
+	fields  []Field
+	vfp     bool
+	started bool
+	encoder *encoding.Encoder
+	record  []byte
+	written uint32
+	err     error
+}
+
+// NewWriter returns a Writer for a table with the fields of schema. Only
+// Name (up to 10 bytes), Type, Length and Dec of the fields are used; the
+// length of D, L, I, B, Y and T fields may be left 0.
+func NewWriter(w io.Writer, schema []Field) *Writer {
+	fields := make([]Field, len(schema))
+	copy(fields, schema)
+	return &Writer{w: w, bw: bufio.NewWriter(w), fields: fields}
+}
+
+// start checks the schema and writes the header on first use
+func (w *Writer) start() error {
+	if w.started {
+		return w.err
+	}
+	w.started = true
+	w.err = w.writeHeader()
+	return w.err
+}
+
+func (w *Writer) writeHeader() error {
+	if len(w.fields) == 0 {
+		return errors.New("schema has no fields")
+	}
+	offset := 1
+	for i := range w.fields {
+		f := &w.fields[i]
+		n, ok := fieldLens[f.Type]
+		if !ok {
+			return fmt.Errorf("field %s: unsupported type %q", f.Name, f.Type)
+		}
+		if n == 0 && (f.Length < 1 || f.Length > 254) || n != 0 && f.Length != 0 && f.Length != n {
+			return fmt.Errorf("field %s: invalid length %d", f.Name, f.Length)
+		}
+		if n != 0 {
+			f.Length = n
+		}
+		if f.Type == 'I' || f.Type == 'B' || f.Type == 'Y' || f.Type == 'T' {
+			w.vfp = true
+		}
+		f.Offset = offset
+		offset += f.Length
+	}
+	if offset > 65535 {
+		return fmt.Errorf("record length %d exceeds the DBF limit of 65535 bytes", offset)
+	}
+
+	enc := w.Encoding
+	if enc == nil {
+		enc = unicode.UTF8
+	}
+	w.encoder = enc.NewEncoder()
+	w.record = make([]byte, offset)
+
+	now := time.Now()
+	h := Header{
+		Version:   0x03,
+		Year:      byte(now.Year() - 1900),
+		Month:     byte(now.Month()),
+		Day:       byte(now.Day()),
+		NumRecs:   w.Count,
+		HeaderLen: uint16(32 + 32*len(w.fields) + 1),
+		RecLen:    uint16(offset),
+	}
+	if w.vfp {
+		h.Version = 0x30
+		h.HeaderLen += vfpBacklinkSize
+	}
+	if err := binary.Write(w.bw, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	for _, f := range w.fields {
+		var desc [32]byte
+		name, err := encodeValue(f.Name, w.encoder)
+		if err != nil {
+			return fmt.Errorf("field %s: name not representable in the table encoding", f.Name)
+		}
+		copy(desc[:10], name)
+		desc[11], desc[16], desc[17] = f.Type, byte(f.Length), byte(f.Dec)
+		if w.vfp {
+			binary.LittleEndian.PutUint32(desc[12:16], uint32(f.Offset))
+		}
+		if _, err := w.bw.Write(desc[:]); err != nil {
+			return err
+		}
+	}
+	if err := w.bw.WriteByte(0x0D); err != nil {
+		return err
+	}
+	if w.vfp {
+		_, err := w.bw.Write(make([]byte, vfpBacklinkSize))
+		return err
+	}
+	return nil
+}
+
+// Write writes one record; values are matched to the fields in order,
+// missing values are left blank. An empty value leaves its field blank.
+func (w *Writer) Write(values []string) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if w.Count > 0 && w.written == w.Count {
+		return fmt.Errorf("more records than the Count of %d", w.Count)
+	}
+
+	rec := w.record
+	for i := range rec {
+		rec[i] = ' ' // also the deletion flag: not deleted
+	}
+	for i, f := range w.fields {
+		if i >= len(values) {
+			break
+		}
+		if err := w.put(rec[f.Offset:f.Offset+f.Length], f, strings.TrimSpace(values[i])); err != nil {
+			return fmt.Errorf("record %d, field %s: %w", w.written+1, f.Name, err)
+		}
+	}
+	if _, err := w.bw.Write(rec); err != nil {
+		return err
+	}
+	w.written++
+	return nil
+}
+
+// WriteContext is Write, but it fails with the error of ctx, wrapped, once
+// ctx is done
+func (w *Writer) WriteContext(ctx context.Context, values []string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("stopped after %d records: %w", w.written, err)
+	}
+	return w.Write(values)
+}
+
+// put stores value in the slot of field f
+func (w *Writer) put(slot []byte, f Field, value string) error {
+	switch f.Type {
+	case 'I', 'B', 'Y', 'T':
+		clear(slot)
+	}
+	if value == "" {
+		return nil
+	}
+
+	switch f.Type {
+	case 'C':
+		b, err := encodeValue(value, w.encoder)
+		if err != nil {
+			return fmt.Errorf("%q is not representable in the table encoding", value)
+		}
+		if len(b) > len(slot) {
+			return fmt.Errorf("value of %d bytes exceeds the field length %d", len(b), len(slot))
+		}
+		copy(slot, b)
+
+	case 'N', 'F':
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		s := strconv.FormatFloat(v, 'f', f.Dec, 64)
+		if len(s) > len(slot) {
+			return fmt.Errorf("%s does not fit N(%d,%d)", value, f.Length, f.Dec)
+		}
+		copy(slot[len(slot)-len(s):], s)
+
+	case 'D':
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			if t, err = time.Parse("20060102", value); err != nil {
+				return fmt.Errorf("invalid date %q (expected 2006-01-02)", value)
+			}
+		}
+		copy(slot, t.Format("20060102"))
+
+	case 'L':
+		switch strings.ToLower(value) {
+		case "true", "t", "yes", "y", "1":
+			slot[0] = 'T'
+		case "false", "f", "no", "n", "0":
+			slot[0] = 'F'
+		default:
+			return fmt.Errorf("invalid logical %q", value)
+		}
+
+	case 'I':
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		binary.LittleEndian.PutUint32(slot, uint32(int32(n)))
+
+	case 'B':
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		binary.LittleEndian.PutUint64(slot, math.Float64bits(v))
+
+	case 'Y':
+		n, ok := parseCurrency(value)
+		if !ok {
+			return fmt.Errorf("invalid currency %q", value)
+		}
+		binary.LittleEndian.PutUint64(slot, uint64(n))
+
+	case 'T':
+		t, err := time.Parse("2006-01-02 15:04:05", value)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, value); err != nil {
+				return fmt.Errorf("invalid datetime %q (expected 2006-01-02 15:04:05)", value)
+			}
+		}
+		day, ms := timeToJulianDay(t.UTC())
+		binary.LittleEndian.PutUint32(slot[:4], uint32(day))
+		binary.LittleEndian.PutUint32(slot[4:], uint32(ms))
+	}
+	return nil
+}
+
+// Close ends the table and flushes it, filling in the record count when
+// Count was not set. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if err := w.bw.WriteByte(0x1A); err != nil {
+		return err
+	}
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+	if w.Count > 0 {
+		if w.written != w.Count {
+			return fmt.Errorf("wrote %d records, but Count is %d", w.written, w.Count)
+		}
+		return nil
+	}
+
+	var count [4]byte
+	binary.LittleEndian.PutUint32(count[:], w.written)
+	switch dst := w.w.(type) {
+	case io.WriterAt:
+		_, err := dst.WriteAt(count[:], 4)
+		return err
+	case io.WriteSeeker:
+		end, err := dst.Seek(0, io.SeekCurrent)
+		if err == nil {
+			_, err = dst.Seek(4, io.SeekStart)
+		}
+		if err == nil {
+			_, err = dst.Write(count[:])
+		}
+		if err == nil {
+			_, err = dst.Seek(end, io.SeekStart)
+		}
+		return err
+	}
+	if w.written > 0 {
+		return errors.New("the destination cannot seek back to store the record count; set Count")
+	}
+	return nil
+}
+
+// encodeValue encodes s with encoder; it fails on characters the encoding
+// cannot represent
+func encodeValue(s string, encoder *encoding.Encoder) ([]byte, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return encoder.Bytes([]byte(s))
+		}
+	}
+	return []byte(s), nil
+}
+
+// parseCurrency parses a decimal such as "-1234.5" into 1/10000 units
+// exactly; digits beyond the fourth decimal are rounded half away from zero
+func parseCurrency(s string) (int64, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, false
+	}
+
+	var n int64
+	for _, c := range whole + (frac + "0000")[:4] {
+		if c < '0' || c > '9' || n > (math.MaxInt64-9)/10 {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if len(frac) > 4 {
+		for _, c := range frac[4:] {
+			if c < '0' || c > '9' {
+				return 0, false
+			}
+		}
+		if frac[4] >= '5' {
+			n++
+		}
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+// timeToJulianDay is the inverse of julianDayToTime: the Julian day number
+// and the milliseconds since midnight of t
+func timeToJulianDay(t time.Time) (int, int) {
+	const unixEpochJD = 2440588 // 1970-01-01
+	secs := t.Unix()
+	days := math.Floor(float64(secs) / 86400)
+	rem := secs - int64(days)*86400
+	return int(days) + unixEpochJD, int(rem)*1000 + t.Nanosecond()/1e6
+}
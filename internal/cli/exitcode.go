@@ -0,0 +1,47 @@
+// Package cli holds the process plumbing dbf2csv and csv2dbf share: exit
+// codes, profiling and -quiet output.
+package cli
+
+import "os"
+
+// Exit codes
+const (
+	ExitOK          = 0
+	ExitFailed      = 1   // every conversion failed, or -watch/-serve stopped on an error
+	ExitUsage       = 2   // invalid options or arguments, as for flags the flag package rejects
+	ExitPartial     = 3   // some conversions failed, the others succeeded
+	ExitInterrupted = 130 // Ctrl+C or SIGTERM
+)
+
+// Batch counts the conversions of a run for its exit code; skipped
+// up-to-date files count as converted
+type Batch struct {
+	converted int
+	failed    int
+}
+
+// Add counts a conversion that ended with err
+func (b *Batch) Add(err error) {
+	if err != nil {
+		b.failed++
+	} else {
+		b.converted++
+	}
+}
+
+// ExitCode returns ExitOK, ExitFailed or ExitPartial
+func (b *Batch) ExitCode() int {
+	switch {
+	case b.failed == 0:
+		return ExitOK
+	case b.converted == 0:
+		return ExitFailed
+	}
+	return ExitPartial
+}
+
+// Exit ends a run that may be profiled with code
+func Exit(code int) {
+	StopProfiles()
+	os.Exit(code)
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// cpuProfile is the open -cpuprofile file while the CPU profile runs
+var cpuProfile *os.File
+
+// memProfile is the -memprofile file written at the end of the run
+var memProfile string
+
+// StartProfiles starts the CPU profile into cpu, if it is set, and notes
+// mem for the heap profile StopProfiles writes
+func StartProfiles(cpu, mem string) error {
+	memProfile = mem
+	if cpu == "" {
+		return nil
+	}
+	f, err := os.Create(cpu)
+	if err != nil {
+		return fmt.Errorf("failed to create CPU profile: %w", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to start CPU profile: %w", err)
+	}
+	cpuProfile = f
+	return nil
+}
+
+// StopProfiles ends the CPU profile and writes the -memprofile heap profile,
+// for inspection with go tool pprof
+func StopProfiles() {
+	if cpuProfile != nil {
+		pprof.StopCPUProfile()
+		cpuProfile.Close()
+		cpuProfile = nil
+	}
+	if memProfile == "" {
+		return
+	}
+	f, err := os.Create(memProfile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to create memory profile: %v\n", err)
+		return
+	}
+	defer f.Close()
+	runtime.GC() // up-to-date statistics
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to write memory profile: %v\n", err)
+	}
+}
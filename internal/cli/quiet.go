@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+)
+
+// SilenceOutput discards the informational output for -quiet and -log json.
+// Processing and Done lines, statistics and warnings are all printed to
+// stdout, while errors go to stderr, so only the errors (or the log events)
+// remain.
+func SilenceOutput() {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(ExitFailed)
+	}
+	os.Stdout = devNull
+}
@@ -0,0 +1,230 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobRetention is how long a finished job and its result are kept
+const jobRetention = time.Hour
+
+// job is a conversion running in the background for POST /jobs. Its
+// progress is read from the conversion's -progress json events.
+type job struct {
+	mu      sync.Mutex
+	ID      string  `json:"id"`
+	Status  string  `json:"status"` // queued, running, done or failed
+	File    string  `json:"file"`
+	Rows    uint32  `json:"rows"`
+	Total   uint32  `json:"total"`
+	Bytes   int64   `json:"bytes"`
+	Elapsed float64 `json:"elapsed"`
+	Error   string  `json:"error,omitempty"`
+	Log     string  `json:"log,omitempty"`    // program output of a failed job
+	Result  string  `json:"result,omitempty"` // download URL once done
+
+	conv     *conversion
+	finished time.Time
+	partial  []byte // output after the last complete line
+	log      bytes.Buffer
+}
+
+// jobEvent holds the fields of the -progress json events a job tracks
+type jobEvent struct {
+	Event   string  `json:"event"`
+	Rows    uint32  `json:"rows"`
+	Total   uint32  `json:"total"`
+	Records uint32  `json:"records"`
+	Bytes   int64   `json:"bytes"`
+	Elapsed float64 `json:"elapsed"`
+}
+
+// Write receives the conversion's output: progress events update the job,
+// other lines are kept as its log
+func (j *job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.partial = append(j.partial, p...)
+	for {
+		i := bytes.IndexByte(j.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := j.partial[:i+1]
+		var ev jobEvent
+		if line[0] != '{' || json.Unmarshal(line, &ev) != nil {
+			j.log.Write(line)
+		} else if ev.Event == "schema" {
+			j.Total = ev.Records
+		} else {
+			j.Rows, j.Total, j.Bytes, j.Elapsed = ev.Rows, ev.Total, ev.Bytes, ev.Elapsed
+		}
+		j.partial = j.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// jobQueue runs the jobs of a server, sharing its conversion slots with
+// POST /convert
+type jobQueue struct {
+	ctx   context.Context
+	cfg   *Config
+	exe   string
+	slots chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	wg   sync.WaitGroup
+}
+
+func newJobQueue(ctx context.Context, cfg *Config, exe string, slots chan struct{}) *jobQueue {
+	q := &jobQueue{ctx: ctx, cfg: cfg, exe: exe, slots: slots, jobs: make(map[string]*job)}
+	go func() {
+		tick := time.NewTicker(time.Minute)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+				q.expire()
+			}
+		}
+	}()
+	return q
+}
+
+// submit handles POST /jobs: it saves the upload like POST /convert, starts
+// the conversion and replies 202 Accepted with the job
+func (q *jobQueue) submit(w http.ResponseWriter, r *http.Request) {
+	c, status, err := q.cfg.newConversion(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	j := &job{ID: hex.EncodeToString(id), Status: "queued", File: c.input, conv: c}
+
+	q.mu.Lock()
+	q.jobs[j.ID] = j
+	q.mu.Unlock()
+	q.wg.Add(1)
+	go q.run(j)
+
+	fmt.Printf("  >> %s %s: job %s\n", r.RemoteAddr, c.input, j.ID)
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJob(w, j, http.StatusAccepted)
+}
+
+func (q *jobQueue) run(j *job) {
+	defer q.wg.Done()
+	select {
+	case q.slots <- struct{}{}:
+		defer func() { <-q.slots }()
+	case <-q.ctx.Done():
+		q.finish(j, q.ctx.Err(), 0)
+		return
+	}
+
+	j.mu.Lock()
+	j.Status = "running"
+	j.mu.Unlock()
+	start := time.Now()
+	err := j.conv.run(q.ctx, q.exe, j, true)
+	q.finish(j, err, time.Since(start))
+}
+
+func (q *jobQueue) finish(j *job, err error, elapsed time.Duration) {
+	RecordConversion(err, elapsed)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finished = time.Now()
+	if err != nil {
+		j.Status, j.Error, j.Log = "failed", err.Error(), j.log.String()
+		fmt.Printf("  >> job %s %s: failed: %v (%.3fs)\n", j.ID, j.File, err, elapsed.Seconds())
+		return
+	}
+	j.Status, j.Result = "done", "/jobs/"+j.ID+"/result"
+	fmt.Printf("  >> job %s %s -> %s (%.3fs)\n", j.ID, j.File, strings.Join(j.conv.outputs, ", "), elapsed.Seconds())
+}
+
+// lookup returns the job named in the request path, or replies 404
+func (q *jobQueue) lookup(w http.ResponseWriter, r *http.Request) *job {
+	q.mu.Lock()
+	j := q.jobs[r.PathValue("id")]
+	q.mu.Unlock()
+	if j == nil {
+		http.Error(w, "no such job", http.StatusNotFound)
+	}
+	return j
+}
+
+// status handles GET /jobs/{id}
+func (q *jobQueue) status(w http.ResponseWriter, r *http.Request) {
+	if j := q.lookup(w, r); j != nil {
+		writeJob(w, j, http.StatusOK)
+	}
+}
+
+// result handles GET /jobs/{id}/result, sending the converted files of a
+// finished job like POST /convert does
+func (q *jobQueue) result(w http.ResponseWriter, r *http.Request) {
+	j := q.lookup(w, r)
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	status := j.Status
+	j.mu.Unlock()
+	if status != "done" {
+		http.Error(w, fmt.Sprintf("job is %s", status), http.StatusConflict)
+		return
+	}
+	if err := sendFiles(w, j.conv.dir, j.conv.outputs); err != nil {
+		q.cfg.Warnf("%s: %v", r.RemoteAddr, err)
+	}
+}
+
+// expire removes jobs finished more than jobRetention ago
+func (q *jobQueue) expire() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, j := range q.jobs {
+		j.mu.Lock()
+		old := !j.finished.IsZero() && time.Since(j.finished) > jobRetention
+		j.mu.Unlock()
+		if old {
+			j.conv.remove()
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// close waits for running jobs to stop and removes all of them
+func (q *jobQueue) close() {
+	q.wg.Wait()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		j.conv.remove()
+	}
+}
+
+func writeJob(w http.ResponseWriter, j *job, status int) {
+	j.mu.Lock()
+	data, _ := json.Marshal(j)
+	j.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
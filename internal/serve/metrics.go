@@ -0,0 +1,121 @@
+package serve
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conversion metrics, published under /debug/vars (expvar) and /metrics
+// (Prometheus text format) when -metrics is set
+var (
+	metricFilesConverted = expvar.NewInt("files_converted")
+	metricFilesFailed    = expvar.NewInt("files_failed")
+	metricRows           = expvar.NewInt("rows_converted")
+	metricDuration       = newHistogram("conversion_seconds", []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 1800})
+)
+
+// histogram is a cumulative bucket histogram of observed values
+type histogram struct {
+	mu      sync.Mutex
+	name    string
+	bounds  []float64
+	buckets []uint64 // buckets[i] counts values <= bounds[i]; last is +Inf
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name string, bounds []float64) *histogram {
+	h := &histogram{name: name, bounds: bounds, buckets: make([]uint64, len(bounds)+1)}
+	expvar.Publish(name, expvar.Func(h.snapshot))
+	return h
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.bounds {
+		if v <= b {
+			h.buckets[i]++
+		}
+	}
+	h.buckets[len(h.bounds)]++
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) snapshot() any {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets := make(map[string]uint64, len(h.buckets))
+	for i, b := range h.bounds {
+		buckets[fmt.Sprint(b)] = h.buckets[i]
+	}
+	buckets["+Inf"] = h.buckets[len(h.bounds)]
+	return map[string]any{"buckets": buckets, "sum": h.sum, "count": h.count}
+}
+
+// RecordConversion updates the metrics after one file has been processed
+func RecordConversion(err error, elapsed time.Duration) {
+	if err != nil {
+		metricFilesFailed.Add(1)
+		return
+	}
+	metricFilesConverted.Add(1)
+	metricDuration.observe(elapsed.Seconds())
+}
+
+// AddRows counts records converted
+func AddRows(n int64) {
+	metricRows.Add(n)
+}
+
+// Metrics starts the -metrics endpoint in the background; warnf reports it
+// stopping
+func Metrics(addr string, warnf func(format string, args ...any)) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/metrics", writePrometheus)
+
+	// Profiles of long runs, for go tool pprof; not the command line,
+	// which may hold credentials
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			warnf("metrics endpoint stopped: %v", err)
+		}
+	}()
+}
+
+// writePrometheus renders the metrics in the Prometheus text exposition format
+func writePrometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	var b strings.Builder
+	counter := func(name, help string, v int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+	counter("files_converted_total", "Files converted successfully.", metricFilesConverted.Value())
+	counter("files_failed_total", "Files that failed to convert.", metricFilesFailed.Value())
+	counter("rows_converted_total", "Records converted.", metricRows.Value())
+
+	h := metricDuration
+	h.mu.Lock()
+	fmt.Fprintf(&b, "# HELP %s Conversion duration per file.\n# TYPE %s histogram\n", h.name, h.name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(&b, "%s_bucket{le=\"%g\"} %d\n", h.name, bound, h.buckets[i])
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.buckets[len(h.bounds)])
+	fmt.Fprintf(&b, "%s_sum %g\n%s_count %d\n", h.name, h.sum, h.name, h.count)
+	h.mu.Unlock()
+
+	w.Write([]byte(b.String()))
+}
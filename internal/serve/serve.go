@@ -0,0 +1,329 @@
+// Package serve runs the -serve HTTP endpoints and the -metrics endpoint of
+// dbf2csv and csv2dbf. Each conversion runs the program itself on the
+// uploaded files in a scratch directory, so requests with different options
+// never share state.
+package serve
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Config describes the program a server runs conversions with
+type Config struct {
+	// Name is the program name, for the scratch directories
+	Name string
+	// Input names the file a conversion takes, in errors ("table")
+	Input string
+	// DefaultFile names an upload sent as the body without ?filename=
+	DefaultFile string
+	// IsInput reports whether an uploaded file is the one to convert rather
+	// than a file that goes with it, such as a memo file
+	IsInput func(name string) bool
+	// Denied are the options a client may not set: they control the server
+	// itself or read and write files on it
+	Denied map[string]bool
+	// MaxUpload is the largest request body accepted, in bytes (-max-upload)
+	MaxUpload int64
+	// Warnf reports problems that don't stop the server
+	Warnf func(format string, args ...any)
+}
+
+// conversion is one file uploaded for conversion, saved in a scratch
+// directory together with the files that go with it
+type conversion struct {
+	dir      string
+	input    string
+	uploaded map[string]bool
+	args     []string
+	outputs  []string // files written by the conversion
+}
+
+// Run serves conversions on addr until ctx is done. POST /convert streams
+// the result back; POST /jobs converts large files in the background,
+// polled with GET /jobs/{id}.
+func Run(ctx context.Context, addr string, cfg Config) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	slots := make(chan struct{}, runtime.NumCPU())
+	jobs := newJobQueue(ctx, &cfg, exe, slots)
+	defer jobs.close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /convert", func(w http.ResponseWriter, r *http.Request) {
+		c, status, err := cfg.newConversion(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		defer c.remove()
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-r.Context().Done():
+			return
+		}
+		start := time.Now()
+		var log bytes.Buffer
+		err = c.run(r.Context(), exe, &log, false)
+		RecordConversion(err, time.Since(start))
+		if err != nil {
+			fmt.Printf("  >> %s %s: failed: %v (%.3fs)\n", r.RemoteAddr, c.input, err, time.Since(start).Seconds())
+			http.Error(w, log.String(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := sendFiles(w, c.dir, c.outputs); err != nil {
+			cfg.Warnf("%s: %v", r.RemoteAddr, err)
+			return
+		}
+		fmt.Printf("  >> %s %s -> %s (%.3fs)\n", r.RemoteAddr, c.input, strings.Join(c.outputs, ", "), time.Since(start).Seconds())
+	})
+	mux.HandleFunc("POST /jobs", jobs.submit)
+	mux.HandleFunc("GET /jobs/{id}", jobs.status)
+	mux.HandleFunc("GET /jobs/{id}/result", jobs.result)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("Serving: http://%s/convert and /jobs\n", addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newConversion saves the input in a request. The body is either the input
+// file itself (name it with ?filename=data.dbf.gz when compressed) or a
+// multipart form with it and the files that go with it. Other query
+// parameters are passed on as options, e.g. ?e=GBK&deleted=skip&f=%3B. On
+// error it returns the HTTP status to reply with; bodies over -max-upload
+// are refused.
+func (cfg *Config) newConversion(w http.ResponseWriter, r *http.Request) (*conversion, int, error) {
+	// Options given when the server was started are the defaults; the query
+	// parameters come later on the command line and so override them
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		if cfg.Denied[f.Name] {
+			return
+		}
+		value := f.Value.String()
+		if f.Name == "rename" && !strings.Contains(value, "=") {
+			value, _ = filepath.Abs(value) // a rename file, read from the scratch directory
+		}
+		args = append(args, "-"+f.Name+"="+value)
+	})
+	query := r.URL.Query()
+	for name, values := range query {
+		if name == "filename" {
+			continue
+		}
+		if flag.Lookup(name) == nil || cfg.Denied[name] {
+			return nil, http.StatusBadRequest, fmt.Errorf("option %q is not available", name)
+		}
+		if name == "rename" && !strings.Contains(strings.Join(values, ""), "=") {
+			return nil, http.StatusBadRequest, errors.New("option \"rename\" takes OLD=NEW pairs")
+		}
+		for _, v := range values {
+			args = append(args, "-"+name+"="+v)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", cfg.Name+"-serve-*")
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	c := &conversion{dir: dir, args: args}
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxUpload)
+	filename := query.Get("filename")
+	if filename == "" {
+		filename = cfg.DefaultFile
+	}
+	if c.uploaded, err = saveUploads(r, dir, filename); err != nil {
+		c.remove()
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("upload exceeds the limit of %d bytes (-max-upload)", tooLarge.Limit)
+		}
+		return nil, http.StatusBadRequest, err
+	}
+	var inputs []string
+	for name := range c.uploaded {
+		if cfg.IsInput(name) {
+			inputs = append(inputs, name)
+		}
+	}
+	if len(inputs) != 1 {
+		c.remove()
+		return nil, http.StatusBadRequest, fmt.Errorf("expected one %s, got %d", cfg.Input, len(inputs))
+	}
+	c.input = inputs[0]
+	return c, 0, nil
+}
+
+// run converts the input, writing the program's output to out; with
+// jsonProgress the conversion reports -progress json events there too
+func (c *conversion) run(ctx context.Context, exe string, out io.Writer, jsonProgress bool) error {
+	args := c.args
+	if jsonProgress {
+		args = append(args, "-progress=json")
+	}
+	cmd := exec.CommandContext(ctx, exe, append(args, c.input)...)
+	cmd.Dir = c.dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	if err == nil {
+		c.outputs, err = newFiles(c.dir, c.uploaded)
+	}
+	if err == nil && len(c.outputs) == 0 {
+		err = errors.New("no output written")
+	}
+	return err
+}
+
+// remove deletes the scratch directory
+func (c *conversion) remove() {
+	os.RemoveAll(c.dir)
+}
+
+// newFiles returns the files in dir that were not uploaded
+func newFiles(dir string, uploaded map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !uploaded[e.Name()] {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// saveUploads stores the uploaded files in dir and returns their names; a
+// body that is not a multipart form is saved as filename
+func saveUploads(r *http.Request, dir, filename string) (map[string]bool, error) {
+	saved := make(map[string]bool)
+	save := func(name string, body io.Reader) error {
+		name = filepath.Base(name)
+		if name == "." || name == string(filepath.Separator) || strings.HasPrefix(name, ".") {
+			return fmt.Errorf("invalid file name %q", name)
+		}
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		saved[name] = true
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return saved, save(filename, r.Body)
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return saved, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() != "" {
+			if err := save(part.FileName(), part); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// sendFiles streams the converted file back, or a zip archive when the
+// conversion wrote more than one (a memo file, say)
+func sendFiles(w http.ResponseWriter, dir string, names []string) error {
+	if len(names) == 1 {
+		f, err := os.Open(filepath.Join(dir, names[0]))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", contentType(names[0]))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": names[0]}))
+		_, err = io.Copy(w, f)
+		return err
+	}
+
+	archive := strings.TrimSuffix(names[0], filepath.Ext(names[0])) + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archive}))
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		zf, err := zw.Create(name)
+		if err == nil {
+			_, err = io.Copy(zf, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// contentType returns the media type of an output file
+func contentType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return "text/csv"
+	case ".dbf":
+		return "application/x-dbf"
+	case ".gz":
+		return "application/gzip"
+	case ".zst":
+		return "application/zstd"
+	case ".json":
+		return "application/json"
+	case ".ndjson":
+		return "application/x-ndjson"
+	case ".parquet":
+		return "application/vnd.apache.parquet"
+	case ".avro":
+		return "application/avro"
+	case ".xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}